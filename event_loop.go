@@ -4,27 +4,62 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/scrobbler"
+	"github.com/spezifisch/stmps/subsonic"
 )
 
+// how often the now playing page is refreshed
+const nowPlayingInterval = 30 * time.Second
+
+// how often the server is asked for progress during a library scan
+const scanStatusInterval = 2 * time.Second
+
 type eventLoop struct {
-	// scrobbles are handled by background loop
-	scrobbleNowPlaying      chan string
-	scrobbleSubmissionTimer *time.Timer
+	// scrobbles are handled by background loop, the gui loop decides when a
+	// track was listened to long enough
+	scrobbleNowPlaying chan pendingScrobble
+	scrobbleSubmission chan pendingScrobble
+	scrobbleRetryTimer *time.Timer
+	scrobbleTargets    []*scrobbleTarget
+	scrobbleListen     listenTracker
+
+	// now playing info of other users is fetched by background loop
+	refreshNowPlaying chan struct{}
+	nowPlayingTicker  *time.Ticker
+
+	// library scans are started and polled by background loop, the artists of
+	// the music folder selected when the scan was started are fetched after it
+	startScan       chan string
+	scanStatusTimer *time.Timer
 }
 
 func (ui *Ui) initEventLoops() {
 	el := &eventLoop{
-		scrobbleNowPlaying: make(chan string, 5),
+		scrobbleNowPlaying: make(chan pendingScrobble, 5),
+		scrobbleSubmission: make(chan pendingScrobble, 5),
+		scrobbleTargets:    scrobbleTargetsFromConfig(ui.connection),
+		scrobbleListen:     listenTracker{thresholds: scrobbleThresholdsFromConfig()},
+		refreshNowPlaying:  make(chan struct{}, 1),
+		nowPlayingTicker:   time.NewTicker(nowPlayingInterval),
+		startScan:          make(chan string, 1),
 	}
 	ui.eventLoop = el
 
-	// create reused timer to scrobble after delay
-	el.scrobbleSubmissionTimer = time.NewTimer(0)
-	if !el.scrobbleSubmissionTimer.Stop() {
-		<-el.scrobbleSubmissionTimer.C
+	// create reused timer to retry pending scrobbles
+	el.scrobbleRetryTimer = time.NewTimer(0)
+	if !el.scrobbleRetryTimer.Stop() {
+		<-el.scrobbleRetryTimer.C
+	}
+
+	// create reused timer to poll scan status
+	el.scanStatusTimer = time.NewTimer(0)
+	if !el.scanStatusTimer.Stop() {
+		<-el.scanStatusTimer.C
 	}
 }
 
@@ -57,87 +92,160 @@ func (ui *Ui) guiEventLoop() {
 
 			// handle events from mpv wrapper
 			switch mpvEvent.Type {
-			case mpvplayer.EventStatus:
+			case player.EventStatus, player.EventPosition, player.EventDuration:
 				if mpvEvent.Data == nil {
 					continue
 				}
-				statusData := mpvEvent.Data.(mpvplayer.StatusData) // TODO is this safe to access? maybe we need a copy
+				statusData := mpvEvent.Data.(player.StatusData) // TODO is this safe to access? maybe we need a copy
+
+				if scrobble, ok := ui.eventLoop.scrobbleListen.Update(statusData.Position, statusData.Duration); ok {
+					ui.logger.Printf("scrobbler: %s listened to", scrobble.Id)
+					ui.eventLoop.scrobbleSubmission <- scrobble
+				}
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.playerStatus.SetText(formatPlayerStatus(statusData.Volume, statusData.Position, statusData.Duration))
+					ui.playerStatus.SetText(formatPlayerStatus(statusData))
+					ui.progressBar.SetProgress(statusData.Position, statusData.Duration)
+				})
+
+			case player.EventVolume, player.EventMute:
+				if mpvEvent.Data == nil {
+					continue
+				}
+				statusData := mpvEvent.Data.(player.StatusData)
+				// the progress didn't change
+				ui.app.QueueUpdateDraw(func() {
+					ui.playerStatus.SetText(formatPlayerStatus(statusData))
 				})
 
-			case mpvplayer.EventStopped:
+			case player.EventSeeked:
+				if mpvEvent.Data == nil {
+					continue
+				}
+				statusData := mpvEvent.Data.(player.StatusData)
+				// the skipped part doesn't count as listened to
+				ui.eventLoop.scrobbleListen.Seeked(statusData.Position)
+
+				ui.app.QueueUpdateDraw(func() {
+					ui.playerStatus.SetText(formatPlayerStatus(statusData))
+					ui.progressBar.SetProgress(statusData.Position, statusData.Duration)
+				})
+
+			case player.EventStopped:
 				ui.logger.Print("mpvEvent: stopped")
+				ui.eventLoop.scrobbleListen.Stop()
 				ui.app.QueueUpdateDraw(func() {
+					ui.playState = ""
 					ui.startStopStatus.SetText("[red::b]Stopped[::-]")
 					ui.queuePage.UpdateQueue()
 				})
 
-			case mpvplayer.EventPlaying:
+			case player.EventPlaying:
 				ui.logger.Print("mpvEvent: playing")
 				statusText := "[green::b]Playing[::-]"
 
-				var currentSong mpvplayer.QueueItem
+				var currentSong player.QueueItem
 				if mpvEvent.Data != nil {
-					currentSong = mpvEvent.Data.(mpvplayer.QueueItem) // TODO is this safe to access? maybe we need a copy
+					currentSong = mpvEvent.Data.(player.QueueItem) // TODO is this safe to access? maybe we need a copy
 					statusText += formatSongForStatusBar(&currentSong)
 
-					if ui.connection.Scrobble {
+					if len(ui.eventLoop.scrobbleTargets) > 0 {
+						scrobble := pendingScrobble{Track: scrobbleTrack(&currentSong), PlayedAt: time.Now()}
+
 						// scrobble "now playing" event (delegate to background event loop)
-						ui.eventLoop.scrobbleNowPlaying <- currentSong.Id
-
-						// scrobble "submission" after song has been playing a bit
-						// see: https://www.last.fm/api/scrobbling
-						// A track should only be scrobbled when the following conditions have been met:
-						// The track must be longer than 30 seconds. And the track has been played for
-						// at least half its duration, or for 4 minutes (whichever occurs earlier.)
-						if currentSong.Duration > 30 {
-							scrobbleDelay := currentSong.Duration / 2
-							if scrobbleDelay > 240 {
-								scrobbleDelay = 240
-							}
-							scrobbleDuration := time.Duration(scrobbleDelay) * time.Second
-
-							ui.eventLoop.scrobbleSubmissionTimer.Reset(scrobbleDuration)
-							ui.logger.Printf("scrobbler: timer started, %v", scrobbleDuration)
-						} else {
-							ui.logger.Printf("scrobbler: track too short")
-						}
+						ui.eventLoop.scrobbleNowPlaying <- scrobble
+
+						// scrobble "submission" after song has been played long enough
+						ui.eventLoop.scrobbleListen.Start(scrobble)
 					}
 				}
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.setPlayState(statusText)
 					ui.queuePage.UpdateQueue()
+					ui.equalizerPage.SongChanged(&currentSong)
 				})
 
-			case mpvplayer.EventPaused:
+			case player.EventPaused:
 				ui.logger.Print("mpvEvent: paused")
 				statusText := "[yellow::b]Paused[::-]"
 
-				var currentSong mpvplayer.QueueItem
+				var currentSong player.QueueItem
+				var scrobble pendingScrobble
 				if mpvEvent.Data != nil {
-					currentSong = mpvEvent.Data.(mpvplayer.QueueItem) // TODO is this safe to access? maybe we need a copy
+					currentSong = mpvEvent.Data.(player.QueueItem) // TODO is this safe to access? maybe we need a copy
 					statusText += formatSongForStatusBar(&currentSong)
+					if len(ui.eventLoop.scrobbleTargets) > 0 {
+						scrobble = pendingScrobble{Track: scrobbleTrack(&currentSong), PlayedAt: time.Now()}
+					}
 				}
+				// a song restored or started paused is tracked from here on
+				ui.eventLoop.scrobbleListen.Pause(scrobble)
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.setPlayState(statusText)
 				})
 
-			case mpvplayer.EventUnpaused:
+			case player.EventUnpaused:
 				ui.logger.Print("mpvEvent: unpaused")
 				statusText := "[green::b]Playing[::-]"
 
-				var currentSong mpvplayer.QueueItem
+				var currentSong player.QueueItem
+				var scrobble pendingScrobble
 				if mpvEvent.Data != nil {
-					currentSong = mpvEvent.Data.(mpvplayer.QueueItem) // TODO is this safe to access? maybe we need a copy
+					currentSong = mpvEvent.Data.(player.QueueItem) // TODO is this safe to access? maybe we need a copy
 					statusText += formatSongForStatusBar(&currentSong)
+					if len(ui.eventLoop.scrobbleTargets) > 0 {
+						scrobble = pendingScrobble{Track: scrobbleTrack(&currentSong), PlayedAt: time.Now()}
+					}
 				}
+				// also starts tracking a song that was never reported playing
+				ui.eventLoop.scrobbleListen.Resume(scrobble)
+
+				ui.app.QueueUpdateDraw(func() {
+					ui.setPlayState(statusText)
+				})
+
+			case player.EventModes:
+				modes := mpvEvent.Data.(player.Modes)
+				ui.app.QueueUpdateDraw(func() {
+					ui.topBar.SetIndicator(IndicatorPlaybackModes, formatPlaybackModes(modes))
+					ui.queuePage.UpdateQueue()
+				})
+
+			case player.EventFailed:
+				failure := mpvEvent.Data.(player.PlaybackError)
+				ui.logger.PrintError("mpvEvent: failed to play "+failure.Item.Id, failure.Err)
+				ui.app.QueueUpdateDraw(func() {
+					ui.queuePage.UpdateQueue()
+					if failure.Stopped {
+						ui.showMessageBox(fmt.Sprintf("Playback stopped, %d songs in a row failed: %s",
+							player.MaxFailures, failure.Item.Error))
+					}
+				})
 
+			case player.EventSleep:
+				state := mpvEvent.Data.(player.SleepState)
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.topBar.SetIndicator(IndicatorSleep, formatSleepState(state))
+				})
+
+			case player.EventMetadata:
+				ui.logger.Printf("mpvEvent: stream tags %v", mpvEvent.Data)
+
+			case player.EventAudioParams:
+				params := mpvEvent.Data.(player.AudioParams)
+				ui.app.QueueUpdateDraw(func() {
+					ui.audioParams = params
+					if ui.playState != "" {
+						ui.setPlayState(ui.playState)
+					}
+				})
+
+			case player.EventCache:
+				cache := mpvEvent.Data.(player.CacheState)
+				ui.app.QueueUpdateDraw(func() {
+					ui.progressBar.SetCache(cache)
 				})
 
 			default:
@@ -147,32 +255,180 @@ func (ui *Ui) guiEventLoop() {
 	}
 }
 
+// setPlayState shows text about the playing song in the top bar, followed by
+// the format mpv decodes it to.
+// must be called from the tview goroutine
+func (ui *Ui) setPlayState(text string) {
+	ui.playState = text
+	ui.startStopStatus.SetText(text + formatAudioParams(ui.audioParams))
+}
+
+// RefreshNowPlaying requests an update of the now playing page without waiting
+// for the next periodic refresh
+func (el *eventLoop) RefreshNowPlaying() {
+	select {
+	case el.refreshNowPlaying <- struct{}{}:
+	default:
+		// refresh already pending
+	}
+}
+
+// StartScan requests a library scan on the server, musicFolderId is the
+// selected music folder whose artists are shown when the scan is done
+func (el *eventLoop) StartScan(musicFolderId string) {
+	select {
+	case el.startScan <- musicFolderId:
+	default:
+		// scan request already pending
+	}
+}
+
 // loop for blocking background tasks that would otherwise block the ui
 func (ui *Ui) backgroundEventLoop() {
+	// scrobbles that failed in previous sessions are sent first
+	for _, target := range ui.eventLoop.scrobbleTargets {
+		queue, err := loadScrobbleQueue(target.queueKey)
+		if err != nil {
+			ui.logger.PrintError("loadScrobbleQueue", err)
+		}
+		target.queue = queue
+	}
+	ui.flushScrobbles()
+
+	// the connection's music folder belongs to the ui goroutine
+	scanFolderId := ""
+
 	for {
 		select {
-		case songId := <-ui.eventLoop.scrobbleNowPlaying:
-			// scrobble now playing
-			if _, err := ui.connection.ScrobbleSubmission(songId, false); err != nil {
-				ui.logger.PrintError("scrobble nowplaying", err)
+		case <-ui.eventLoop.nowPlayingTicker.C:
+			ui.updateNowPlaying()
+
+		case <-ui.eventLoop.refreshNowPlaying:
+			ui.updateNowPlaying()
+
+		case scanFolderId = <-ui.eventLoop.startScan:
+			if response, err := ui.connection.StartScan(); err != nil {
+				ui.logger.PrintError("StartScan", err)
+			} else if response.Status != "ok" {
+				ui.logger.PrintError("StartScan", errors.New(response.Error.Message))
+			} else {
+				ui.logger.Print("library scan started")
+				ui.updateScanStatus(response.ScanStatus)
+				ui.eventLoop.scanStatusTimer.Reset(scanStatusInterval)
+			}
+
+		case <-ui.eventLoop.scanStatusTimer.C:
+			response, err := ui.connection.GetScanStatus()
+			if err != nil {
+				// try again later, the server might be busy scanning
+				ui.logger.PrintError("GetScanStatus", err)
+				ui.eventLoop.scanStatusTimer.Reset(scanStatusInterval)
+				continue
 			}
 
-		case <-ui.eventLoop.scrobbleSubmissionTimer.C:
-			// scrobble submission delay elapsed
-			if currentSong, err := ui.player.GetPlayingTrack(); err != nil {
-				// user paused/stopped
-				ui.logger.Printf("not scrobbling: %v", err)
+			ui.updateScanStatus(response.ScanStatus)
+			if response.ScanStatus.Scanning {
+				ui.eventLoop.scanStatusTimer.Reset(scanStatusInterval)
 			} else {
-				// it's still playing
-				ui.logger.Printf("scrobbling: %s", currentSong.Id)
-				if _, err := ui.connection.ScrobbleSubmission(currentSong.Id, true); err != nil {
-					ui.logger.PrintError("scrobble submission", err)
+				ui.logger.Printf("library scan finished: %d items", response.ScanStatus.Count)
+				// fetched here so that a slow server doesn't block the ui
+				folderId := scanFolderId
+				indexResponse, err := ui.connection.GetIndexesOf(folderId)
+				if err != nil {
+					ui.logger.PrintError("GetIndexes", err)
+					continue
 				}
+				ui.app.QueueUpdateDraw(func() {
+					if folderId != ui.connection.MusicFolderId {
+						// another folder was selected during the scan
+						if err := ui.browserPage.UpdateArtists(); err != nil {
+							ui.logger.PrintError("UpdateArtists", err)
+						}
+						return
+					}
+					ui.browserPage.showArtists(indexResponse.Indexes.Index)
+				})
 			}
+
+		case nowPlaying := <-ui.eventLoop.scrobbleNowPlaying:
+			// scrobble now playing, this isn't retried as it's outdated soon
+			for _, target := range ui.eventLoop.scrobbleTargets {
+				if err := target.target.NowPlaying(nowPlaying.Track); err != nil {
+					ui.logger.PrintError("scrobble nowplaying "+target.target.Name(), err)
+				}
+			}
+
+		case scrobble := <-ui.eventLoop.scrobbleSubmission:
+			ui.logger.Printf("scrobbling: %s", scrobble.Id)
+			for _, target := range ui.eventLoop.scrobbleTargets {
+				if err := target.queue.Add(scrobble); err != nil {
+					ui.logger.PrintError("scrobble queue "+target.target.Name(), err)
+				}
+			}
+			ui.flushScrobbles()
+
+		case <-ui.eventLoop.scrobbleRetryTimer.C:
+			ui.flushScrobbles()
 		}
 	}
 }
 
+// submit pending scrobbles of all targets, accessed from background context
+func (ui *Ui) flushScrobbles() {
+	pending := 0
+	for _, target := range ui.eventLoop.scrobbleTargets {
+		name := target.target.Name()
+		err := target.queue.Flush(func(scrobble pendingScrobble) error {
+			err := target.target.Submit(scrobble.Track, scrobble.PlayedAt)
+			if errors.Is(err, scrobbler.ErrRejected) {
+				ui.logger.Printf("scrobble of %s to %s dropped: %v", scrobble.Id, name, err)
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			ui.logger.PrintError("scrobble submission "+name, err)
+		}
+		pending += target.queue.Len()
+	}
+
+	if pending > 0 {
+		ui.logger.Printf("scrobbles pending: %d, retrying in %v", pending, scrobbleRetryInterval)
+		ui.eventLoop.scrobbleRetryTimer.Reset(scrobbleRetryInterval)
+	}
+
+	text := formatPendingScrobbles(pending)
+	ui.app.QueueUpdateDraw(func() {
+		ui.topBar.SetIndicator(IndicatorScrobbles, text)
+	})
+}
+
+// fetch what other users are playing, accessed from background context
+func (ui *Ui) updateNowPlaying() {
+	response, err := ui.connection.GetNowPlaying()
+	if err != nil {
+		ui.logger.PrintError("GetNowPlaying", err)
+		return
+	}
+
+	entries := response.NowPlaying.Entries
+	ui.app.QueueUpdateDraw(func() {
+		ui.nowPlayingPage.UpdateNowPlaying(entries)
+	})
+}
+
+// show scan progress in the top bar, accessed from background context
+func (ui *Ui) updateScanStatus(status subsonic.SubsonicScanStatus) {
+	text := ""
+	if status.Scanning {
+		text = fmt.Sprintf("[yellow]scanning: %d[::-]", status.Count)
+	}
+
+	ui.app.QueueUpdateDraw(func() {
+		ui.topBar.SetIndicator(IndicatorScan, text)
+	})
+}
+
 func (ui *Ui) addStarredToList() {
 	response, err := ui.connection.GetStarred()
 	if err != nil {
@@ -0,0 +1,67 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package fakeplayer
+
+import "github.com/spezifisch/stmps/player"
+
+// must be called with mutex held
+func (p *Player) sendGuiEvent(typ player.UiEventType) {
+	p.sendGuiDataEvent(typ, nil)
+}
+
+// sendGuiDataEvent queues an event, it's sent when the mutex is released.
+// must be called with mutex held
+func (p *Player) sendGuiDataEvent(typ player.UiEventType, data interface{}) {
+	p.pendingEvents = append(p.pendingEvents, player.UiEvent{
+		Type: typ,
+		Data: data,
+	})
+}
+
+// dispatchEvent sends an event to the gui and the remote callbacks.
+// must be called without holding the mutex
+func (p *Player) dispatchEvent(event player.UiEvent) {
+	if p.eventConsumer != nil {
+		p.eventConsumer.SendEvent(event)
+	}
+
+	switch event.Type {
+	case player.EventStopped:
+		for _, cb := range p.cbOnStopped {
+			cb()
+		}
+
+	case player.EventUnpaused, player.EventPlaying:
+		if event.Data != nil {
+			p.sendSongChange(event.Data.(player.QueueItem))
+		}
+		for _, cb := range p.cbOnPlaying {
+			cb()
+		}
+
+	case player.EventPaused:
+		if event.Data != nil {
+			p.sendSongChange(event.Data.(player.QueueItem))
+		}
+		for _, cb := range p.cbOnPaused {
+			cb()
+		}
+
+	case player.EventSeeked:
+		for _, cb := range p.cbOnSeek {
+			cb()
+		}
+
+	case player.EventModes:
+		for _, cb := range p.cbOnModeChange {
+			cb()
+		}
+	}
+}
+
+func (p *Player) sendSongChange(track player.QueueItem) {
+	for _, cb := range p.cbOnSongChange {
+		cb(&track)
+	}
+}
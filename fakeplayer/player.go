@@ -0,0 +1,723 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package fakeplayer
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+)
+
+// how often the playback position advances and is reported
+const tickInterval = time.Second
+
+// songs without a known duration are played this many seconds
+const defaultDuration = 180
+
+// Player pretends to play the queue without producing any sound. The position
+// advances in real time and songs end after their duration. It is used in
+// demo mode and to test the ui without libmpv. The queue is played like mpv
+// plays it, shuffle and repeat included.
+type Player struct {
+	eventConsumer player.EventConsumer
+	logger        logger.LoggerInterface
+
+	// guards everything below, commands come from the gui and remote contexts
+	// while the event loop advances the position
+	mutex sync.Mutex
+
+	queue    player.Queue
+	stopped  bool
+	paused   bool
+	position float64
+	volume   int
+
+	speed       float64
+	replayGain  player.ReplayGain
+	equalizer   player.Equalizer
+	audioDevice string
+
+	// the sleep timer counts down while the time passes in Advance. There's
+	// nothing to fade out.
+	sleepRemaining   time.Duration
+	sleepEndOfAlbum  bool
+	stopAfterCurrent bool
+	// sleep state as last sent to the gui
+	sleep player.SleepState
+
+	// events to send once the mutex is released
+	pendingEvents []player.UiEvent
+
+	quit chan struct{}
+
+	// callbacks
+	cbOnPaused     []func()
+	cbOnStopped    []func()
+	cbOnPlaying    []func()
+	cbOnSeek       []func()
+	cbOnSongChange []func(remote.TrackInterface)
+	cbOnModeChange []func()
+}
+
+var _ player.PlayerInterface = (*Player)(nil)
+
+// devices offered by GetAudioDevices, like mpv without a sound server
+var audioDevices = []player.AudioDevice{
+	{Name: "auto", Description: "Autoselect device"},
+	{Name: "null", Description: "Null audio output"},
+}
+
+func NewPlayer(logger logger.LoggerInterface) *Player {
+	return &Player{
+		eventConsumer: nil, // must be set by calling RegisterEventConsumer()
+		logger:        logger,
+		queue:         player.NewQueue(),
+		stopped:       true,
+		volume:        100,
+		speed:         1,
+		audioDevice:   "auto",
+		quit:          make(chan struct{}),
+	}
+}
+
+func (p *Player) RegisterEventConsumer(consumer player.EventConsumer) {
+	p.eventConsumer = consumer
+}
+
+// EventLoop advances the playback position until Quit() is called
+func (p *Player) EventLoop() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			p.Advance(tickInterval)
+		}
+	}
+}
+
+func (p *Player) Quit() {
+	close(p.quit)
+}
+
+// Advance plays the current song for the given time, as if that time passed.
+// The song ends if it reaches its duration.
+func (p *Player) Advance(elapsed time.Duration) {
+	p.mutex.Lock()
+	defer p.unlock()
+	defer p.sendSleepState()
+
+	if p.sleepRemaining > 0 {
+		p.sleepRemaining -= elapsed
+		if p.sleepRemaining <= 0 {
+			p.sleepRemaining = 0
+			if !p.stopped {
+				p.stop()
+			}
+			return
+		}
+	}
+
+	item, ok := p.queue.Current()
+	if !ok || p.stopped || p.paused {
+		return
+	}
+
+	p.position += elapsed.Seconds() * p.speed
+	if p.position < float64(duration(item)) {
+		p.sendGuiDataEvent(player.EventPosition, p.status())
+		return
+	}
+
+	// the song ended
+	stop := p.stopsAfterCurrent()
+	p.queue.Advance(true)
+	if stop {
+		p.stopAfterCurrent = false
+		p.sleepEndOfAlbum = false
+		p.stop()
+		return
+	}
+	p.start()
+}
+
+// unlock releases the mutex and sends the events that were queued while it
+// was held, so that consumers can call back into the player
+func (p *Player) unlock() {
+	events := p.pendingEvents
+	p.pendingEvents = nil
+	p.mutex.Unlock()
+
+	for _, event := range events {
+		p.dispatchEvent(event)
+	}
+}
+
+func duration(item player.QueueItem) int {
+	if item.Duration <= 0 {
+		return defaultDuration
+	}
+	return item.Duration
+}
+
+// start plays the current song from the beginning.
+// must be called with mutex held
+func (p *Player) start() {
+	item, ok := p.queue.Current()
+	if !ok {
+		p.stop()
+		return
+	}
+	p.stopped = false
+	p.paused = false
+	p.position = 0
+	p.sendGuiDataEvent(player.EventPlaying, item)
+}
+
+// must be called with mutex held
+func (p *Player) stop() {
+	p.stopped = true
+	p.paused = false
+	p.position = 0
+	p.sendGuiEvent(player.EventStopped)
+}
+
+// must be called with mutex held
+func (p *Player) status() player.StatusData {
+	item, _ := p.queue.Current()
+	return player.StatusData{
+		Volume:   int64(p.volume),
+		Position: int64(p.position),
+		Duration: int64(item.Duration),
+	}
+}
+
+func (p *Player) PlayNextTrack() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.Advance(false)
+	p.start()
+	return nil
+}
+
+func (p *Player) PlayUri(item *player.QueueItem) error {
+	return p.PlayItems(player.PlayerQueue{*item})
+}
+
+// PlayItems replaces the songs after the current one with items and plays the
+// first of them. Played songs stay in the queue.
+func (p *Player) PlayItems(items player.PlayerQueue) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.ReplaceUpcoming(items...)
+	p.start()
+	return nil
+}
+
+func (p *Player) PlayQueueItem(index int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if _, ok := p.queue.Item(index); !ok {
+		return errors.New("invalid queue entry")
+	}
+	p.queue.JumpTo(index)
+	p.start()
+	return nil
+}
+
+func (p *Player) Stop() error {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.stop()
+	return nil
+}
+
+func (p *Player) IsSeeking() (bool, error) {
+	return false, nil
+}
+
+func (p *Player) IsPaused() (bool, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.paused, nil
+}
+
+func (p *Player) IsPlaying() (bool, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+	_, ok := p.queue.Current()
+	return ok && !p.stopped && !p.paused, nil
+}
+
+// Pause toggles playing music. If stopped, the current song starts playing.
+func (p *Player) Pause() error {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.pause()
+	return nil
+}
+
+// must be called with mutex held
+func (p *Player) pause() {
+	item, ok := p.queue.Current()
+	switch {
+	case !ok:
+		p.stop()
+	case p.stopped:
+		p.start()
+	case p.paused:
+		p.paused = false
+		p.sendGuiDataEvent(player.EventUnpaused, item)
+	default:
+		p.paused = true
+		p.sendGuiDataEvent(player.EventPaused, item)
+	}
+}
+
+func (p *Player) Play() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if _, ok := p.queue.Current(); !ok || p.stopped || p.paused {
+		p.pause()
+	}
+	return nil
+}
+
+func (p *Player) NextTrack() error {
+	return p.PlayNextTrack()
+}
+
+// PreviousTrack restarts the current song if it played for more than
+// RestartThreshold seconds, otherwise it goes back to the previous song
+func (p *Player) PreviousTrack() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	_, hasCurrent := p.queue.Current()
+	restart := hasCurrent && p.position > player.RestartThreshold
+	if !restart && !p.queue.Previous() {
+		// at the first song
+		restart = true
+	}
+	if restart && !p.stopped {
+		p.seekTo(0)
+		return nil
+	}
+	p.start()
+	return nil
+}
+
+func (p *Player) GetTimePos() float64 {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.position
+}
+
+func (p *Player) Seek(increment int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.seekTo(p.position + float64(increment))
+	return nil
+}
+
+func (p *Player) SeekAbsolute(position float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.seekTo(position)
+	return nil
+}
+
+func (p *Player) SeekPercent(percent float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	item, _ := p.queue.Current()
+	p.seekTo(float64(duration(item)) * math.Max(0, math.Min(percent, 100)) / 100)
+	return nil
+}
+
+// must be called with mutex held
+func (p *Player) seekTo(position float64) {
+	item, ok := p.queue.Current()
+	if !ok || p.stopped {
+		// nothing to seek in
+		return
+	}
+	p.position = math.Max(0, math.Min(position, float64(duration(item))))
+	p.sendGuiDataEvent(player.EventSeeked, p.status())
+}
+
+func (p *Player) SetVolume(percentValue int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.volume = int(math.Max(0, math.Min(float64(percentValue), 100)))
+	p.sendGuiDataEvent(player.EventVolume, p.status())
+	return nil
+}
+
+func (p *Player) GetVolume() int {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.volume
+}
+
+func (p *Player) AdjustVolume(increment int) error {
+	p.mutex.Lock()
+	volume := p.volume
+	p.mutex.Unlock()
+	return p.SetVolume(volume + increment)
+}
+
+func (p *Player) GetModes() player.Modes {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.modes()
+}
+
+// must be called with mutex held
+func (p *Player) modes() player.Modes {
+	return player.Modes{
+		Shuffle:    p.queue.Shuffle(),
+		Repeat:     p.queue.Repeat(),
+		ReplayGain: p.replayGain.Mode,
+		Speed:      p.speed,
+	}
+}
+
+// must be called with mutex held
+func (p *Player) sendModes() {
+	p.sendGuiDataEvent(player.EventModes, p.modes())
+}
+
+func (p *Player) GetShuffle() bool {
+	return p.GetModes().Shuffle
+}
+
+// SetShuffle plays the upcoming songs in random order, without changing the
+// order of the queue
+func (p *Player) SetShuffle(shuffle bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if shuffle != p.queue.Shuffle() {
+		p.queue.SetShuffle(shuffle)
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetRepeat() remote.RepeatMode {
+	return p.GetModes().Repeat
+}
+
+func (p *Player) SetRepeat(mode remote.RepeatMode) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if mode != p.queue.Repeat() {
+		p.queue.SetRepeat(mode)
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetSpeed() float64 {
+	return p.GetModes().Speed
+}
+
+func (p *Player) SetSpeed(speed float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	speed = math.Max(remote.MinSpeed, math.Min(speed, remote.MaxSpeed))
+	if speed != p.speed {
+		p.speed = speed
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetReplayGain() player.ReplayGain {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.replayGain
+}
+
+func (p *Player) SetReplayGain(settings player.ReplayGain) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	changed := settings.Mode != p.replayGain.Mode
+	p.replayGain = settings
+	if changed {
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetEqualizer() player.Equalizer {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.equalizer
+}
+
+func (p *Player) SetEqualizer(equalizer player.Equalizer) error {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.equalizer = equalizer.Clamp()
+	return nil
+}
+
+func (p *Player) GetAudioDevices() ([]player.AudioDevice, error) {
+	devices := make([]player.AudioDevice, len(audioDevices))
+	copy(devices, audioDevices)
+	return devices, nil
+}
+
+func (p *Player) GetAudioDevice() (string, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.audioDevice, nil
+}
+
+func (p *Player) SetAudioDevice(name string, exclusive bool) error {
+	for _, device := range audioDevices {
+		if device.Name == name {
+			p.mutex.Lock()
+			p.audioDevice = name
+			p.mutex.Unlock()
+			return nil
+		}
+	}
+	return errors.New("unknown audio device")
+}
+
+// LoadQueue replaces the queue and pauses the song at current at position
+// seconds. When shuffling the songs marked in played were played, otherwise
+// the songs before current.
+func (p *Player) LoadQueue(items player.PlayerQueue, current int, played []bool, position float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.Restore(items, current, played)
+	item, ok := p.queue.Current()
+	if !ok {
+		p.stop()
+		return nil
+	}
+	p.stopped = false
+	p.paused = true
+	p.position = math.Max(0, math.Min(position, float64(duration(item))))
+	p.sendGuiDataEvent(player.EventPaused, item)
+	return nil
+}
+
+func (p *Player) GetSleepState() player.SleepState {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.sleepState()
+}
+
+func (p *Player) SetSleepTimer(duration time.Duration) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.sleepEndOfAlbum = false
+	p.sleepRemaining = 0
+	if duration > 0 {
+		p.sleepRemaining = duration
+	}
+	p.sendSleepState()
+	return nil
+}
+
+func (p *Player) SetSleepAtEndOfAlbum() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.sleepRemaining = 0
+	p.sleepEndOfAlbum = true
+	p.sendSleepState()
+	return nil
+}
+
+func (p *Player) SetStopAfterCurrent(stop bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.stopAfterCurrent = stop
+	p.sendSleepState()
+	return nil
+}
+
+// must be called with mutex held
+func (p *Player) sleepState() player.SleepState {
+	state := player.SleepState{
+		Remaining:        p.sleepRemaining,
+		EndOfAlbum:       p.sleepEndOfAlbum,
+		StopAfterCurrent: p.stopAfterCurrent,
+	}
+	if item, ok := p.queue.Current(); ok && p.sleepEndOfAlbum {
+		// the rest of the current song and the following songs of its album
+		seconds := math.Max(0, float64(duration(item))-p.position)
+		for position := p.queue.Position() + 1; item.AlbumId != ""; position++ {
+			next, ok := p.queue.At(position)
+			if !ok || next.AlbumId != item.AlbumId {
+				break
+			}
+			seconds += float64(duration(next))
+		}
+		state.Remaining = time.Duration(seconds / p.speed * float64(time.Second))
+	}
+	state.Remaining = state.Remaining.Round(time.Second)
+	return state
+}
+
+// stopsAfterCurrent returns true if playback stops when the current song ends
+// must be called with mutex held
+func (p *Player) stopsAfterCurrent() bool {
+	if p.stopAfterCurrent {
+		return true
+	}
+	if !p.sleepEndOfAlbum {
+		return false
+	}
+	current, _ := p.queue.Current()
+	next, ok := p.queue.Next(true)
+	return !ok || current.AlbumId == "" || next.AlbumId != current.AlbumId
+}
+
+// must be called with mutex held
+func (p *Player) sendSleepState() {
+	if state := p.sleepState(); state != p.sleep {
+		p.sleep = state
+		p.sendGuiDataEvent(player.EventSleep, state)
+	}
+}
+
+func (p *Player) ClearQueue() {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.stop()
+	p.queue.Clear()
+}
+
+func (p *Player) DeleteQueueItem(index int) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if index < 0 || index >= p.queue.Len() {
+		p.logger.Printf("DeleteQueueItem bad index %d (len %d)", index, p.queue.Len())
+		return
+	}
+
+	if p.queue.Remove(index) && !p.stopped {
+		// the current song, continue with the next one
+		p.start()
+	}
+}
+
+func (p *Player) AddToQueue(item *player.QueueItem) {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.queue.Add(*item)
+}
+
+// InsertNext adds item to the queue right after the current song
+func (p *Player) InsertNext(item *player.QueueItem) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.InsertNext(*item)
+}
+
+// MoveQueueItem moves the song at index from to index to. The current song
+// keeps playing.
+func (p *Player) MoveQueueItem(from, to int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if from < 0 || from >= p.queue.Len() || to < 0 || to >= p.queue.Len() {
+		return errors.New("invalid queue entry")
+	}
+	p.queue.Move(from, to)
+	return nil
+}
+
+func (p *Player) GetQueueItem(index int) (player.QueueItem, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	item, ok := p.queue.Item(index)
+	if !ok {
+		return player.QueueItem{}, errors.New("invalid queue entry")
+	}
+	return item, nil
+}
+
+// GetQueueCopy returns the queue including the played songs, the index of the
+// current song, len(queue) if there is none, and which songs were played. The
+// order differs from the play order when shuffling.
+func (p *Player) GetQueueCopy() (queue player.PlayerQueue, current int, played []bool) {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.queue.Items(), p.queue.CurrentIndex(), p.queue.Played()
+}
+
+func (p *Player) GetPlayingTrack() (player.QueueItem, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	item, ok := p.queue.Current()
+	if !ok {
+		return player.QueueItem{}, errors.New("queue empty")
+	}
+	if p.stopped || p.paused {
+		return player.QueueItem{}, errors.New("not playing")
+	}
+	return item, nil
+}
+
+// remote.ControlledPlayer callbacks
+func (p *Player) OnPaused(cb func()) {
+	p.cbOnPaused = append(p.cbOnPaused, cb)
+}
+
+func (p *Player) OnStopped(cb func()) {
+	p.cbOnStopped = append(p.cbOnStopped, cb)
+}
+
+func (p *Player) OnPlaying(cb func()) {
+	p.cbOnPlaying = append(p.cbOnPlaying, cb)
+}
+
+func (p *Player) OnSeek(cb func()) {
+	p.cbOnSeek = append(p.cbOnSeek, cb)
+}
+
+func (p *Player) OnSongChange(cb func(track remote.TrackInterface)) {
+	p.cbOnSongChange = append(p.cbOnSongChange, cb)
+}
+
+func (p *Player) OnModeChange(cb func()) {
+	p.cbOnModeChange = append(p.cbOnModeChange, cb)
+}
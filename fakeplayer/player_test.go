@@ -0,0 +1,261 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package fakeplayer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Print(s string) {
+	l.t.Log(s)
+}
+
+func (l testLogger) Printf(s string, as ...interface{}) {
+	l.t.Logf(s, as...)
+}
+
+func (l testLogger) PrintError(source string, err error) {
+	l.t.Logf("Error(%s) -> %s", source, err)
+}
+
+// eventRecorder keeps the events except status updates. Events are sent
+// synchronously, so no waiting is needed.
+type eventRecorder struct {
+	player *Player
+	events []player.UiEvent
+}
+
+func (r *eventRecorder) SendEvent(event player.UiEvent) {
+	// consumers may call back into the player
+	r.player.GetQueueCopy()
+	if event.Type != player.EventPosition {
+		r.events = append(r.events, event)
+	}
+}
+
+func (r *eventRecorder) take() []player.UiEventType {
+	types := make([]player.UiEventType, len(r.events))
+	for i, event := range r.events {
+		types[i] = event.Type
+	}
+	r.events = nil
+	return types
+}
+
+func newTestPlayer(t *testing.T) (*Player, *eventRecorder) {
+	p := NewPlayer(testLogger{t})
+	recorder := &eventRecorder{player: p}
+	p.RegisterEventConsumer(recorder)
+	return p, recorder
+}
+
+func testQueue(ids ...string) player.PlayerQueue {
+	queue := make(player.PlayerQueue, len(ids))
+	for i, id := range ids {
+		queue[i] = player.QueueItem{Id: id, Title: id, Duration: 10}
+	}
+	return queue
+}
+
+func expectEvents(t *testing.T, recorder *eventRecorder, expected ...player.UiEventType) {
+	t.Helper()
+	events := recorder.take()
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+	for i := range events {
+		if events[i] != expected[i] {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+	}
+}
+
+func expectCurrent(t *testing.T, p *Player, id string) {
+	t.Helper()
+	track, err := p.GetPlayingTrack()
+	if err != nil {
+		t.Fatalf("expected %s playing: %v", id, err)
+	}
+	if track.Id != id {
+		t.Fatalf("expected %s playing, got %s", id, track.Id)
+	}
+}
+
+func TestPlayerAdvancesQueue(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+
+	if err := p.PlayItems(testQueue("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, recorder, player.EventPlaying)
+	expectCurrent(t, p, "a")
+
+	p.Advance(5 * time.Second)
+	if position := p.GetTimePos(); position != 5 {
+		t.Fatalf("expected position 5, got %f", position)
+	}
+	expectEvents(t, recorder)
+
+	p.Advance(5 * time.Second)
+	expectEvents(t, recorder, player.EventPlaying)
+	expectCurrent(t, p, "b")
+
+	p.Advance(10 * time.Second)
+	expectEvents(t, recorder, player.EventStopped)
+	queue, current, played := p.GetQueueCopy()
+	if len(queue) != 2 || current != 2 || !played[0] || !played[1] {
+		t.Fatalf("expected both songs played, got current %d played %v", current, played)
+	}
+}
+
+func TestPlayerRepeat(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+	_ = p.PlayItems(testQueue("a", "b"))
+
+	if err := p.SetRepeat(remote.RepeatAll); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, recorder, player.EventPlaying, player.EventModes)
+
+	p.Advance(10 * time.Second)
+	p.Advance(10 * time.Second)
+	expectCurrent(t, p, "a")
+
+	_ = p.SetRepeat(remote.RepeatOne)
+	p.Advance(10 * time.Second)
+	expectCurrent(t, p, "a")
+}
+
+func TestPlayerShuffle(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	_ = p.PlayItems(testQueue(ids...))
+
+	if err := p.SetShuffle(true); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, recorder, player.EventPlaying, player.EventModes)
+	if !p.GetModes().Shuffle {
+		t.Fatal("expected shuffle enabled")
+	}
+
+	// every song is played once, the queue keeps its order
+	seen := map[string]bool{}
+	for range ids {
+		track, err := p.GetPlayingTrack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[track.Id] {
+			t.Fatalf("%s played twice", track.Id)
+		}
+		seen[track.Id] = true
+		p.Advance(10 * time.Second)
+	}
+	if playing, _ := p.IsPlaying(); playing {
+		t.Error("expected playback stopped at the end of the queue")
+	}
+	queue, _, played := p.GetQueueCopy()
+	for i, id := range ids {
+		if queue[i].Id != id || !played[i] {
+			t.Fatalf("unexpected queue %v, played %v", queue, played)
+		}
+	}
+}
+
+func TestPlayerPause(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+	_ = p.PlayItems(testQueue("a"))
+
+	_ = p.Pause()
+	p.Advance(5 * time.Second)
+	if position := p.GetTimePos(); position != 0 {
+		t.Fatalf("paused song advanced to %f", position)
+	}
+	_ = p.Pause()
+	expectEvents(t, recorder, player.EventPlaying, player.EventPaused, player.EventUnpaused)
+}
+
+func TestPlayerMoveQueueItem(t *testing.T) {
+	p, _ := newTestPlayer(t)
+	_ = p.PlayItems(testQueue("a", "b", "c"))
+	_ = p.PlayQueueItem(1)
+
+	// move the current song to the end
+	if err := p.MoveQueueItem(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	queue, current, _ := p.GetQueueCopy()
+	if queue[0].Id != "a" || queue[1].Id != "c" || queue[2].Id != "b" || current != 2 {
+		t.Fatalf("unexpected queue after move: %v, current %d", queue, current)
+	}
+
+	// move a song from before the current song behind it
+	_ = p.MoveQueueItem(0, 2)
+	queue, current, _ = p.GetQueueCopy()
+	if queue[current].Id != "b" || current != 1 {
+		t.Fatalf("current song not followed: %v, current %d", queue, current)
+	}
+	expectCurrent(t, p, "b")
+
+	if err := p.MoveQueueItem(0, 3); err == nil {
+		t.Fatal("expected error for an invalid index")
+	}
+}
+
+func TestPlayerLoadQueue(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+
+	if err := p.LoadQueue(testQueue("a", "b"), 1, nil, 4); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, recorder, player.EventPaused)
+	if paused, _ := p.IsPaused(); !paused {
+		t.Error("expected the restored song paused")
+	}
+	if position := p.GetTimePos(); position != 4 {
+		t.Errorf("expected position 4, got %f", position)
+	}
+
+	_ = p.Pause()
+	expectCurrent(t, p, "b")
+}
+
+func TestPlayerSleep(t *testing.T) {
+	p, recorder := newTestPlayer(t)
+	queue := testQueue("a", "b", "c")
+	queue[0].AlbumId, queue[1].AlbumId, queue[2].AlbumId = "x", "x", "y"
+	_ = p.PlayItems(queue)
+
+	_ = p.SetSleepAtEndOfAlbum()
+	if state := p.GetSleepState(); state.Remaining != 20*time.Second {
+		t.Fatalf("expected 20s until the end of the album, got %+v", state)
+	}
+	p.Advance(10 * time.Second)
+	p.Advance(10 * time.Second)
+	expectEvents(t, recorder, player.EventPlaying, player.EventSleep,
+		player.EventPlaying, player.EventSleep, player.EventStopped, player.EventSleep)
+	if queue, current, _ := p.GetQueueCopy(); queue[current].Id != "c" {
+		t.Fatalf("expected the next album current, got %d", current)
+	}
+
+	_ = p.Play()
+	expectCurrent(t, p, "c")
+	_ = p.SetSleepTimer(5 * time.Second)
+	p.Advance(5 * time.Second)
+	if playing, _ := p.IsPlaying(); playing {
+		t.Error("expected playback stopped by the sleep timer")
+	}
+	if state := p.GetSleepState(); state.IsActive() {
+		t.Errorf("expected the sleep timer reset, got %+v", state)
+	}
+}
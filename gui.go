@@ -9,7 +9,7 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/logger"
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
 	"github.com/spezifisch/stmps/subsonic"
 )
 
@@ -20,7 +20,12 @@ type Ui struct {
 
 	// top bar
 	startStopStatus *tview.TextView
+	progressBar     *ProgressBar
 	playerStatus    *tview.TextView
+	topBar          *TopBar
+	// playing or paused and the song, without the audio format
+	playState   string
+	audioParams player.AudioParams
 
 	// bottom bar
 	menuWidget *MenuWidget
@@ -34,36 +39,55 @@ type Ui struct {
 	// playlist page
 	playlistPage *PlaylistPage
 
+	// now playing page
+	nowPlayingPage *NowPlayingPage
+
 	// log page
 	logPage *LogPage
 
+	// equalizer page
+	equalizerPage *EqualizerPage
+
 	// modals
 	addToPlaylistList *tview.List
-	messageBox        *tview.Modal
-	helpModal         tview.Primitive
-	helpWidget        *HelpWidget
+	seekInput         *tview.InputField
+	seekModal         tview.Primitive
+	audioDeviceList   *tview.List
+	// loaded when the picker is first shown, keeps changes to settings from
+	// the config until quit
+	audioOutput      *audioOutput
+	audioDeviceModal tview.Primitive
+	messageBox       *tview.Modal
+	helpModal        tview.Primitive
+	helpWidget       *HelpWidget
 
 	starIdList map[string]struct{}
 
 	eventLoop *eventLoop
-	mpvEvents chan mpvplayer.UiEvent
+	mpvEvents chan player.UiEvent
 
 	playlists  []subsonic.SubsonicPlaylist
 	connection *subsonic.SubsonicConnection
-	player     *mpvplayer.Player
+	player     uiPlayer
 	logger     *logger.Logger
 }
 
 const (
 	// page identifiers (use these instead of hardcoding page names for showing/hiding)
-	PageBrowser   = "browser"
-	PageQueue     = "queue"
-	PagePlaylists = "playlists"
-	PageLog       = "log"
+	PageBrowser    = "browser"
+	PageQueue      = "queue"
+	PagePlaylists  = "playlists"
+	PageLog        = "log"
+	PageNowPlaying = "nowplaying"
+	PageEqualizer  = "equalizer"
 
 	PageDeletePlaylist = "deletePlaylist"
 	PageNewPlaylist    = "newPlaylist"
 	PageAddToPlaylist  = "addToPlaylist"
+	PageMusicFolder    = "musicFolder"
+	PageSeek           = "seek"
+	PageSavePreset     = "savePreset"
+	PageAudioDevice    = "audioDevice"
 	PageMessageBox     = "messageBox"
 	PageHelpBox        = "helpBox"
 )
@@ -71,17 +95,17 @@ const (
 func InitGui(indexes *[]subsonic.SubsonicIndex,
 	playlists *[]subsonic.SubsonicPlaylist,
 	connection *subsonic.SubsonicConnection,
-	player *mpvplayer.Player,
+	musicPlayer uiPlayer,
 	logger *logger.Logger) (ui *Ui) {
 	ui = &Ui{
 		starIdList: map[string]struct{}{},
 
 		eventLoop: nil, // initialized by initEventLoops()
-		mpvEvents: make(chan mpvplayer.UiEvent, 5),
+		mpvEvents: make(chan player.UiEvent, 5),
 
 		playlists:  *playlists,
 		connection: connection,
-		player:     player,
+		player:     musicPlayer,
 		logger:     logger,
 	}
 
@@ -95,14 +119,25 @@ func InitGui(indexes *[]subsonic.SubsonicIndex,
 	ui.startStopStatus = tview.NewTextView().SetText(statusLeft).
 		SetTextAlign(tview.AlignLeft).
 		SetDynamicColors(true).
-		SetScrollable(false)
+		SetScrollable(false).
+		SetWrap(false)
 
-	statusRight := formatPlayerStatus(0, 0, 0)
+	ui.progressBar = ui.createProgressBar()
+	ui.progressBar.SetBorderPadding(0, 0, 1, 1)
+
+	statusRight := formatPlayerStatus(player.StatusData{})
 	ui.playerStatus = tview.NewTextView().SetText(statusRight).
 		SetTextAlign(tview.AlignRight).
 		SetDynamicColors(true).
 		SetScrollable(false)
 
+	// the jukebox, playback modes, sleep timer, scan and pending scrobbles
+	// are shown between the song and the progress
+	ui.topBar = ui.createTopBar(ui.startStopStatus, ui.progressBar, ui.playerStatus)
+	ui.topBar.SetIndicator(IndicatorPlayerMode, formatPlayerMode(musicPlayer.IsJukebox()))
+	ui.topBar.SetIndicator(IndicatorPlaybackModes, formatPlaybackModes(musicPlayer.GetModes()))
+	ui.topBar.SetIndicator(IndicatorSleep, formatSleepState(musicPlayer.GetSleepState()))
+
 	ui.menuWidget = ui.createMenuWidget()
 	ui.helpWidget = ui.createHelpWidget()
 
@@ -119,6 +154,24 @@ func InitGui(indexes *[]subsonic.SubsonicIndex,
 		return event
 	})
 
+	// "seek to" modal
+	ui.seekInput = tview.NewInputField().
+		SetLabel("Seek to: ").
+		SetPlaceholder("mm:ss or 50%").
+		SetFieldWidth(20)
+	seekFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(ui.seekInput, 0, 1, true)
+	seekFlex.SetTitle("Seek").
+		SetBorder(true)
+	ui.seekModal = makeModal(seekFlex, 33, 3)
+
+	// "select audio device" modal
+	ui.audioDeviceList = tview.NewList()
+	ui.audioDeviceList.SetBorder(true).
+		SetTitle("Audio Device (x: toggle exclusive)")
+	ui.audioDeviceModal = makeModal(ui.audioDeviceList, 70, 20)
+
 	// help box modal
 	ui.helpModal = makeModal(ui.helpWidget.Root, 80, 30)
 	ui.helpWidget.Root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -132,11 +185,6 @@ func InitGui(indexes *[]subsonic.SubsonicIndex,
 		return event
 	})
 
-	// top bar: status text
-	topBarFlex := tview.NewFlex().SetDirection(tview.FlexColumn).
-		AddItem(ui.startStopStatus, 0, 1, false).
-		AddItem(ui.playerStatus, 20, 0, false)
-
 	// browser page
 	ui.browserPage = ui.createBrowserPage(indexes)
 
@@ -146,22 +194,34 @@ func InitGui(indexes *[]subsonic.SubsonicIndex,
 	// playlist page
 	ui.playlistPage = ui.createPlaylistPage()
 
+	// now playing page
+	ui.nowPlayingPage = ui.createNowPlayingPage()
+
 	// log page
 	ui.logPage = ui.createLogPage()
 
+	// equalizer page
+	ui.equalizerPage = ui.createEqualizerPage()
+
 	ui.pages.AddPage(PageBrowser, ui.browserPage.Root, true, true).
 		AddPage(PageQueue, ui.queuePage.Root, true, false).
 		AddPage(PagePlaylists, ui.playlistPage.Root, true, false).
+		AddPage(PageNowPlaying, ui.nowPlayingPage.Root, true, false).
 		AddPage(PageDeletePlaylist, ui.playlistPage.DeletePlaylistModal, true, false).
 		AddPage(PageNewPlaylist, ui.playlistPage.NewPlaylistModal, true, false).
 		AddPage(PageAddToPlaylist, ui.browserPage.AddToPlaylistModal, true, false).
+		AddPage(PageMusicFolder, ui.browserPage.MusicFolderModal, true, false).
+		AddPage(PageSeek, ui.seekModal, true, false).
+		AddPage(PageSavePreset, ui.equalizerPage.SavePresetModal, true, false).
+		AddPage(PageAudioDevice, ui.audioDeviceModal, true, false).
 		AddPage(PageMessageBox, ui.messageBox, true, false).
 		AddPage(PageHelpBox, ui.helpModal, true, false).
-		AddPage(PageLog, ui.logPage.Root, true, false)
+		AddPage(PageLog, ui.logPage.Root, true, false).
+		AddPage(PageEqualizer, ui.equalizerPage.Root, true, false)
 
 	rootFlex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(topBarFlex, 1, 0, false).
+		AddItem(ui.topBar, 1, 0, false).
 		AddItem(ui.pages, 0, 1, true).
 		AddItem(ui.menuWidget.Root, 1, 0, false)
 
@@ -204,6 +264,128 @@ func (ui *Ui) CloseHelp() {
 	ui.pages.HidePage(PageHelpBox)
 }
 
+// showSeekPrompt asks for a position in the current song and seeks there
+func (ui *Ui) showSeekPrompt() {
+	previousFocus := ui.app.GetFocus()
+	closePrompt := func() {
+		ui.pages.HidePage(PageSeek)
+		ui.app.SetFocus(previousFocus)
+	}
+
+	ui.seekInput.SetText("")
+	ui.seekInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			value, percent, err := parseSeekTarget(ui.seekInput.GetText())
+			if err != nil {
+				ui.seekInput.SetText("")
+				return
+			}
+			if percent {
+				err = ui.player.SeekPercent(value)
+			} else {
+				err = ui.player.SeekAbsolute(value)
+			}
+			if err != nil {
+				ui.logger.PrintError("showSeekPrompt: Seek", err)
+			}
+		}
+		closePrompt()
+	})
+
+	ui.pages.ShowPage(PageSeek)
+	ui.pages.SendToFront(PageSeek)
+	ui.app.SetFocus(ui.seekInput)
+}
+
+// showAudioDevicePicker lists the audio outputs and switches to the selected
+// one, which is remembered for the next start
+func (ui *Ui) showAudioDevicePicker() {
+	devices, err := ui.player.GetAudioDevices()
+	if err != nil {
+		ui.logger.PrintError("GetAudioDevices", err)
+		ui.showMessageBox("Unable to list audio devices: " + err.Error())
+		return
+	}
+	if ui.audioOutput == nil {
+		output, err := loadAudioOutput()
+		if err != nil {
+			ui.logger.PrintError("loadAudioOutput", err)
+		}
+		ui.audioOutput = &output
+	}
+	output := ui.audioOutput
+	current, err := ui.player.GetAudioDevice()
+	if err != nil {
+		ui.logger.PrintError("GetAudioDevice", err)
+	}
+
+	// the secondary text shows the device name and the mode
+	deviceText := func(device player.AudioDevice) string {
+		text := tview.Escape(device.Name)
+		if output.IsExclusive(device.Name) {
+			text += " (exclusive)"
+		}
+		return text
+	}
+	title := "Audio Device (x: toggle exclusive)"
+	if source := output.source(); source != "" {
+		title += " - " + source
+	}
+	ui.audioDeviceList.SetTitle(title)
+	ui.audioDeviceList.Clear()
+	for i, device := range devices {
+		ui.audioDeviceList.AddItem(tview.Escape(device.Description), deviceText(device), 0, nil)
+		if device.Name == current {
+			ui.audioDeviceList.SetCurrentItem(i)
+		}
+	}
+
+	previousFocus := ui.app.GetFocus()
+	closePicker := func() {
+		ui.pages.HidePage(PageAudioDevice)
+		ui.app.SetFocus(previousFocus)
+	}
+	selectDevice := func(device player.AudioDevice) {
+		if err := ui.player.SetAudioDevice(device.Name, output.IsExclusive(device.Name)); err != nil {
+			ui.logger.PrintError("SetAudioDevice", err)
+			ui.showMessageBox("Unable to switch the audio device: " + err.Error())
+			return
+		}
+		output.Device = device.Name
+		if err := saveAudioOutput(*output); err != nil {
+			ui.logger.PrintError("saveAudioOutput", err)
+		}
+	}
+
+	ui.audioDeviceList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		index := ui.audioDeviceList.GetCurrentItem()
+		if event.Key() == tcell.KeyEscape {
+			closePicker()
+			return nil
+		} else if event.Key() == tcell.KeyEnter && index >= 0 && index < len(devices) {
+			closePicker()
+			selectDevice(devices[index])
+			return nil
+		} else if event.Rune() == 'x' && index >= 0 && index < len(devices) {
+			device := devices[index]
+			output.SetExclusive(device.Name, !output.IsExclusive(device.Name))
+			ui.audioDeviceList.SetItemText(index, tview.Escape(device.Description), deviceText(device))
+			if device.Name == output.Device {
+				// reopen the device in the new mode
+				selectDevice(device)
+			} else if err := saveAudioOutput(*output); err != nil {
+				ui.logger.PrintError("saveAudioOutput", err)
+			}
+			return nil
+		}
+		return event
+	})
+
+	ui.pages.ShowPage(PageAudioDevice)
+	ui.pages.SendToFront(PageAudioDevice)
+	ui.app.SetFocus(ui.audioDeviceList)
+}
+
 func (ui *Ui) showMessageBox(text string) {
 	ui.pages.ShowPage(PageMessageBox)
 	ui.messageBox.SetText(text)
@@ -4,15 +4,19 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gdamore/tcell/v2"
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/subsonic"
 )
 
 func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 	// we don't want any of these firing if we're trying to add a new playlist
 	focused := ui.app.GetFocus()
-	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) {
+	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) || focused == ui.seekInput ||
+		ui.equalizerPage.IsPresetNameInputFocused(focused) {
 		return event
 	}
 
@@ -29,6 +33,12 @@ func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 	case '4':
 		ui.ShowPage(PageLog)
 
+	case '5':
+		ui.ShowPage(PageNowPlaying)
+
+	case '6':
+		ui.ShowPage(PageEqualizer)
+
 	case '?':
 		ui.ShowHelp()
 
@@ -39,6 +49,51 @@ func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 		// add random songs to queue
 		ui.handleAddRandomSongs()
 
+	case 'J':
+		// toggle between local playback and the server's jukebox
+		ui.handleToggleJukebox()
+		return nil
+
+	case 'S':
+		// toggle shuffle
+		ui.handleToggleShuffle()
+		return nil
+
+	case 'L':
+		// cycle repeat modes
+		ui.handleCycleRepeat()
+		return nil
+
+	case 'V':
+		// cycle volume normalisation modes
+		ui.handleCycleReplayGain()
+		return nil
+
+	case 'z':
+		// cycle sleep timer
+		ui.handleCycleSleepTimer()
+		return nil
+
+	case 'Z':
+		// toggle stop after the current song
+		ui.handleToggleStopAfterCurrent()
+		return nil
+
+	case '{':
+		// slower
+		ui.handleAdjustSpeed(-0.25)
+		return nil
+
+	case '}':
+		// faster
+		ui.handleAdjustSpeed(0.25)
+		return nil
+
+	case 'U':
+		// rescan library on server
+		ui.eventLoop.StartScan(ui.connection.MusicFolderId)
+		return nil
+
 	case 'D':
 		// clear queue and stop playing
 		ui.player.ClearQueue()
@@ -96,12 +151,29 @@ func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 		}
 		return nil
 
+	case 'T':
+		// seek to a position typed in
+		ui.showSeekPrompt()
+		return nil
+
+	case 'O':
+		// pick the audio output
+		ui.showAudioDevicePicker()
+		return nil
+
 	case '>':
 		// skip to next track
 		if err := ui.player.PlayNextTrack(); err != nil {
 			ui.logger.PrintError("handlePageInput: Next", err)
 		}
 		ui.queuePage.UpdateQueue()
+
+	case '<':
+		// restart track or go back to previous track
+		if err := ui.player.PreviousTrack(); err != nil {
+			ui.logger.PrintError("handlePageInput: Previous", err)
+		}
+		ui.queuePage.UpdateQueue()
 	}
 
 	return event
@@ -110,6 +182,10 @@ func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 func (ui *Ui) ShowPage(name string) {
 	ui.pages.SwitchToPage(name)
 	ui.menuWidget.SetActivePage(name)
+
+	if name == PageNowPlaying {
+		ui.eventLoop.RefreshNowPlaying()
+	}
 }
 
 func (ui *Ui) Quit() {
@@ -117,6 +193,97 @@ func (ui *Ui) Quit() {
 	ui.app.Stop()
 }
 
+func (ui *Ui) handleToggleJukebox() {
+	if err := ui.player.SetJukebox(!ui.player.IsJukebox()); err != nil {
+		ui.logger.PrintError("SetJukebox", err)
+		ui.showMessageBox("Unable to control the server's jukebox: " + err.Error())
+		return
+	}
+
+	ui.topBar.SetIndicator(IndicatorPlayerMode, formatPlayerMode(ui.player.IsJukebox()))
+	ui.topBar.SetIndicator(IndicatorPlaybackModes, formatPlaybackModes(ui.player.GetModes()))
+	ui.topBar.SetIndicator(IndicatorSleep, formatSleepState(ui.player.GetSleepState()))
+	ui.queuePage.UpdateQueue()
+}
+
+func (ui *Ui) handleToggleShuffle() {
+	if err := ui.player.SetShuffle(!ui.player.GetShuffle()); err != nil {
+		ui.logger.PrintError("SetShuffle", err)
+		ui.showMessageBox("Unable to shuffle: " + err.Error())
+	}
+}
+
+// handleCycleRepeat switches through repeat off, all and one
+func (ui *Ui) handleCycleRepeat() {
+	next := map[remote.RepeatMode]remote.RepeatMode{
+		remote.RepeatOff: remote.RepeatAll,
+		remote.RepeatAll: remote.RepeatOne,
+		remote.RepeatOne: remote.RepeatOff,
+	}
+	if err := ui.player.SetRepeat(next[ui.player.GetRepeat()]); err != nil {
+		ui.logger.PrintError("SetRepeat", err)
+		ui.showMessageBox("Unable to repeat: " + err.Error())
+	}
+}
+
+// handleAdjustSpeed changes the playback speed by delta
+func (ui *Ui) handleAdjustSpeed(delta float64) {
+	if err := ui.player.SetSpeed(ui.player.GetSpeed() + delta); err != nil {
+		ui.logger.PrintError("SetSpeed", err)
+		ui.showMessageBox("Unable to change the speed: " + err.Error())
+	}
+}
+
+// handleCycleReplayGain switches through ReplayGain off, track and album
+func (ui *Ui) handleCycleReplayGain() {
+	next := map[player.ReplayGainMode]player.ReplayGainMode{
+		player.ReplayGainOff:   player.ReplayGainTrack,
+		player.ReplayGainTrack: player.ReplayGainAlbum,
+		player.ReplayGainAlbum: player.ReplayGainOff,
+	}
+	settings := ui.player.GetReplayGain()
+	settings.Mode = next[settings.Mode]
+	if err := ui.player.SetReplayGain(settings); err != nil {
+		ui.logger.PrintError("SetReplayGain", err)
+		ui.showMessageBox("Unable to change ReplayGain: " + err.Error())
+	}
+}
+
+// sleepTimerSteps are the sleep timer durations cycled through with 'z',
+// followed by the end of the album and off
+var sleepTimerSteps = []time.Duration{15 * time.Minute, 30 * time.Minute, 60 * time.Minute}
+
+// handleCycleSleepTimer switches the sleep timer to the next longer duration,
+// then to the end of the album and off
+func (ui *Ui) handleCycleSleepTimer() {
+	state := ui.player.GetSleepState()
+
+	var err error
+	if state.EndOfAlbum {
+		err = ui.player.SetSleepTimer(0)
+	} else {
+		err = ui.player.SetSleepAtEndOfAlbum()
+		for _, duration := range sleepTimerSteps {
+			if duration > state.Remaining {
+				err = ui.player.SetSleepTimer(duration)
+				break
+			}
+		}
+	}
+	if err != nil {
+		ui.logger.PrintError("SetSleepTimer", err)
+		ui.showMessageBox("Unable to set the sleep timer: " + err.Error())
+	}
+}
+
+func (ui *Ui) handleToggleStopAfterCurrent() {
+	stop := !ui.player.GetSleepState().StopAfterCurrent
+	if err := ui.player.SetStopAfterCurrent(stop); err != nil {
+		ui.logger.PrintError("SetStopAfterCurrent", err)
+		ui.showMessageBox("Unable to stop after the current song: " + err.Error())
+	}
+}
+
 func (ui *Ui) handleAddRandomSongs() {
 	ui.addRandomSongsToQueue()
 	ui.queuePage.UpdateQueue()
@@ -134,28 +301,33 @@ func (ui *Ui) addRandomSongsToQueue() {
 
 // make sure to call ui.QueuePage.UpdateQueue() after this
 func (ui *Ui) addSongToQueue(entity *subsonic.SubsonicEntity) {
-	uri := ui.connection.GetPlayUrl(entity)
-
-	queueItem := &mpvplayer.QueueItem{
-		Id:       entity.Id,
-		Uri:      uri,
-		Title:    entity.GetSongTitle(),
-		Artist:   entity.Artist,
-		Duration: entity.Duration,
-	}
-	ui.player.AddToQueue(queueItem)
+	queueItem := player.NewQueueItem(entity, ui.connection.GetPlayUrl(entity))
+	ui.player.AddToQueue(&queueItem)
 }
 
-func makeSongHandler(entity *subsonic.SubsonicEntity, ui *Ui, fallbackArtist string) func() {
-	// make copy of values so this function can be used inside a loop iterating over entities
-	id := entity.Id
-	uri := ui.connection.GetPlayUrl(entity)
-	title := entity.Title
-	artist := stringOr(entity.Artist, fallbackArtist)
-	duration := entity.Duration
+// make sure to call ui.QueuePage.UpdateQueue() after this
+func (ui *Ui) insertSongNext(entity *subsonic.SubsonicEntity) {
+	queueItem := player.NewQueueItem(entity, ui.connection.GetPlayUrl(entity))
+	ui.player.InsertNext(&queueItem)
+}
 
+// makeSongHandler returns a handler that plays the song at index and the songs
+// following it in entities, e.g. the rest of the album or playlist. They
+// replace the upcoming songs in the queue.
+func makeSongHandler(entities []subsonic.SubsonicEntity, index int, ui *Ui, fallbackArtist string) func() {
 	return func() {
-		if err := ui.player.PlayUri(id, uri, title, artist, duration); err != nil {
+		queue := make(player.PlayerQueue, 0, len(entities)-index)
+		for i := index; i < len(entities); i++ {
+			entity := &entities[i]
+			if entity.IsDirectory {
+				continue
+			}
+			queueItem := player.NewQueueItem(entity, ui.connection.GetPlayUrl(entity))
+			queueItem.Artist = stringOr(queueItem.Artist, fallbackArtist)
+			queue = append(queue, queueItem)
+		}
+
+		if err := ui.player.PlayItems(queue); err != nil {
 			ui.logger.PrintError("SongHandler Play", err)
 			return
 		}
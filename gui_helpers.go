@@ -5,9 +5,12 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/rivo/tview"
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/subsonic"
 )
 
@@ -18,11 +21,13 @@ func makeModal(p tview.Primitive, width, height int) tview.Primitive {
 		AddItem(p, 1, 1, 1, 1, 0, 0, true)
 }
 
-func formatPlayerStatus(volume int64, position int64, duration int64) string {
+func formatPlayerStatus(status player.StatusData) string {
+	position := status.Position
 	if position < 0 {
 		position = 0
 	}
 
+	duration := status.Duration
 	if duration < 0 {
 		duration = 0
 	}
@@ -30,11 +35,94 @@ func formatPlayerStatus(volume int64, position int64, duration int64) string {
 	positionMin, positionSec := secondsToMinAndSec(position)
 	durationMin, durationSec := secondsToMinAndSec(duration)
 
-	return fmt.Sprintf("[%d%%][::b][%02d:%02d/%02d:%02d]", volume,
+	volume := fmt.Sprintf("%d%%", status.Volume)
+	if status.Muted {
+		volume = "mute"
+	}
+
+	return fmt.Sprintf("[%s][::b][%02d:%02d/%02d:%02d]", volume,
 		positionMin, positionSec, durationMin, durationSec)
 }
 
-func formatSongForStatusBar(currentSong *mpvplayer.QueueItem) (text string) {
+// parseSeekTarget reads a position in a song given as [h:]mm:ss, seconds or
+// a percentage like 50%
+func parseSeekTarget(text string) (value float64, percent bool, err error) {
+	text = strings.TrimSpace(text)
+	if strings.HasSuffix(text, "%") {
+		value, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(text, "%")), 64)
+		if err == nil && (value < 0 || value > 100) {
+			err = fmt.Errorf("percentage out of range: %s", text)
+		}
+		return value, true, err
+	}
+
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return 0, false, fmt.Errorf("invalid position: %s", text)
+	}
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 || (i > 0 && number >= 60) {
+			return 0, false, fmt.Errorf("invalid position: %s", text)
+		}
+		value = value*60 + number
+	}
+	return value, false, nil
+}
+
+func formatPlayerMode(jukebox bool) string {
+	if jukebox {
+		return "[blue::b]jukebox[::-]"
+	}
+	return ""
+}
+
+func formatPlaybackModes(modes player.Modes) string {
+	texts := []string{}
+	if modes.Speed != 1 && modes.Speed != 0 {
+		texts = append(texts, strconv.FormatFloat(modes.Speed, 'f', -1, 64)+"x")
+	}
+	if modes.Shuffle {
+		texts = append(texts, "shuffle")
+	}
+	if modes.Repeat != remote.RepeatOff {
+		texts = append(texts, "repeat "+modes.Repeat.String())
+	}
+	if modes.ReplayGain != player.ReplayGainOff {
+		texts = append(texts, "rg "+modes.ReplayGain.String())
+	}
+	text := strings.Join(texts, " ")
+	if text == "" {
+		return ""
+	}
+	return "[green::b]" + text + "[::-]"
+}
+
+func formatSleepState(state player.SleepState) string {
+	texts := []string{}
+	min, sec := secondsToMinAndSec(int64(state.Remaining.Seconds()))
+	if state.EndOfAlbum {
+		texts = append(texts, fmt.Sprintf("album %02d:%02d", min, sec))
+	} else if state.Remaining > 0 {
+		texts = append(texts, fmt.Sprintf("sleep %02d:%02d", min, sec))
+	}
+	if state.StopAfterCurrent {
+		texts = append(texts, "stop after")
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	return "[yellow]" + strings.Join(texts, " ") + "[::-]"
+}
+
+func formatPendingScrobbles(pending int) string {
+	if pending == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[yellow]scrobbles: %d[::-]", pending)
+}
+
+func formatSongForStatusBar(currentSong *player.QueueItem) (text string) {
 	if currentSong == nil {
 		return
 	}
@@ -44,9 +132,37 @@ func formatSongForStatusBar(currentSong *mpvplayer.QueueItem) (text string) {
 	if currentSong.Artist != "" {
 		text += " [gray]by [white]" + tview.Escape(currentSong.Artist)
 	}
+	if currentSong.Album != "" {
+		text += " [gray]on [white]" + tview.Escape(currentSong.Album)
+	}
+	if currentSong.Year > 0 {
+		text += fmt.Sprintf(" [gray](%d)", currentSong.Year)
+	}
+	if format := formatAudioFormat(currentSong); format != "" {
+		text += " [gray]" + tview.Escape(format)
+	}
 	return
 }
 
+// formatAudioFormat returns e.g. "flac 1024kbps", or "" if nothing is known
+func formatAudioFormat(song *player.QueueItem) string {
+	format := song.Suffix
+	if song.BitRate > 0 {
+		format = strings.TrimSpace(fmt.Sprintf("%s %dkbps", format, song.BitRate))
+	}
+	return format
+}
+
+// formatAudioParams returns e.g. " [gray]44.1kHz stereo" for the status bar,
+// or "" if nothing is playing
+func formatAudioParams(params player.AudioParams) string {
+	if params.SampleRate <= 0 {
+		return ""
+	}
+	rate := strconv.FormatFloat(float64(params.SampleRate)/1000, 'f', -1, 64)
+	return " [gray]" + strings.TrimSpace(rate+"kHz "+tview.Escape(params.Channels))
+}
+
 func formatSongForPlaylistEntry(entity subsonic.SubsonicEntity) (text string) {
 	if entity.Title != "" {
 		text += "[::-] [white]" + tview.Escape(entity.Title)
@@ -3,8 +3,8 @@
 
 package main
 
-import "github.com/spezifisch/stmps/mpvplayer"
+import "github.com/spezifisch/stmps/player"
 
-func (ui *Ui) SendEvent(event mpvplayer.UiEvent) {
+func (ui *Ui) SendEvent(event player.UiEvent) {
 	ui.mpvEvents <- event
 }
@@ -0,0 +1,232 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/spezifisch/stmps/fakeplayer"
+	"github.com/spezifisch/stmps/jukebox"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic/subsonictest"
+	"github.com/spf13/viper"
+)
+
+// startTestUi runs the ui on a simulated screen with the demo library and the
+// fake player, like stmp --demo
+func startTestUi(t *testing.T) (*Ui, *fakeplayer.Player, tcell.SimulationScreen) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	t.Cleanup(server.Close)
+
+	logger := logger.Init()
+	connection := server.Connection(logger)
+	indexes, err := connection.GetIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlists, err := connection.GetPlaylists()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := fakeplayer.NewPlayer(logger)
+	ui := InitGui(&indexes.Indexes.Index,
+		&playlists.Playlists.Playlists,
+		connection,
+		newPlayerSwitch(fake, jukebox.NewPlayer(connection, logger)),
+		logger)
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	screen.SetSize(120, 40)
+	ui.app.SetScreen(screen)
+
+	done := make(chan error)
+	go func() {
+		done <- ui.Run()
+	}()
+	t.Cleanup(func() {
+		ui.app.Stop()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		ui.player.Quit()
+	})
+	return ui, fake, screen
+}
+
+// inUi runs f in the ui goroutine and waits for it
+func inUi(ui *Ui, f func()) {
+	done := make(chan struct{})
+	ui.app.QueueUpdate(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+// waitForUi fails unless check, which runs in the ui goroutine, returns true
+// within a few seconds
+func waitForUi(t *testing.T, ui *Ui, what string, check func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		ok := false
+		inUi(ui, func() {
+			ok = check()
+		})
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func waitForStatus(t *testing.T, ui *Ui, expected string) {
+	t.Helper()
+	waitForUi(t, ui, "status "+expected, func() bool {
+		return strings.Contains(ui.startStopStatus.GetText(true), expected)
+	})
+}
+
+func TestUiPlaysAlbum(t *testing.T) {
+	ui, fake, screen := startTestUi(t)
+
+	// the demo album Northern Lights
+	response, err := ui.connection.GetMusicDirectory("ar-1-1-al-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs := response.Directory.Entities
+	if len(songs) != 4 {
+		t.Fatalf("expected 4 songs, got %d", len(songs))
+	}
+
+	// select the second song, the rest of the album is queued with it
+	inUi(ui, makeSongHandler(songs, 1, ui, ""))
+	waitForStatus(t, ui, "Playing")
+	waitForStatus(t, ui, "Polar Night")
+	inUi(ui, func() {
+		queue := ui.queuePage.queueData.playerQueue
+		if len(queue) != 3 || queue[0].Title != "Polar Night" || queue[2].Title != "Thaw" {
+			t.Errorf("unexpected queue page %v", queue)
+		}
+	})
+
+	// the song ends, the queue page marks it played
+	fake.Advance(time.Duration(songs[1].Duration) * time.Second)
+	waitForStatus(t, ui, "Midnight Sun")
+	waitForUi(t, ui, "played song", func() bool {
+		played := ui.queuePage.queueData.played
+		return len(played) == 3 && played[0] && !played[1]
+	})
+
+	// keys go through the player too
+	screen.InjectKey(tcell.KeyRune, 'p', tcell.ModNone)
+	waitForStatus(t, ui, "Paused")
+	if paused, _ := fake.IsPaused(); !paused {
+		t.Error("expected the fake player paused")
+	}
+	screen.InjectKey(tcell.KeyRune, 'p', tcell.ModNone)
+	waitForStatus(t, ui, "Playing")
+
+	screen.InjectKey(tcell.KeyRune, 'P', tcell.ModNone)
+	waitForStatus(t, ui, "Stopped")
+}
+
+func TestUiShuffle(t *testing.T) {
+	ui, fake, screen := startTestUi(t)
+
+	response, err := ui.connection.GetMusicDirectory("ar-1-2-al-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs := response.Directory.Entities
+	inUi(ui, makeSongHandler(songs, 0, ui, ""))
+	waitForStatus(t, ui, songs[0].Title)
+
+	screen.InjectKey(tcell.KeyRune, 'S', tcell.ModNone)
+	waitForUi(t, ui, "shuffle shown", func() bool {
+		return strings.Contains(ui.topBar.Indicator(IndicatorPlaybackModes), "shuffle")
+	})
+	if !fake.GetModes().Shuffle {
+		t.Fatal("expected the fake player shuffling")
+	}
+
+	// all songs are played once, the queue page keeps the album order
+	played := map[string]bool{}
+	for range songs {
+		track, err := fake.GetPlayingTrack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		played[track.Id] = true
+		fake.Advance(time.Duration(track.Duration) * time.Second)
+	}
+	waitForStatus(t, ui, "Stopped")
+	if len(played) != len(songs) {
+		t.Errorf("expected %d songs played, got %v", len(songs), played)
+	}
+	inUi(ui, func() {
+		ui.queuePage.UpdateQueue()
+		for i, song := range ui.queuePage.queueData.playerQueue {
+			if song.Id != songs[i].Id {
+				t.Errorf("expected %s at %d, got %s", songs[i].Id, i, song.Id)
+			}
+		}
+	})
+}
+
+// screenRow returns the text in row y of the screen
+func screenRow(screen tcell.SimulationScreen, y int) string {
+	cells, width, _ := screen.GetContents()
+	row := strings.Builder{}
+	for _, cell := range cells[y*width : (y+1)*width] {
+		if len(cell.Runes) > 0 {
+			row.WriteString(string(cell.Runes))
+		} else {
+			row.WriteByte(' ')
+		}
+	}
+	return row.String()
+}
+
+func TestUiTopBarKeepsSong(t *testing.T) {
+	for _, width := range []int{80, 120} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			ui, _, screen := startTestUi(t)
+			screen.SetSize(width, 40)
+
+			response, err := ui.connection.GetMusicDirectory("ar-1-1-al-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			inUi(ui, makeSongHandler(response.Directory.Entities, 0, ui, ""))
+			waitForStatus(t, ui, "First Frost")
+
+			// all indicators at once
+			for _, key := range []rune{'S', 'L', 'V', 'z'} {
+				screen.InjectKey(tcell.KeyRune, key, tcell.ModNone)
+			}
+			waitForUi(t, ui, "indicators", func() bool {
+				return ui.topBar.Indicator(IndicatorSleep) != "" && ui.topBar.Indicator(IndicatorPlaybackModes) != ""
+			})
+			inUi(ui, func() {
+				ui.topBar.SetIndicator(IndicatorScan, "[yellow]scanning: 1234[::-]")
+				ui.topBar.SetIndicator(IndicatorScrobbles, formatPendingScrobbles(12))
+			})
+
+			waitForUi(t, ui, "song and volume on screen", func() bool {
+				row := screenRow(screen, 0)
+				return strings.Contains(row, "Playing First Frost") && strings.Contains(row, "[100%]")
+			})
+		})
+	}
+}
@@ -4,9 +4,21 @@ const helpPlayback = `
 p      play/pause
 P      stop
 >      next song
+<      restart song/previous song
 -/=(+) volume down/volume up
 ,/.    seek -10/+10 seconds
+T      seek to position (mm:ss or percent)
 r      add 50 random songs to queue
+U      rescan library on server
+J      toggle local playback/server jukebox
+S      toggle shuffle
+L      cycle repeat off/all/one
+V      cycle ReplayGain off/track/album
+{/}    playback speed -/+0.25x
+O      select audio device
+z      cycle sleep timer 15/30/60 min/end of album/off
+Z      toggle stop after the current song
+1-6    browser/queue/playlists/log/now playing/equalizer page
 `
 
 const helpPageBrowser = `
@@ -16,9 +28,11 @@ artist tab
   a     Add all artist songs to queue
   n     Continue search forward
   N     Continue search backwards
+  f     Select music folder
 song tab
-  ENTER play song (clears current queue)
+  ENTER play song and the rest of the album
   a     add album or song to queue
+  e     play album or song next
   A     add song to playlist
   y     toggle star on song/album
   R     refresh the list
@@ -26,6 +40,8 @@ ESC   Close search
 `
 
 const helpPageQueue = `
+ENTER play selected song
+[/]   move selected song up/down (also Shift+Up/Down or drag)
 d/DEL remove currently selected song from the queue
 D     remove all songs from queue
 y     toggle star on song
@@ -35,4 +51,21 @@ const helpPagePlaylists = `
 n     new playlist
 d     delete playlist
 a     add playlist or song to queue
+e     play song next
+ENTER play song and the rest of the playlist
+`
+
+const helpPageNowPlaying = `
+ENTER play song (clears current queue)
+a     add song to queue
+R     refresh the list
+`
+
+const helpPageEqualizer = `
+ENTER apply preset
+d     delete saved preset
+LEFT/RIGHT (h/l) select band
+UP/DOWN (k/j) raise/lower band by 1 dB
+f     reset to flat
+s     save as preset
 `
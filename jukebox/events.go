@@ -0,0 +1,64 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package jukebox
+
+import "github.com/spezifisch/stmps/player"
+
+func (p *Player) sendGuiEvent(typ player.UiEventType) {
+	if p.eventConsumer != nil {
+		p.eventConsumer.SendEvent(player.UiEvent{
+			Type: typ,
+			Data: nil,
+		})
+	}
+
+	p.sendRemoteEvent(typ, nil)
+}
+
+func (p *Player) sendGuiDataEvent(typ player.UiEventType, data interface{}) {
+	if p.eventConsumer != nil {
+		p.eventConsumer.SendEvent(player.UiEvent{
+			Type: typ,
+			Data: data,
+		})
+	}
+
+	p.sendRemoteEvent(typ, data)
+}
+
+func (p *Player) sendRemoteEvent(typ player.UiEventType, data interface{}) {
+	switch typ {
+	case player.EventStopped:
+		for _, cb := range p.cbOnStopped {
+			cb()
+		}
+
+	case player.EventUnpaused, player.EventPlaying:
+		if data != nil {
+			p.sendSongChange(data.(player.QueueItem))
+		}
+		for _, cb := range p.cbOnPlaying {
+			cb()
+		}
+
+	case player.EventPaused:
+		if data != nil {
+			p.sendSongChange(data.(player.QueueItem))
+		}
+		for _, cb := range p.cbOnPaused {
+			cb()
+		}
+
+	case player.EventSeeked:
+		for _, cb := range p.cbOnSeek {
+			cb()
+		}
+	}
+}
+
+func (p *Player) sendSongChange(track player.QueueItem) {
+	for _, cb := range p.cbOnSongChange {
+		cb(&track)
+	}
+}
@@ -0,0 +1,776 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package jukebox
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// how often the jukebox state is fetched from the server
+const pollInterval = time.Second
+
+// ErrNotSupported is returned for playback modes the jukebox doesn't have
+var ErrNotSupported = errors.New("not supported by the jukebox")
+
+// Player controls the server-side jukebox through the jukeboxControl API.
+// It offers the same operations as mpvplayer.Player. The jukebox playlist on
+// the server is authoritative and serves as the queue, the songs before the
+// one the jukebox is currently playing are the history.
+type Player struct {
+	connection    *subsonic.SubsonicConnection
+	eventConsumer player.EventConsumer
+	logger        logger.LoggerInterface
+
+	// guards everything below, commands come from the gui and remote contexts
+	// while the poll loop updates the state
+	mutex sync.Mutex
+
+	// full jukebox playlist and state as last reported by the server
+	playlist     player.PlayerQueue
+	currentIndex int
+	playing      bool
+	gain         float64
+	position     int
+
+	stopped bool
+	polling bool
+	// report the full state after the next poll, not just changes
+	announce bool
+
+	quit chan struct{}
+	poll chan struct{}
+
+	// callbacks
+	cbOnPaused     []func()
+	cbOnStopped    []func()
+	cbOnPlaying    []func()
+	cbOnSeek       []func()
+	cbOnSongChange []func(remote.TrackInterface)
+}
+
+var _ player.PlayerInterface = (*Player)(nil)
+
+func NewPlayer(connection *subsonic.SubsonicConnection, logger logger.LoggerInterface) *Player {
+	return &Player{
+		connection:    connection,
+		eventConsumer: nil, // must be set by calling RegisterEventConsumer()
+		logger:        logger,
+		playlist:      make(player.PlayerQueue, 0),
+		stopped:       true,
+		quit:          make(chan struct{}),
+		poll:          make(chan struct{}, 1),
+	}
+}
+
+func (p *Player) RegisterEventConsumer(consumer player.EventConsumer) {
+	p.eventConsumer = consumer
+}
+
+// SetPolling enables or disables fetching the jukebox state from the server.
+// It is enabled while the jukebox is the active player.
+func (p *Player) SetPolling(enabled bool) {
+	p.mutex.Lock()
+	p.polling = enabled
+	p.announce = enabled
+	p.mutex.Unlock()
+
+	if enabled {
+		p.requestPoll()
+	}
+}
+
+// Check verifies that the server allows the user to control the jukebox
+func (p *Player) Check() error {
+	_, err := p.connection.JukeboxStatus()
+	return err
+}
+
+// EventLoop polls the jukebox state until Quit() is called
+func (p *Player) EventLoop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		case <-p.poll:
+		}
+
+		p.mutex.Lock()
+		polling := p.polling
+		p.mutex.Unlock()
+		if !polling {
+			continue
+		}
+
+		response, err := p.connection.JukeboxGet()
+		if err != nil {
+			p.logger.PrintError("jukebox.EventLoop: get", err)
+			continue
+		}
+		p.update(&response.JukeboxPlaylist)
+	}
+}
+
+// update compares the new server state with the previous one and emits events
+func (p *Player) update(status *subsonic.SubsonicJukeboxStatus) {
+	p.mutex.Lock()
+
+	previous, hadPrevious := p.currentItem()
+	wasPlaying := p.playing
+	announce := p.announce
+	p.announce = false
+
+	playlist := make(player.PlayerQueue, 0, len(status.Entries))
+	for i := range status.Entries {
+		// no uri, the server plays the file itself
+		playlist = append(playlist, player.NewQueueItem(&status.Entries[i], ""))
+	}
+	p.playlist = playlist
+	p.currentIndex = status.CurrentIndex
+	p.playing = status.Playing
+	p.gain = status.Gain
+	p.position = status.Position
+	if p.playing {
+		p.stopped = false
+	}
+
+	current, hasCurrent := p.currentItem()
+	stopped := p.stopped
+	statusData := player.StatusData{
+		Volume:   int64(math.Round(p.gain * 100)),
+		Position: int64(p.position),
+		Duration: int64(current.Duration),
+	}
+	p.mutex.Unlock()
+
+	p.sendGuiDataEvent(player.EventStatus, statusData)
+
+	switch {
+	case announce && !hasCurrent:
+		p.sendGuiEvent(player.EventStopped)
+	case announce && status.Playing:
+		p.sendGuiDataEvent(player.EventPlaying, current)
+	case announce:
+		p.sendGuiDataEvent(player.EventPaused, current)
+	case !hasCurrent && hadPrevious, !hasCurrent && wasPlaying:
+		p.sendGuiEvent(player.EventStopped)
+	case !hasCurrent:
+		// nothing to do
+	case status.Playing && (!hadPrevious || previous.Id != current.Id):
+		p.sendGuiDataEvent(player.EventPlaying, current)
+	case status.Playing && !wasPlaying:
+		p.sendGuiDataEvent(player.EventUnpaused, current)
+	case !status.Playing && wasPlaying && stopped:
+		p.sendGuiEvent(player.EventStopped)
+	case !status.Playing && wasPlaying:
+		p.sendGuiDataEvent(player.EventPaused, current)
+	}
+}
+
+// queueStart is the jukebox playlist index of the current song.
+// The server reports -1 if it hasn't played anything yet.
+// must be called with mutex held
+func (p *Player) queueStart() int {
+	if p.currentIndex < 0 {
+		return 0
+	}
+	return p.currentIndex
+}
+
+// must be called with mutex held
+func (p *Player) currentItem() (player.QueueItem, bool) {
+	start := p.queueStart()
+	if start >= len(p.playlist) {
+		return player.QueueItem{}, false
+	}
+	return p.playlist[start], true
+}
+
+// requestPoll makes the event loop fetch the state right away
+func (p *Player) requestPoll() {
+	select {
+	case p.poll <- struct{}{}:
+	default:
+		// poll already pending
+	}
+}
+
+func (p *Player) Quit() {
+	close(p.quit)
+}
+
+func (p *Player) PlayNextTrack() error {
+	p.mutex.Lock()
+	next := p.queueStart() + 1
+	count := len(p.playlist)
+	p.mutex.Unlock()
+
+	if next >= count {
+		// end of queue
+		return p.Stop()
+	}
+
+	defer p.requestPoll()
+	_, err := p.connection.JukeboxSkip(next, 0)
+	return err
+}
+
+func (p *Player) PlayUri(item *player.QueueItem) error {
+	return p.PlayItems(player.PlayerQueue{*item})
+}
+
+// PlayItems replaces the jukebox playlist with items and plays the first one
+func (p *Player) PlayItems(items player.PlayerQueue) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	defer p.requestPoll()
+	if _, err := p.connection.JukeboxSet(itemIds(items)); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	p.stopped = false
+	p.mutex.Unlock()
+
+	_, err := p.connection.JukeboxSkip(0, 0)
+	return err
+}
+
+// PlayQueueItem plays the song at index in the jukebox playlist
+func (p *Player) PlayQueueItem(index int) error {
+	p.mutex.Lock()
+	count := len(p.playlist)
+	p.stopped = false
+	p.mutex.Unlock()
+
+	if index < 0 || index >= count {
+		return errors.New("invalid queue entry")
+	}
+
+	defer p.requestPoll()
+	_, err := p.connection.JukeboxSkip(index, 0)
+	return err
+}
+
+func (p *Player) Stop() error {
+	p.logger.Printf("stopping jukebox (user)")
+
+	p.mutex.Lock()
+	p.stopped = true
+	p.mutex.Unlock()
+
+	defer p.requestPoll()
+	_, err := p.connection.JukeboxStop()
+	return err
+}
+
+func (p *Player) IsSongLoaded() (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, ok := p.currentItem()
+	return ok, nil
+}
+
+func (p *Player) IsPaused() (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !p.playing, nil
+}
+
+func (p *Player) IsPlaying() (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.playing, nil
+}
+
+// Pause toggles playing music on the jukebox.
+// If stopped, the current song is started from the beginning.
+func (p *Player) Pause() (err error) {
+	p.mutex.Lock()
+	playing := p.playing
+	stopped := p.stopped
+	currentIndex := p.queueStart()
+	_, loaded := p.currentItem()
+	p.stopped = false
+	p.mutex.Unlock()
+
+	defer p.requestPoll()
+	if playing {
+		_, err = p.connection.JukeboxStop()
+	} else if stopped && loaded {
+		_, err = p.connection.JukeboxSkip(currentIndex, 0)
+	} else if loaded {
+		_, err = p.connection.JukeboxStart()
+	} else {
+		p.mutex.Lock()
+		p.stopped = true
+		p.mutex.Unlock()
+		p.sendGuiEvent(player.EventStopped)
+	}
+	return
+}
+
+func (p *Player) Play() error {
+	if isPlaying, err := p.IsPlaying(); err != nil {
+		return err
+	} else if !isPlaying {
+		return p.Pause()
+	}
+	return nil
+}
+
+func (p *Player) SetVolume(percentValue int) error {
+	if percentValue > 100 {
+		percentValue = 100
+	} else if percentValue < 0 {
+		percentValue = 0
+	}
+
+	defer p.requestPoll()
+	_, err := p.connection.JukeboxSetGain(float64(percentValue) / 100)
+	return err
+}
+
+func (p *Player) GetVolume() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return int(math.Round(p.gain * 100))
+}
+
+func (p *Player) AdjustVolume(increment int) error {
+	p.mutex.Lock()
+	volume := int(math.Round(p.gain * 100))
+	p.mutex.Unlock()
+
+	return p.SetVolume(volume + increment)
+}
+
+func (p *Player) Seek(increment int) error {
+	p.mutex.Lock()
+	position := p.position
+	p.mutex.Unlock()
+
+	return p.SeekAbsolute(float64(position + increment))
+}
+
+func (p *Player) SeekAbsolute(position float64) error {
+	p.mutex.Lock()
+	currentIndex := p.queueStart()
+	current, loaded := p.currentItem()
+	p.mutex.Unlock()
+
+	if !loaded {
+		return nil
+	}
+	if position < 0 {
+		position = 0
+	}
+
+	defer p.requestPoll()
+	if _, err := p.connection.JukeboxSkip(currentIndex, int(position)); err != nil {
+		return err
+	}
+
+	// the server skips right away, report it before the next poll
+	p.mutex.Lock()
+	p.position = int(position)
+	statusData := player.StatusData{
+		Volume:   int64(math.Round(p.gain * 100)),
+		Position: int64(p.position),
+		Duration: int64(current.Duration),
+	}
+	p.mutex.Unlock()
+	p.sendGuiDataEvent(player.EventSeeked, statusData)
+	return nil
+}
+
+// SeekPercent jumps to the given share of the current song
+func (p *Player) SeekPercent(percent float64) error {
+	p.mutex.Lock()
+	current, loaded := p.currentItem()
+	p.mutex.Unlock()
+
+	if !loaded {
+		return nil
+	}
+	percent = math.Max(0, math.Min(percent, 100))
+	return p.SeekAbsolute(float64(current.Duration) * percent / 100)
+}
+
+func (p *Player) IsSeeking() (bool, error) {
+	return false, nil
+}
+
+func (p *Player) GetTimePos() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return float64(p.position)
+}
+
+func (p *Player) NextTrack() error {
+	return p.PlayNextTrack()
+}
+
+// PreviousTrack restarts the current song if it played for more than
+// player.RestartThreshold seconds, otherwise it goes back to the previous
+// song, like mpvplayer does
+func (p *Player) PreviousTrack() error {
+	p.mutex.Lock()
+	previous := p.queueStart() - 1
+	restart := previous < 0 || p.position > player.RestartThreshold
+	p.stopped = false
+	p.mutex.Unlock()
+
+	if restart {
+		return p.SeekAbsolute(0)
+	}
+
+	defer p.requestPoll()
+	_, err := p.connection.JukeboxSkip(previous, 0)
+	return err
+}
+
+// accessed from gui context
+func (p *Player) ClearQueue() {
+	if err := p.Stop(); err != nil {
+		p.logger.PrintError("jukebox Stop", err)
+	}
+	if _, err := p.connection.JukeboxClear(); err != nil {
+		p.logger.PrintError("jukebox Clear", err)
+	}
+
+	// show it right away, the next poll confirms it
+	p.mutex.Lock()
+	p.playlist = make(player.PlayerQueue, 0)
+	p.currentIndex = 0
+	p.mutex.Unlock()
+}
+
+func (p *Player) DeleteQueueItem(index int) {
+	p.mutex.Lock()
+	current := p.queueStart()
+	count := len(p.playlist)
+	p.mutex.Unlock()
+
+	if index < 0 || index >= count {
+		p.logger.Printf("jukebox DeleteQueueItem bad index %d (len %d)", index, count)
+		return
+	}
+	if index == current {
+		// the jukebox keeps playing a removed song, skip it first
+		if err := p.PlayNextTrack(); err != nil {
+			p.logger.PrintError("jukebox PlayNextTrack", err)
+		}
+	}
+
+	defer p.requestPoll()
+	if _, err := p.connection.JukeboxRemove(index); err != nil {
+		p.logger.PrintError("jukebox Remove", err)
+		return
+	}
+
+	if index == current {
+		// not shown right away, the next poll reports the song change
+		return
+	}
+	p.mutex.Lock()
+	if index < len(p.playlist) {
+		p.playlist = append(p.playlist[:index], p.playlist[index+1:]...)
+		if index < p.currentIndex {
+			p.currentIndex--
+		}
+	}
+	p.mutex.Unlock()
+}
+
+func (p *Player) AddToQueue(item *player.QueueItem) {
+	defer p.requestPoll()
+	if _, err := p.connection.JukeboxAdd([]string{item.Id}); err != nil {
+		p.logger.PrintError("jukebox Add", err)
+		return
+	}
+
+	// show it right away, the next poll replaces it with the server's version
+	p.mutex.Lock()
+	p.playlist = append(p.playlist, *item)
+	p.mutex.Unlock()
+}
+
+// InsertNext adds item to the jukebox playlist right after the current song
+func (p *Player) InsertNext(item *player.QueueItem) {
+	p.mutex.Lock()
+	current := p.queueStart()
+	index := current + 1
+	if index > len(p.playlist) {
+		index = len(p.playlist)
+	}
+	playlist := make(player.PlayerQueue, 0, len(p.playlist)+1)
+	playlist = append(playlist, p.playlist[:index]...)
+	playlist = append(playlist, *item)
+	playlist = append(playlist, p.playlist[index:]...)
+	p.mutex.Unlock()
+
+	// the current song keeps its index
+	if err := p.setPlaylist(playlist, current); err != nil {
+		p.logger.PrintError("jukebox InsertNext", err)
+	}
+}
+
+// MoveQueueItem moves the song at index from to index to in the jukebox
+// playlist
+func (p *Player) MoveQueueItem(from, to int) error {
+	p.mutex.Lock()
+	count := len(p.playlist)
+	if from < 0 || from >= count || to < 0 || to >= count {
+		p.mutex.Unlock()
+		return errors.New("invalid queue entry")
+	}
+	if from == to {
+		p.mutex.Unlock()
+		return nil
+	}
+
+	playlist := make(player.PlayerQueue, 0, count)
+	playlist = append(playlist, p.playlist[:from]...)
+	playlist = append(playlist, p.playlist[from+1:]...)
+	playlist = append(playlist[:to], append(player.PlayerQueue{p.playlist[from]}, playlist[to:]...)...)
+
+	// follow the current song to its new index
+	current := p.queueStart()
+	switch {
+	case current == from:
+		current = to
+	case from < current && current <= to:
+		current--
+	case to <= current && current < from:
+		current++
+	}
+	p.mutex.Unlock()
+
+	return p.setPlaylist(playlist, current)
+}
+
+// setPlaylist replaces the jukebox playlist. The server starts over after
+// that, so the song at current is resumed at its position, or stays paused.
+func (p *Player) setPlaylist(playlist player.PlayerQueue, current int) error {
+	defer p.requestPoll()
+	if _, err := p.connection.JukeboxSet(itemIds(playlist)); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	hadCurrent := p.currentIndex >= 0
+	playing := p.playing
+	position := p.position
+	// show it right away, the next poll confirms it
+	p.playlist = playlist
+	if hadCurrent {
+		p.currentIndex = current
+	}
+	p.mutex.Unlock()
+
+	if !hadCurrent || current >= len(playlist) {
+		return nil
+	}
+	if _, err := p.connection.JukeboxSkip(current, position); err != nil {
+		return err
+	}
+	if !playing {
+		_, err := p.connection.JukeboxStop()
+		return err
+	}
+	return nil
+}
+
+func itemIds(items player.PlayerQueue) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return ids
+}
+
+func (p *Player) GetQueueItem(index int) (player.QueueItem, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if index < 0 || index >= len(p.playlist) {
+		return player.QueueItem{}, errors.New("invalid queue entry")
+	}
+	return p.playlist[index], nil
+}
+
+// GetQueueCopy returns the jukebox playlist, the index of the current song
+// and which songs were played
+func (p *Player) GetQueueCopy() (queue player.PlayerQueue, current int, played []bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queue = make(player.PlayerQueue, len(p.playlist))
+	copy(queue, p.playlist)
+	current = p.queueStart()
+	played = make([]bool, len(queue))
+	for i := 0; i < current && i < len(played); i++ {
+		played[i] = true
+	}
+	return
+}
+
+// accessed from background context
+func (p *Player) GetPlayingTrack() (player.QueueItem, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.playing {
+		return player.QueueItem{}, errors.New("not playing")
+	}
+	current, ok := p.currentItem()
+	if !ok {
+		return player.QueueItem{}, errors.New("queue empty")
+	}
+	return current, nil
+}
+
+// remote.ControlledPlayer callbacks
+func (p *Player) OnPaused(cb func()) {
+	p.cbOnPaused = append(p.cbOnPaused, cb)
+}
+
+func (p *Player) OnStopped(cb func()) {
+	p.cbOnStopped = append(p.cbOnStopped, cb)
+}
+
+func (p *Player) OnPlaying(cb func()) {
+	p.cbOnPlaying = append(p.cbOnPlaying, cb)
+}
+
+func (p *Player) OnSeek(cb func()) {
+	p.cbOnSeek = append(p.cbOnSeek, cb)
+}
+
+func (p *Player) OnSongChange(cb func(track remote.TrackInterface)) {
+	p.cbOnSongChange = append(p.cbOnSongChange, cb)
+}
+
+// OnModeChange does nothing, the jukebox has no playback modes
+func (p *Player) OnModeChange(cb func()) {
+}
+
+func (p *Player) GetShuffle() bool {
+	return false
+}
+
+// SetShuffle isn't supported, the server's shuffle would reorder the playlist
+func (p *Player) SetShuffle(shuffle bool) error {
+	if shuffle {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (p *Player) GetRepeat() remote.RepeatMode {
+	return remote.RepeatOff
+}
+
+func (p *Player) SetRepeat(mode remote.RepeatMode) error {
+	if mode != remote.RepeatOff {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// GetModes returns the modes, the jukebox only plays in order at normal speed
+func (p *Player) GetModes() player.Modes {
+	return player.Modes{Speed: 1}
+}
+
+func (p *Player) GetSpeed() float64 {
+	return 1
+}
+
+// SetSpeed isn't supported, the jukebox API has no speed
+func (p *Player) SetSpeed(speed float64) error {
+	if speed != 1 {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (p *Player) GetReplayGain() player.ReplayGain {
+	return player.ReplayGain{}
+}
+
+// SetReplayGain isn't supported, the server decides how loud the jukebox plays
+func (p *Player) SetReplayGain(settings player.ReplayGain) error {
+	if settings.Mode != player.ReplayGainOff {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (p *Player) GetEqualizer() player.Equalizer {
+	return player.Equalizer{}
+}
+
+// SetEqualizer isn't supported, the jukebox plays on the server
+func (p *Player) SetEqualizer(equalizer player.Equalizer) error {
+	if !equalizer.IsFlat() {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (p *Player) GetSleepState() player.SleepState {
+	return player.SleepState{}
+}
+
+// SetSleepTimer isn't supported, the jukebox can't fade out on its own
+func (p *Player) SetSleepTimer(duration time.Duration) error {
+	if duration > 0 {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (p *Player) SetSleepAtEndOfAlbum() error {
+	return ErrNotSupported
+}
+
+func (p *Player) SetStopAfterCurrent(stop bool) error {
+	if stop {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// LoadQueue isn't supported, the jukebox keeps its queue on the server
+func (p *Player) LoadQueue(items player.PlayerQueue, current int, played []bool, position float64) error {
+	return ErrNotSupported
+}
+
+// GetAudioDevices isn't supported, the server picks its audio device
+func (p *Player) GetAudioDevices() ([]player.AudioDevice, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *Player) GetAudioDevice() (string, error) {
+	return "", ErrNotSupported
+}
+
+func (p *Player) SetAudioDevice(name string, exclusive bool) error {
+	return ErrNotSupported
+}
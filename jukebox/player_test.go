@@ -0,0 +1,286 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package jukebox
+
+import (
+	"testing"
+
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/subsonic/subsonictest"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Print(s string) {
+	l.t.Log(s)
+}
+
+func (l testLogger) Printf(s string, as ...interface{}) {
+	l.t.Logf(s, as...)
+}
+
+func (l testLogger) PrintError(source string, err error) {
+	l.t.Logf("Error(%s) -> %s", source, err)
+}
+
+// eventRecorder keeps the events except status updates, the last of which is
+// kept separately. Events are sent synchronously by poll.
+type eventRecorder struct {
+	player *Player
+	events []player.UiEvent
+	status player.StatusData
+}
+
+func (r *eventRecorder) SendEvent(event player.UiEvent) {
+	// consumers may call back into the player
+	r.player.GetQueueCopy()
+	if event.Type == player.EventStatus {
+		r.status = event.Data.(player.StatusData)
+		return
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) take() []player.UiEvent {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func newTestPlayer(t *testing.T) (*Player, *subsonictest.Server, *eventRecorder) {
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	t.Cleanup(server.Close)
+
+	p := NewPlayer(server.Connection(testLogger{t}), testLogger{t})
+	recorder := &eventRecorder{player: p}
+	p.RegisterEventConsumer(recorder)
+	return p, server, recorder
+}
+
+// poll fetches the jukebox state like one iteration of EventLoop
+func poll(t *testing.T, p *Player) {
+	t.Helper()
+	response, err := p.connection.JukeboxGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.update(&response.JukeboxPlaylist)
+}
+
+// expectEvents polls and checks the events, the id of the song is checked
+// for events with one
+func expectEvents(t *testing.T, p *Player, recorder *eventRecorder, expected ...player.UiEventType) []player.UiEvent {
+	t.Helper()
+	poll(t, p)
+	events := recorder.take()
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %+v", expected, events)
+	}
+	for i := range events {
+		if events[i].Type != expected[i] {
+			t.Fatalf("expected events %v, got %+v", expected, events)
+		}
+	}
+	return events
+}
+
+func expectSong(t *testing.T, event player.UiEvent, id string) {
+	t.Helper()
+	if song := event.Data.(player.QueueItem); song.Id != id {
+		t.Fatalf("expected %s in %v, got %s", id, event.Type, song.Id)
+	}
+}
+
+// expectPlaylist checks the jukebox playlist on the server, current is the
+// index the server plays
+func expectPlaylist(t *testing.T, server *subsonictest.Server, current int, playing bool, ids ...string) {
+	t.Helper()
+	jukebox := server.Jukebox()
+	actual := make([]string, len(jukebox.Entries))
+	for i, entry := range jukebox.Entries {
+		actual[i] = entry.Id
+	}
+	if len(actual) != len(ids) {
+		t.Fatalf("expected jukebox playlist %v, got %v", ids, actual)
+	}
+	for i := range ids {
+		if actual[i] != ids[i] {
+			t.Fatalf("expected jukebox playlist %v, got %v", ids, actual)
+		}
+	}
+	if jukebox.CurrentIndex != current || jukebox.Playing != playing {
+		t.Fatalf("expected jukebox at %d playing %v, got %d playing %v",
+			current, playing, jukebox.CurrentIndex, jukebox.Playing)
+	}
+}
+
+func testItems(ids ...string) player.PlayerQueue {
+	items := make(player.PlayerQueue, len(ids))
+	for i, id := range ids {
+		items[i] = player.QueueItem{Id: id}
+	}
+	return items
+}
+
+func TestPlayerReportsChanges(t *testing.T) {
+	p, server, recorder := newTestPlayer(t)
+
+	// the full state is reported when polling starts
+	p.SetPolling(true)
+	expectEvents(t, p, recorder, player.EventStopped)
+	if recorder.status.Volume != 50 {
+		t.Errorf("expected the server's gain as volume, got %+v", recorder.status)
+	}
+
+	if err := p.PlayItems(testItems("tr-1", "tr-2", "tr-3")); err != nil {
+		t.Fatal(err)
+	}
+	events := expectEvents(t, p, recorder, player.EventPlaying)
+	expectSong(t, events[0], "tr-1")
+
+	// nothing changed
+	expectEvents(t, p, recorder)
+
+	// another client skips
+	if _, err := server.Connection(nil).JukeboxSkip(1, 5); err != nil {
+		t.Fatal(err)
+	}
+	events = expectEvents(t, p, recorder, player.EventPlaying)
+	expectSong(t, events[0], "tr-2")
+	if recorder.status.Position != 5 || recorder.status.Duration == 0 {
+		t.Errorf("unexpected status %+v", recorder.status)
+	}
+
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	events = expectEvents(t, p, recorder, player.EventPaused)
+	expectSong(t, events[0], "tr-2")
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	events = expectEvents(t, p, recorder, player.EventUnpaused)
+	expectSong(t, events[0], "tr-2")
+
+	if err := p.SetVolume(80); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder)
+	if recorder.status.Volume != 80 || p.GetVolume() != 80 {
+		t.Errorf("expected volume 80, got %+v", recorder.status)
+	}
+
+	// the jukebox API can't tell stopped from paused, the player remembers it
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder, player.EventStopped)
+
+	// played from the start of the current song
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	events = expectEvents(t, p, recorder, player.EventUnpaused)
+	expectSong(t, events[0], "tr-2")
+	if recorder.status.Position != 0 {
+		t.Errorf("expected tr-2 restarted, got %+v", recorder.status)
+	}
+
+	// another client clears the playlist
+	if _, err := server.Connection(nil).JukeboxClear(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder, player.EventStopped)
+	if loaded, _ := p.IsSongLoaded(); loaded {
+		t.Error("expected no song loaded")
+	}
+}
+
+func TestPlayerEditsPlaylist(t *testing.T) {
+	p, server, recorder := newTestPlayer(t)
+
+	if err := p.PlayItems(testItems("tr-1", "tr-2", "tr-3", "tr-4")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder, player.EventPlaying)
+	if err := p.PlayQueueItem(1); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder, player.EventPlaying)
+	expectPlaylist(t, server, 1, true, "tr-1", "tr-2", "tr-3", "tr-4")
+
+	// the current song keeps playing where it was
+	if err := p.SeekAbsolute(10); err != nil {
+		t.Fatal(err)
+	}
+	if events := recorder.take(); len(events) != 1 || events[0].Type != player.EventSeeked {
+		t.Fatalf("expected seeked, got %+v", events)
+	}
+	if err := p.MoveQueueItem(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectPlaylist(t, server, 2, true, "tr-4", "tr-1", "tr-2", "tr-3")
+	if position := server.Jukebox().Position; position != 10 {
+		t.Errorf("expected tr-2 resumed at 10, got %d", position)
+	}
+	expectEvents(t, p, recorder)
+
+	p.InsertNext(&player.QueueItem{Id: "tr-5"})
+	expectPlaylist(t, server, 2, true, "tr-4", "tr-1", "tr-2", "tr-5", "tr-3")
+	expectEvents(t, p, recorder)
+
+	p.DeleteQueueItem(0)
+	expectPlaylist(t, server, 1, true, "tr-1", "tr-2", "tr-5", "tr-3")
+	expectEvents(t, p, recorder)
+
+	// the current song is skipped before it's removed
+	p.DeleteQueueItem(1)
+	expectPlaylist(t, server, 1, true, "tr-1", "tr-5", "tr-3")
+	events := expectEvents(t, p, recorder, player.EventPlaying)
+	expectSong(t, events[0], "tr-5")
+
+	// moving keeps a paused song paused
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, recorder, player.EventPaused)
+	if err := p.MoveQueueItem(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	expectPlaylist(t, server, 0, false, "tr-5", "tr-3", "tr-1")
+	expectEvents(t, p, recorder)
+
+	p.AddToQueue(&player.QueueItem{Id: "tr-6"})
+	expectPlaylist(t, server, 0, false, "tr-5", "tr-3", "tr-1", "tr-6")
+	expectEvents(t, p, recorder)
+
+	queue, current, played := p.GetQueueCopy()
+	if len(queue) != 4 || queue[3].Id != "tr-6" || queue[3].Title == "" || current != 0 || played[0] {
+		t.Errorf("expected the server's playlist, got %+v, current %d, played %v", queue, current, played)
+	}
+
+	if err := p.MoveQueueItem(0, 4); err == nil {
+		t.Error("expected error for invalid index")
+	}
+	expectPlaylist(t, server, 0, false, "tr-5", "tr-3", "tr-1", "tr-6")
+}
+
+func TestPlayerUnsupported(t *testing.T) {
+	p, _, _ := newTestPlayer(t)
+
+	if err := p.SetSleepTimer(0); err != nil {
+		t.Errorf("expected disabling the sleep timer to work, got %v", err)
+	}
+	if err := p.SetStopAfterCurrent(true); err != ErrNotSupported {
+		t.Errorf("expected stop after current unsupported, got %v", err)
+	}
+	if err := p.SetShuffle(true); err != ErrNotSupported {
+		t.Errorf("expected shuffle unsupported, got %v", err)
+	}
+	if err := p.LoadQueue(testItems("tr-1"), 0, nil, 0); err != ErrNotSupported {
+		t.Errorf("expected loading a queue unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package keyring reads passwords from a Secret Service keyring (e.g.
+// gnome-keyring or KeePassXC) over D-Bus.
+package keyring
+
+import (
+	"errors"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	serviceName   = "org.freedesktop.secrets"
+	servicePath   = dbus.ObjectPath("/org/freedesktop/secrets")
+	serviceIface  = "org.freedesktop.Secret.Service"
+	itemIface     = "org.freedesktop.Secret.Item"
+	sessionIface  = "org.freedesktop.Secret.Session"
+	promptIface   = "org.freedesktop.Secret.Prompt"
+	noPrompt      = dbus.ObjectPath("/")
+	promptTimeout = 2 * time.Minute
+)
+
+var (
+	ErrNotFound  = errors.New("no matching item in keyring")
+	ErrDismissed = errors.New("unlocking the keyring was dismissed")
+	ErrTimeout   = errors.New("timeout waiting for keyring unlock")
+)
+
+// secret is the Secret struct of the Secret Service API
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// Lookup returns the secret of the first item matching all attributes. A
+// locked item is unlocked first, which may show a password prompt.
+func Lookup(conn *dbus.Conn, attributes map[string]string) (string, error) {
+	service := conn.Object(serviceName, servicePath)
+
+	var unlocked, locked []dbus.ObjectPath
+	if err := service.Call(serviceIface+".SearchItems", 0, attributes).Store(&unlocked, &locked); err != nil {
+		return "", err
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		var err error
+		if unlocked, err = unlock(conn, service, locked[:1]); err != nil {
+			return "", err
+		}
+	}
+	if len(unlocked) == 0 {
+		return "", ErrNotFound
+	}
+
+	// no transport encryption, we're talking to a local service
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	if err := service.Call(serviceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session); err != nil {
+		return "", err
+	}
+	defer conn.Object(serviceName, session).Call(sessionIface+".Close", 0)
+
+	var s secret
+	if err := conn.Object(serviceName, unlocked[0]).Call(itemIface+".GetSecret", 0, session).Store(&s); err != nil {
+		return "", err
+	}
+	return string(s.Value), nil
+}
+
+// unlock unlocks the items and waits for the prompt to complete if the
+// service needs one
+func unlock(conn *dbus.Conn, service dbus.BusObject, items []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := service.Call(serviceIface+".Unlock", 0, items).Store(&unlocked, &prompt); err != nil {
+		return nil, err
+	}
+	if prompt == noPrompt {
+		return unlocked, nil
+	}
+
+	matchOptions := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(promptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := conn.AddMatchSignal(matchOptions...); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.RemoveMatchSignal(matchOptions...)
+	}()
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	// an empty window id, we're not a GUI application
+	if err := conn.Object(serviceName, prompt).Call(promptIface+".Prompt", 0, "").Err; err != nil {
+		return nil, err
+	}
+
+	timeout := time.After(promptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != promptIface+".Completed" || len(signal.Body) != 2 {
+				continue
+			}
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return nil, ErrDismissed
+			}
+			result, _ := signal.Body[1].(dbus.Variant)
+			unlocked, _ = result.Value().([]dbus.ObjectPath)
+			return unlocked, nil
+
+		case <-timeout:
+			return nil, ErrTimeout
+		}
+	}
+}
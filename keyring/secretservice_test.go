@@ -0,0 +1,287 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package keyring
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startBus runs a private bus daemon as stand-in for the session bus
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "bus.conf")
+	config := fmt.Sprintf(busConfig, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configFile, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+type fakeItem struct {
+	mutex *sync.Mutex
+
+	path       dbus.ObjectPath
+	attributes map[string]string
+	secret     string
+	locked     bool
+}
+
+func (i *fakeItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.locked {
+		return secret{}, dbus.MakeFailedError(fmt.Errorf("item is locked"))
+	}
+	return secret{Session: session, Value: []byte(i.secret), ContentType: "text/plain"}, nil
+}
+
+type fakeSession struct {
+	mutex  *sync.Mutex
+	closed bool
+}
+
+func (s *fakeSession) Close() *dbus.Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	return nil
+}
+
+// fakeService implements the parts of the Secret Service API used by Lookup.
+// Methods are called from the bus connection's goroutine.
+type fakeService struct {
+	mutex   sync.Mutex
+	conn    *dbus.Conn
+	items   []*fakeItem
+	session fakeSession
+
+	// unlock through a prompt, which the user may dismiss
+	dismiss  bool
+	prompted bool
+}
+
+func (s *fakeService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for _, item := range s.items {
+		matches := true
+		for key, value := range attributes {
+			matches = matches && item.attributes[key] == value
+		}
+		if !matches {
+			continue
+		}
+		if item.locked {
+			locked = append(locked, item.path)
+		} else {
+			unlocked = append(unlocked, item.path)
+		}
+	}
+	return unlocked, locked, nil
+}
+
+func (s *fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", &dbus.Error{Name: "org.freedesktop.DBus.Error.NotSupported"}
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s *fakeService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return []dbus.ObjectPath{}, "/org/freedesktop/secrets/prompt/1", nil
+}
+
+// Prompt is exported on the prompt path
+func (s *fakeService) Prompt(windowId string) *dbus.Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prompted = true
+	unlocked := []dbus.ObjectPath{}
+	if !s.dismiss {
+		for _, item := range s.items {
+			if item.locked {
+				item.locked = false
+				unlocked = append(unlocked, item.path)
+			}
+		}
+	}
+	dismiss := s.dismiss
+	go func() {
+		_ = s.conn.Emit("/org/freedesktop/secrets/prompt/1", promptIface+".Completed", dismiss, dbus.MakeVariant(unlocked))
+	}()
+	return nil
+}
+
+func startService(t *testing.T, address string, dismiss bool, items ...*fakeItem) *fakeService {
+	t.Helper()
+	s := &fakeService{conn: connect(t, address), items: items, dismiss: dismiss}
+	s.session.mutex = &s.mutex
+	for _, item := range items {
+		item.mutex = &s.mutex
+	}
+
+	exports := []struct {
+		v     interface{}
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{s, servicePath, serviceIface},
+		{s, "/org/freedesktop/secrets/prompt/1", promptIface},
+		{&s.session, "/org/freedesktop/secrets/session/1", sessionIface},
+	}
+	for _, item := range items {
+		exports = append(exports, struct {
+			v     interface{}
+			path  dbus.ObjectPath
+			iface string
+		}{item, item.path, itemIface})
+	}
+	for _, e := range exports {
+		if err := s.conn.Export(e.v, e.path, e.iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reply, err := s.conn.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("can't own %s: %v", serviceName, err)
+	}
+	return s
+}
+
+// state returns whether the user was prompted and the session closed
+func (s *fakeService) state() (prompted, closed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.prompted, s.session.closed
+}
+
+func stmpItem(secret string, locked bool) *fakeItem {
+	return &fakeItem{
+		path:       "/org/freedesktop/secrets/collection/login/1",
+		attributes: map[string]string{"service": "stmp", "username": "demo"},
+		secret:     secret,
+		locked:     locked,
+	}
+}
+
+func TestLookup(t *testing.T) {
+	address := startBus(t)
+	s := startService(t, address, false, stmpItem("hunter2", false))
+
+	password, err := Lookup(connect(t, address), map[string]string{"service": "stmp", "username": "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "hunter2" {
+		t.Errorf("got password %q", password)
+	}
+	prompted, closed := s.state()
+	if prompted {
+		t.Error("prompted for unlocked item")
+	}
+	if !closed {
+		t.Error("session wasn't closed")
+	}
+}
+
+func TestLookupNotFound(t *testing.T) {
+	address := startBus(t)
+	startService(t, address, false, stmpItem("hunter2", false))
+
+	_, err := Lookup(connect(t, address), map[string]string{"service": "stmp", "username": "other"})
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLookupLocked(t *testing.T) {
+	address := startBus(t)
+	s := startService(t, address, false, stmpItem("hunter2", true))
+
+	password, err := Lookup(connect(t, address), map[string]string{"service": "stmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompted, _ := s.state(); password != "hunter2" || !prompted {
+		t.Errorf("got password %q, prompted %v", password, prompted)
+	}
+}
+
+func TestLookupDismissed(t *testing.T) {
+	address := startBus(t)
+	startService(t, address, true, stmpItem("hunter2", true))
+
+	if _, err := Lookup(connect(t, address), map[string]string{"service": "stmp"}); err != ErrDismissed {
+		t.Errorf("expected ErrDismissed, got %v", err)
+	}
+}
+
+func TestLookupNoService(t *testing.T) {
+	address := startBus(t)
+
+	if _, err := Lookup(connect(t, address), map[string]string{"service": "stmp"}); err == nil {
+		t.Error("expected error without keyring service")
+	}
+}
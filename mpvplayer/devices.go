@@ -0,0 +1,47 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"encoding/json"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+)
+
+// GetAudioDevices lists the audio outputs mpv can play on
+func (p *Player) GetAudioDevices() ([]player.AudioDevice, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	// node properties are returned as json when read as string
+	list, err := p.getPropertyString("audio-device-list")
+	if err != nil {
+		return nil, err
+	}
+	devices := []player.AudioDevice{}
+	if err = json.Unmarshal([]byte(list), &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetAudioDevice returns the name of the selected audio output
+func (p *Player) GetAudioDevice() (string, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.getPropertyString("audio-device")
+}
+
+// SetAudioDevice switches to another audio output while playing. Exclusive
+// mode bypasses the system's mixer, e.g. for bit-perfect output to a DAC.
+func (p *Player) SetAudioDevice(name string, exclusive bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if err := p.instance.SetProperty("audio-exclusive", mpv.FORMAT_FLAG, exclusive); err != nil {
+		return err
+	}
+	return p.instance.SetProperty("audio-device", mpv.FORMAT_STRING, name)
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+)
+
+// EndFileReason is why mpv stopped playing a file, mpv_end_file_reason
+type EndFileReason int32
+
+const (
+	// the file was played to its end
+	EndFileEOF EndFileReason = 0
+	// stopped by a command, e.g. another file was loaded
+	EndFileStop EndFileReason = 2
+	// mpv is shutting down
+	EndFileQuit EndFileReason = 3
+	// the file couldn't be loaded or played
+	EndFileError EndFileReason = 4
+	// the file was a playlist, its entries replaced it
+	EndFileRedirect EndFileReason = 5
+)
+
+func (r EndFileReason) String() string {
+	switch r {
+	case EndFileEOF:
+		return "eof"
+	case EndFileStop:
+		return "stop"
+	case EndFileQuit:
+		return "quit"
+	case EndFileError:
+		return "error"
+	case EndFileRedirect:
+		return "redirect"
+	}
+	return fmt.Sprintf("reason %d", int32(r))
+}
+
+// eventEndFile mirrors the start of libmpv's struct mpv_event_end_file, the
+// data of an EVENT_END_FILE. The fields following these two depend on the
+// mpv version.
+type eventEndFile struct {
+	// mpv_end_file_reason is a C enum
+	reason int32
+	// mpv_error, set for EndFileError
+	error int32
+}
+
+// endFile is a decoded EVENT_END_FILE
+type endFile struct {
+	reason EndFileReason
+	err    error
+}
+
+// decodeEndFile copies the reason and error of an ended file. The event's
+// data belongs to mpv and is only valid until the next WaitEvent call.
+func decodeEndFile(data unsafe.Pointer) endFile {
+	if data == nil {
+		return endFile{}
+	}
+	event := (*eventEndFile)(data)
+	end := endFile{reason: EndFileReason(event.reason)}
+	if end.reason == EndFileError {
+		end.err = mpv.Error(mpv.ERROR_LOADING_FAILED)
+		if event.error < 0 {
+			end.err = mpv.Error(event.error)
+		}
+	}
+	return end
+}
+
+// errorText returns the description of an mpv error without its code
+func errorText(err error) string {
+	text := err.Error()
+	if code, ok := err.(mpv.Error); ok {
+		text = strings.TrimPrefix(text, fmt.Sprintf("MPV_ERROR %d ", int(code)))
+	}
+	return text
+}
+
+// handlePlaybackError retries the current song once. If it fails again, it's
+// marked as failed in the queue and playback continues with the next song,
+// until MaxFailures songs failed in a row.
+// must be called with mutex held
+func (p *Player) handlePlaybackError(err error) {
+	current, ok := p.queue.Current()
+	if !ok {
+		return
+	}
+	p.logger.PrintError("mpv.EventLoop: playing "+current.Id, err)
+
+	if position := p.queue.Position(); p.retryPosition != position {
+		p.logger.Printf("mpv.EventLoop: retrying %s", current.Id)
+		p.retryPosition = position
+		if err := p.loadFile(current.Uri); err != nil {
+			p.logger.PrintError("mpv.EventLoop: retry", err)
+		}
+		return
+	}
+
+	p.retryPosition = -1
+	p.failures++
+	current.Error = errorText(err)
+	p.queue.SetError(current.Error)
+	stop := p.failures >= player.MaxFailures
+	p.sendGuiDataEvent(player.EventFailed, player.PlaybackError{Item: current, Err: err, Stopped: stop})
+
+	if p.prefetched != "" {
+		// mpv continues with the next song on its own, it's stopped when it
+		// starts if too many failed
+		return
+	}
+
+	// a failed song isn't repeated
+	p.queue.Advance(false)
+	next, ok := p.queue.Current()
+	if ok && !stop {
+		if err := p.loadFile(next.Uri); err != nil {
+			p.logger.PrintError("mpv.EventLoop: load next", err)
+		}
+		return
+	}
+	if stop {
+		p.logger.Printf("mpv.EventLoop: stopping, %d songs failed in a row", p.failures)
+	}
+	p.failures = 0
+	p.stopped = true
+	p.sendGuiEvent(player.EventStopped)
+}
+
+// stopAfterFailures stops the song mpv continued with on its own if too many
+// songs failed in a row. It returns true if playback stopped.
+// must be called with mutex held
+func (p *Player) stopAfterFailures() bool {
+	if p.failures < player.MaxFailures {
+		return false
+	}
+	p.logger.Printf("mpv.EventLoop: stopping, %d songs failed in a row", p.failures)
+	p.failures = 0
+	if err := p.stop(); err != nil {
+		p.logger.PrintError("mpv.EventLoop: stop", err)
+	}
+	return true
+}
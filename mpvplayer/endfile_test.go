@@ -0,0 +1,170 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"testing"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+)
+
+func TestDecodeEndFile(t *testing.T) {
+	m := newFakeMpv()
+	m.emitEndFile(EndFileEOF, 0)
+	if end := decodeEndFile(m.WaitEvent(0).Data); end.reason != EndFileEOF || end.err != nil {
+		t.Errorf("unexpected end %+v", end)
+	}
+
+	m.emitEndFile(EndFileError, mpv.ERROR_UNKNOWN_FORMAT)
+	if end := decodeEndFile(m.WaitEvent(0).Data); end.reason != EndFileError || end.err != mpv.ERROR_UNKNOWN_FORMAT {
+		t.Errorf("unexpected end %+v", end)
+	}
+}
+
+// failSong fails the current song and its retry, mpv continuing with the
+// prefetched next song. It returns the reported failure.
+func failSong(t *testing.T, m *fakeMpv, recorder *eventRecorder, id string) player.PlaybackError {
+	t.Helper()
+	m.fail()
+	// mpv starts the next song before the retry replaces it
+	for i := 0; i < 2; i++ {
+		if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != id {
+			t.Fatalf("expected %s retried, got %+v", id, event.Data)
+		}
+	}
+	m.fail()
+	failure := recorder.expect(t, player.EventFailed).Data.(player.PlaybackError)
+	if failure.Item.Id != id || failure.Item.Error == "" || failure.Err == nil {
+		t.Fatalf("unexpected failure %+v", failure)
+	}
+	return failure
+}
+
+func TestPlayerRetriesFailedSong(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	m.breakFile(testItem(1).Uri)
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if failure := failSong(t, m, recorder, "tr-1"); failure.Stopped {
+		t.Error("stopped after one failed song")
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	queue, current, _ := p.GetQueueCopy()
+	if current != 1 || queue[0].Error == "" || queue[1].Error != "" {
+		t.Errorf("expected tr-1 marked as failed, got %+v, current %d", queue, current)
+	}
+	if started := m.startedFiles(); len(started) != 4 || started[2] != "http://test/1" {
+		t.Errorf("expected tr-1 retried once, started %v", started)
+	}
+
+	// the retry of the last song, which failed while playing, succeeds
+	m.fail()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 retried, got %+v", event.Data)
+	}
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+	if queue, _, _ := p.GetQueueCopy(); queue[1].Error != "" {
+		t.Errorf("expected tr-2 not marked, got %+v", queue[1])
+	}
+}
+
+func TestPlayerStopsAfterFailures(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	// the server is gone, no song loads
+	for i := 1; i <= player.MaxFailures+2; i++ {
+		m.breakFile(testItem(i).Uri)
+		p.AddToQueue(testItem(i))
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	for i := 1; i < player.MaxFailures; i++ {
+		failSong(t, m, recorder, testItem(i).Id)
+		recorder.expect(t, player.EventPlaying)
+	}
+	if failure := failSong(t, m, recorder, testItem(player.MaxFailures).Id); !failure.Stopped {
+		t.Error("expected playback stopped")
+	}
+	recorder.expect(t, player.EventStopped)
+	if queue, current, _ := p.GetQueueCopy(); current != player.MaxFailures {
+		t.Errorf("expected the song after the failed ones current, got %+v, current %d", queue, current)
+	}
+
+	// play goes on with the next song
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != testItem(player.MaxFailures+1).Id {
+		t.Errorf("unexpected song playing %+v", event.Data)
+	}
+}
+
+func TestPlayerRetriesDuplicateSong(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	// the same broken song twice in a row, each one is retried
+	m.breakFile(testItem(1).Uri)
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	failSong(t, m, recorder, "tr-1")
+	recorder.expect(t, player.EventPlaying)
+	failSong(t, m, recorder, "tr-1")
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	if queue, current, _ := p.GetQueueCopy(); current != 2 || queue[0].Error == "" || queue[1].Error == "" {
+		t.Errorf("expected both tr-1 marked as failed, got %+v, current %d", queue, current)
+	}
+}
+
+func TestPlayerCountsFailuresInARow(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	// broken songs with good ones in between
+	for i := 1; i <= 2*player.MaxFailures; i++ {
+		if i%2 == 1 {
+			m.breakFile(testItem(i).Uri)
+		}
+		p.AddToQueue(testItem(i))
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	for i := 1; i < 2*player.MaxFailures; i += 2 {
+		if failure := failSong(t, m, recorder, testItem(i).Id); failure.Stopped {
+			t.Fatalf("stopped after %s although the songs before it loaded", failure.Item.Id)
+		}
+		// the good song loads and is skipped before it ends
+		if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != testItem(i+1).Id {
+			t.Fatalf("expected %s playing, got %+v", testItem(i+1).Id, event.Data)
+		}
+		if i+2 < 2*player.MaxFailures {
+			if err := p.NextTrack(); err != nil {
+				t.Fatal(err)
+			}
+			recorder.expect(t, player.EventPlaying)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spezifisch/stmps/player"
+)
+
+// equalizerLavfi returns the lavfi filter for mpv's audio filter chain, empty
+// if the equalizer is flat
+func equalizerLavfi(e player.Equalizer) string {
+	bands := []string{}
+	for i, gain := range e {
+		if gain == 0 {
+			continue
+		}
+		bands = append(bands, fmt.Sprintf("equalizer=f=%d:t=o:w=1:g=%.1f", player.EqualizerFrequencies[i], gain))
+	}
+	if len(bands) == 0 {
+		return ""
+	}
+	return "lavfi=[" + strings.Join(bands, ",") + "]"
+}
+
+// label of the equalizer in mpv's audio filter chain
+const equalizerFilter = "@equalizer"
+
+func (p *Player) GetEqualizer() player.Equalizer {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.equalizer
+}
+
+// SetEqualizer applies the equalizer to the playing song right away
+func (p *Player) SetEqualizer(equalizer player.Equalizer) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	equalizer = equalizer.Clamp()
+	if err := p.setAudioFilter(equalizerFilter, equalizerLavfi(equalizer)); err != nil {
+		return err
+	}
+	p.equalizer = equalizer
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"testing"
+
+	"github.com/spezifisch/stmps/player"
+)
+
+func TestEqualizerFilter(t *testing.T) {
+	if filter := equalizerLavfi(player.Equalizer{}); filter != "" {
+		t.Errorf("flat equalizer should have no filter, got %q", filter)
+	}
+
+	equalizer := player.Equalizer{3, 0, 0, 0, 0, 0, 0, 0, 0, -2.5}
+	expected := "lavfi=[equalizer=f=31:t=o:w=1:g=3.0,equalizer=f=16000:t=o:w=1:g=-2.5]"
+	if filter := equalizerLavfi(equalizer); filter != expected {
+		t.Errorf("expected %q, got %q", expected, filter)
+	}
+
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+// setAudioFilter puts filter into mpv's audio filter chain under label,
+// replacing the filter that had the label before. An empty filter removes it.
+// must be called with mutex held
+func (p *Player) setAudioFilter(label, filter string) error {
+	if filter == p.audioFilters[label] {
+		return nil
+	}
+
+	if _, ok := p.audioFilters[label]; ok {
+		if err := p.instance.Command([]string{"af", "remove", label}); err != nil {
+			return err
+		}
+		delete(p.audioFilters, label)
+	}
+	if filter == "" {
+		return nil
+	}
+	if err := p.instance.Command([]string{"af", "add", label + ":" + filter}); err != nil {
+		return err
+	}
+	p.audioFilters[label] = filter
+	return nil
+}
@@ -4,161 +4,277 @@
 package mpvplayer
 
 import (
+	"strconv"
+
 	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
 )
 
 func (p *Player) EventLoop() {
-	if err := p.instance.ObserveProperty(0, "playback-time", mpv.FORMAT_INT64); err != nil {
-		p.logger.PrintError("Observe1", err)
-	}
-	if err := p.instance.ObserveProperty(0, "duration", mpv.FORMAT_INT64); err != nil {
-		p.logger.PrintError("Observe2", err)
-	}
-	if err := p.instance.ObserveProperty(0, "volume", mpv.FORMAT_INT64); err != nil {
-		p.logger.PrintError("Observe3", err)
+	for _, property := range observedProperties {
+		if err := p.instance.ObserveProperty(0, property.name, property.format); err != nil {
+			p.logger.PrintError("Observe "+property.name, err)
+		}
 	}
 
 	for evt := range p.mpvEvents {
 		if evt == nil {
 			// quit signal
 			break
-		} else if evt.Event_Id == mpv.EVENT_PROPERTY_CHANGE {
-			// one of our observed properties changed. which one is probably extractable from evt.Data.. somehow.
-
-			position, err := p.getPropertyInt64("playback-time")
-			if err != nil {
-				p.logger.Printf("mpv.EventLoop (%s): GetProperty %s -- %s", evt.Event_Id.String(), "playback-time", err.Error())
-			}
-			duration, err := p.getPropertyInt64("duration")
-			if err != nil {
-				p.logger.Printf("mpv.EventLoop (%s): GetProperty %s -- %s", evt.Event_Id.String(), "duration", err.Error())
-			}
-			volume, err := p.getPropertyInt64("volume")
-			if err != nil {
-				p.logger.Printf("mpv.EventLoop (%s): GetProperty %s -- %s", evt.Event_Id.String(), "volume", err.Error())
-			}
+		}
 
-			statusData := StatusData{
-				Volume:   volume,
-				Position: position,
-				Duration: duration,
-			}
-			p.remoteState.timePos = float64(statusData.Position)
-			p.sendGuiDataEvent(EventStatus, statusData)
-		} else if evt.Event_Id == mpv.EVENT_END_FILE && !p.replaceInProgress {
-			// we don't want to update anything if we're in the process of replacing the current track
-
-			if p.stopped {
-				// this is feedback for a user-requested stop
-				// don't delete the first track so it gets started from the beginning when pressing play
-				p.logger.Print("mpv.EventLoop: mpv stopped")
-				p.stopped = true
-				p.sendGuiEvent(EventStopped)
-			} else {
-				// advance queue and play next track
-				if len(p.queue) > 0 {
-					p.queue = p.queue[1:]
-				}
-
-				if len(p.queue) > 0 {
-					if err := p.instance.Command([]string{"loadfile", p.queue[0].Uri}); err != nil {
-						p.logger.PrintError("mpv.EventLoop: load next", err)
-					}
-				} else {
-					// no remaining tracks
-					p.logger.Print("mpv.EventLoop: stopping (auto)")
-					p.stopped = true
-					p.sendGuiEvent(EventStopped)
-				}
-			}
-		} else if evt.Event_Id == mpv.EVENT_START_FILE {
-			p.replaceInProgress = false
-			p.stopped = false
+		// mpv sends an event at least every second
+		p.mutex.Lock()
+		p.tickSleep()
+		p.unlock()
 
-			currentSong := QueueItem{}
-			if len(p.queue) > 0 {
-				currentSong = p.queue[0]
-			}
-
-			if paused, err := p.IsPaused(); err != nil {
-				p.logger.PrintError("mpv.EventLoop: IsPaused", err)
-			} else if !paused {
-				p.sendGuiDataEvent(EventPlaying, currentSong)
-			} else {
-				p.sendGuiDataEvent(EventPaused, currentSong)
-			}
-		} else if evt.Event_Id == mpv.EVENT_IDLE || evt.Event_Id == mpv.EVENT_NONE {
+		if evt.id == mpv.EVENT_PROPERTY_CHANGE {
+			p.mutex.Lock()
+			p.handlePropertyChange(evt.property)
+			p.unlock()
+		} else if evt.id == mpv.EVENT_SEEK {
+			p.mutex.Lock()
+			p.seeking = true
+			p.seekRestarted = false
+			p.unlock()
+		} else if evt.id == mpv.EVENT_PLAYBACK_RESTART {
+			p.mutex.Lock()
+			// the new position is reported with the next change of
+			// playback-time, mpv updates it after the restart
+			p.seekRestarted = p.seeking
+			p.unlock()
+		} else if evt.id == mpv.EVENT_END_FILE {
+			p.mutex.Lock()
+			p.handleEndFile(evt.endFile)
+			p.unlock()
+		} else if evt.id == mpv.EVENT_START_FILE {
+			p.mutex.Lock()
+			p.handleStartFile()
+			p.unlock()
+		} else if evt.id == mpv.EVENT_FILE_LOADED {
+			// the stream's tags are known now
+			p.mutex.Lock()
+			p.handleFileLoaded()
+			p.unlock()
+		} else if evt.id == mpv.EVENT_IDLE || evt.id == mpv.EVENT_NONE {
 			continue
 		} else {
-			p.logger.Printf("mpv.EventLoop: unhandled event id %v", evt.Event_Id)
+			p.logger.Printf("mpv.EventLoop: unhandled event id %v", evt.id)
 			continue
 		}
 	}
 }
 
-func (p *Player) sendGuiEvent(typ UiEventType) {
-	if p.eventConsumer != nil {
-		p.eventConsumer.SendEvent(UiEvent{
-			Type: typ,
-			Data: nil,
-		})
+// must be called with mutex held
+func (p *Player) handleEndFile(end endFile) {
+	if p.replaceInProgress {
+		// we don't want to update anything if we're in the process of replacing the current track
+		return
+	}
+
+	if p.stopped {
+		// this is feedback for a user-requested stop
+		// don't delete the first track so it gets started from the beginning when pressing play
+		p.logger.Print("mpv.EventLoop: mpv stopped")
+		if err := p.endFade(); err != nil {
+			p.logger.PrintError("mpv.EventLoop: end fade out", err)
+		}
+		p.sendGuiEvent(player.EventStopped)
+		return
+	}
+
+	switch end.reason {
+	case EndFileError:
+		p.handlePlaybackError(end.err)
+		return
+	case EndFileStop, EndFileQuit, EndFileRedirect:
+		// another file was loaded in its place, mpv is shutting down or the
+		// file was a playlist that mpv continues with
+		p.logger.Printf("mpv.EventLoop: file ended (%s)", end.reason)
+		return
+	}
+
+	// the song played to its end
+	p.retryPosition = -1
+	p.failures = 0
+
+	if p.prefetched != "" {
+		// mpv continues with the next track on its own, the queue advances
+		// when it starts
+		return
+	}
+
+	if p.handleSleepEnd() {
+		return
+	}
+
+	// advance queue and play next track
+	p.queue.Advance(true)
+
+	if next, ok := p.queue.Current(); ok {
+		if err := p.loadFile(next.Uri); err != nil {
+			p.logger.PrintError("mpv.EventLoop: load next", err)
+		}
+	} else {
+		// no remaining tracks
+		p.logger.Print("mpv.EventLoop: stopping (auto)")
+		p.stopped = true
+		p.sendGuiEvent(player.EventStopped)
+	}
+}
+
+// must be called with mutex held
+func (p *Player) handleFileLoaded() {
+	// the song may have failed before, loading it ends a row of failures. a
+	// retry that loaded isn't retried again if it fails while playing.
+	p.failures = 0
+	if p.queue.Position() != p.retryPosition {
+		p.retryPosition = -1
+	}
+	p.queue.SetError("")
+	p.applyFallbackGain()
+
+	if p.startPosition > 0 {
+		position := strconv.FormatFloat(p.startPosition, 'f', 3, 64)
+		p.startPosition = 0
+		if err := p.instance.Command([]string{"seek", position, "absolute"}); err != nil {
+			p.logger.PrintError("mpv.EventLoop: seek to start position", err)
+		}
+	}
+}
+
+// must be called with mutex held
+func (p *Player) handleStartFile() {
+	p.replaceInProgress = false
+	p.stopped = false
+	p.seeking = false
+	p.seekRestarted = false
+
+	p.remoteState.timePos = 0
+
+	if next, ok := p.queue.Next(true); ok && p.prefetched != "" {
+		// follow mpv if it switched to the prefetched track. the position
+		// tells apart the same track queued twice in a row.
+		path, err := p.getPropertyString("path")
+		if err != nil {
+			p.logger.PrintError("mpv.EventLoop: path", err)
+		}
+		position, err := p.getPropertyInt64("playlist-pos")
+		if err != nil {
+			p.logger.PrintError("mpv.EventLoop: playlist-pos", err)
+		}
+		current, _ := p.queue.Current()
+		if path == next.Uri && (position > 0 || path != current.Uri) {
+			p.queue.Advance(true)
+		}
+	}
+
+	if p.stopAfterFailures() {
+		return
 	}
 
-	p.sendRemoteEvent(typ, nil)
+	// remove the finished track from mpv's playlist and prefetch the next one
+	if p.prefetched != "" {
+		if err := p.instance.Command([]string{"playlist-clear"}); err != nil {
+			p.logger.PrintError("mpv.EventLoop: playlist-clear", err)
+		}
+		p.prefetched = ""
+	}
+	p.prefetchNext()
+
+	// the new song may be of another content kind
+	if err := p.applySpeed(); err != nil {
+		p.logger.PrintError("mpv.EventLoop: applySpeed", err)
+	}
+
+	currentSong, _ := p.queue.Current()
+
+	if paused, err := p.IsPaused(); err != nil {
+		p.logger.PrintError("mpv.EventLoop: IsPaused", err)
+	} else if !paused {
+		p.sendPlayState(player.EventPlaying, currentSong)
+	} else {
+		p.sendPlayState(player.EventPaused, currentSong)
+	}
 }
 
-func (p *Player) sendGuiDataEvent(typ UiEventType, data interface{}) {
+// sendPlayState tells the gui whether the current song is playing or paused.
+// must be called with mutex held
+func (p *Player) sendPlayState(typ player.UiEventType, song player.QueueItem) {
+	p.reportedPaused = typ == player.EventPaused
+	p.sendGuiDataEvent(typ, song)
+}
+
+// sendGuiEvent queues an event, it's sent when the mutex is released.
+// must be called with mutex held
+func (p *Player) sendGuiEvent(typ player.UiEventType) {
+	p.sendGuiDataEvent(typ, nil)
+}
+
+// must be called with mutex held
+func (p *Player) sendGuiDataEvent(typ player.UiEventType, data interface{}) {
+	p.pendingEvents = append(p.pendingEvents, player.UiEvent{
+		Type: typ,
+		Data: data,
+	})
+}
+
+// dispatchEvent sends an event to the gui and the remote callbacks.
+// must be called without holding the mutex
+func (p *Player) dispatchEvent(event player.UiEvent) {
 	if p.eventConsumer != nil {
-		p.eventConsumer.SendEvent(UiEvent{
-			Type: typ,
-			Data: data,
-		})
+		p.eventConsumer.SendEvent(event)
 	}
 
-	p.sendRemoteEvent(typ, data)
+	p.sendRemoteEvent(event.Type, event.Data)
 }
 
-func (p *Player) sendRemoteEvent(typ UiEventType, data interface{}) {
+func (p *Player) sendRemoteEvent(typ player.UiEventType, data interface{}) {
 	switch typ {
-	case EventStopped:
+	case player.EventStopped:
 		defer func() {
 			for _, cb := range p.cbOnStopped {
 				cb()
 			}
 		}()
 
-	case EventUnpaused:
+	case player.EventUnpaused:
 		fallthrough
-	case EventPlaying:
+	case player.EventPlaying:
 		defer func() {
 			if data != nil {
-				p.sendSongChange(data.(QueueItem))
+				p.sendSongChange(data.(player.QueueItem))
 			}
 			for _, cb := range p.cbOnPlaying {
 				cb()
 			}
 		}()
 
-	case EventPaused:
+	case player.EventPaused:
 		defer func() {
 			if data != nil {
-				p.sendSongChange(data.(QueueItem))
+				p.sendSongChange(data.(player.QueueItem))
 			}
 			for _, cb := range p.cbOnPaused {
 				cb()
 			}
 		}()
 
-	case EventStatus:
+	case player.EventSeeked:
 		defer func() {
 			for _, cb := range p.cbOnSeek {
 				cb()
 			}
 		}()
+
+	case player.EventModes:
+		for _, cb := range p.cbOnModeChange {
+			cb()
+		}
 	}
 }
 
-func (p *Player) sendSongChange(track QueueItem) {
+func (p *Player) sendSongChange(track player.QueueItem) {
 	for _, cb := range p.cbOnSongChange {
 		cb(&track)
 	}
@@ -25,3 +25,13 @@ func (p *Player) getPropertyBool(name string) (bool, error) {
 	}
 	return value.(bool), err
 }
+
+func (p *Player) getPropertyString(name string) (string, error) {
+	value, err := p.instance.GetProperty(name, mpv.FORMAT_STRING)
+	if err != nil {
+		return "", err
+	} else if value == nil {
+		return "", errors.New("nil value")
+	}
+	return value.(string), err
+}
@@ -5,41 +5,104 @@ package mpvplayer
 
 import (
 	"errors"
+	"math"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/spezifisch/go-mpv"
 	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
 	"github.com/spezifisch/stmps/remote"
 )
 
-type PlayerQueue []QueueItem
-
+// mpvInstance is the part of the libmpv client API used by the player, it's
+// implemented by *mpv.Mpv and by a fake in the tests
+type mpvInstance interface {
+	Command(command []string) error
+	SetProperty(name string, format mpv.Format, data interface{}) error
+	GetProperty(name string, format mpv.Format) (interface{}, error)
+	ObserveProperty(replyUserdata uint64, name string, format mpv.Format) error
+	WaitEvent(timeout float32) *mpv.Event
+	TerminateDestroy()
+}
+
+// Player plays the queue with mpv. The exported methods are its commands and
+// may be called from any goroutine. Results are reported as UiEvents to the
+// EventConsumer and to the remote callbacks, which are called without holding
+// the mutex, so they may call back into the player.
 type Player struct {
-	instance      *mpv.Mpv
-	mpvEvents     chan *mpv.Event
-	eventConsumer EventConsumer
-	queue         PlayerQueue
+	instance      mpvInstance
+	mpvEvents     chan *mpvEvent
+	eventConsumer player.EventConsumer
 	logger        logger.LoggerInterface
 
+	// guards everything below, commands come from the gui, background and
+	// remote contexts while the event loop reacts to mpv
+	mutex sync.Mutex
+
+	// played songs, the current song and upcoming songs
+	queue player.Queue
+
 	replaceInProgress bool
 	stopped           bool
+	// uri of the next track appended to mpv's playlist
+	prefetched string
+	// seconds to seek to once the loaded track can be seeked in
+	startPosition float64
+
+	// sleep timer, the deadline is zero if not set
+	sleepDeadline    time.Time
+	sleepEndOfAlbum  bool
+	stopAfterCurrent bool
+	// sleep state as last sent to the gui
+	sleep player.SleepState
+
+	// position in play order of the song that failed once and is being
+	// retried, -1 if none. the same song may follow itself in the queue.
+	retryPosition int
+	// songs that failed in a row
+	failures int
 
 	// player state
 	remoteState struct {
 		timePos float64
 	}
-
-	// callbacks
+	// observed properties as last sent to the gui
+	status player.StatusData
+	cache  player.CacheState
+	// whether the last play state sent to the gui was paused
+	reportedPaused bool
+	// between mpv starting a seek and the position after it being known
+	seeking bool
+	// playback resumed after the seek, the next position is the new one
+	seekRestarted bool
+
+	replayGain player.ReplayGain
+	equalizer  player.Equalizer
+	// playback speed by content kind, 1 if missing
+	speeds          map[player.ContentKind]float64
+	speed           float64
+	pitchCorrection bool
+	// audio filters we added to mpv's chain by label
+	audioFilters map[string]string
+
+	// events to send once the mutex is released
+	pendingEvents []player.UiEvent
+	dispatching   bool
+
+	// callbacks, registered before the event loop is started
 	cbOnPaused     []func()
 	cbOnStopped    []func()
 	cbOnPlaying    []func()
 	cbOnSeek       []func()
 	cbOnSongChange []func(remote.TrackInterface)
+	cbOnModeChange []func()
 }
 
-var _ remote.ControlledPlayer = (*Player)(nil)
+var _ player.PlayerInterface = (*Player)(nil)
 
-func NewPlayer(logger logger.LoggerInterface) (player *Player, err error) {
+func NewPlayer(logger logger.LoggerInterface) (p *Player, err error) {
 	m := mpv.Create()
 
 	// cargo-cult what supersonic does
@@ -58,29 +121,66 @@ func NewPlayer(logger logger.LoggerInterface) (player *Player, err error) {
 	if err = m.SetOptionString("audio-client-name", "stmp"); err != nil {
 		return
 	}
+	// the next track is appended to mpv's playlist, preload it and play it
+	// without a gap
+	if err = m.SetOptionString("prefetch-playlist", "yes"); err != nil {
+		return
+	}
+	if err = m.SetOptionString("gapless-audio", "yes"); err != nil {
+		return
+	}
+	// pitch correction is done by our own filter, see SetPitchCorrection
+	if err = m.SetOptionString("audio-pitch-correction", "no"); err != nil {
+		return
+	}
 
 	if err = m.Initialize(); err != nil {
 		return
 	}
 
-	player = &Player{
-		instance:          m,
-		mpvEvents:         make(chan *mpv.Event),
+	p = newPlayer(m, logger)
+	return
+}
+
+func newPlayer(instance mpvInstance, logger logger.LoggerInterface) *Player {
+	p := &Player{
+		instance:          instance,
+		mpvEvents:         make(chan *mpvEvent),
 		eventConsumer:     nil, // must be set by calling RegisterEventConsumer()
-		queue:             make([]QueueItem, 0),
+		queue:             player.NewQueue(),
+		audioFilters:      make(map[string]string),
+		speeds:            make(map[player.ContentKind]float64),
+		speed:             1,
 		logger:            logger,
 		replaceInProgress: false,
 		stopped:           true,
+		retryPosition:     -1,
 	}
 
-	go player.mpvEngineEventHandler(m)
-	return
+	go p.mpvEngineEventHandler(instance)
+	return p
+}
+
+// mpvEvent is an mpv event with its data decoded
+type mpvEvent struct {
+	id mpv.EventId
+	// for EVENT_PROPERTY_CHANGE
+	property propertyChange
+	// for EVENT_END_FILE
+	endFile endFile
 }
 
-func (p *Player) mpvEngineEventHandler(instance *mpv.Mpv) {
+func (p *Player) mpvEngineEventHandler(instance mpvInstance) {
 	for {
 		evt := instance.WaitEvent(1)
-		p.mpvEvents <- evt
+		event := &mpvEvent{id: evt.Event_Id}
+		if evt.Event_Id == mpv.EVENT_PROPERTY_CHANGE {
+			// the data is only valid until the next WaitEvent
+			event.property = decodeProperty(evt.Data)
+		} else if evt.Event_Id == mpv.EVENT_END_FILE {
+			event.endFile = decodeEndFile(evt.Data)
+		}
+		p.mpvEvents <- event
 	}
 }
 
@@ -89,62 +189,214 @@ func (p *Player) Quit() {
 	p.instance.TerminateDestroy()
 }
 
-func (p *Player) RegisterEventConsumer(consumer EventConsumer) {
+func (p *Player) RegisterEventConsumer(consumer player.EventConsumer) {
 	p.eventConsumer = consumer
 }
 
-func (p *Player) PlayNextTrack() error {
-	if len(p.queue) >= 1 {
-		// advance queue if any tracks left
-		p.queue = p.queue[1:]
-
-		if len(p.queue) > 0 {
-			// replace currently playing song with next song
-			if loaded, err := p.IsSongLoaded(); err != nil {
-				p.logger.PrintError("PlayNextTrack", err)
-			} else if loaded {
-				p.replaceInProgress = true
-				if err := p.temporaryStop(); err != nil {
-					p.logger.PrintError("temporaryStop", err)
-				}
-				return p.instance.Command([]string{"loadfile", p.queue[0].Uri})
-			}
-		} else {
-			// stop with empty queue
-			if err := p.Stop(); err != nil {
-				p.logger.PrintError("Stop", err)
-			}
+// unlock releases the mutex and sends the events queued while it was held.
+// Only one goroutine sends events at a time, so they arrive in order. Events
+// queued by the consumer or callbacks meanwhile are sent by the same loop.
+func (p *Player) unlock() {
+	if p.dispatching {
+		p.mutex.Unlock()
+		return
+	}
+	p.dispatching = true
+	for len(p.pendingEvents) > 0 {
+		events := p.pendingEvents
+		p.pendingEvents = nil
+		p.mutex.Unlock()
+
+		for _, event := range events {
+			p.dispatchEvent(event)
 		}
-	} else {
-		// queue empty
-		if err := p.Stop(); err != nil {
-			p.logger.PrintError("Stop", err)
+
+		p.mutex.Lock()
+	}
+	p.dispatching = false
+	p.mutex.Unlock()
+}
+
+func (p *Player) PlayNextTrack() error {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.playNextTrack()
+}
+
+// must be called with mutex held
+func (p *Player) playNextTrack() error {
+	// advance queue if any tracks left
+	p.queue.Advance(false)
+
+	if next, ok := p.queue.Current(); ok {
+		// replace currently playing song with next song
+		return p.replaceCurrent(next)
+	}
+
+	// stop at the end of the queue
+	if err := p.stop(); err != nil {
+		p.logger.PrintError("Stop", err)
+	}
+	return nil
+}
+
+// replaceCurrent plays item in place of the loaded song. If no song is
+// loaded it's started with the next play.
+// must be called with mutex held
+func (p *Player) replaceCurrent(item player.QueueItem) error {
+	if loaded, err := p.IsSongLoaded(); err != nil {
+		p.logger.PrintError("replaceCurrent", err)
+	} else if loaded {
+		p.replaceInProgress = true
+		if err := p.temporaryStop(); err != nil {
+			p.logger.PrintError("temporaryStop", err)
 		}
+		return p.loadFile(item.Uri)
 	}
 	return nil
 }
 
-func (p *Player) PlayUri(id string, uri string, title string, artist string, duration int) error {
-	p.queue = []QueueItem{{id, uri, title, artist, duration}}
+func (p *Player) PlayUri(item *player.QueueItem) error {
+	return p.PlayItems(player.PlayerQueue{*item})
+}
+
+// PlayItems replaces the songs after the current one with items and plays the
+// first of them. Played songs stay in the queue.
+func (p *Player) PlayItems(items player.PlayerQueue) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.ReplaceUpcoming(items...)
+	return p.playCurrent()
+}
+
+// PlayQueueItem plays the song at index in the queue
+func (p *Player) PlayQueueItem(index int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if index < 0 || index >= p.queue.Len() {
+		return errors.New("invalid queue entry")
+	}
+	p.queue.JumpTo(index)
+	return p.playCurrent()
+}
+
+// LoadQueue replaces the queue, e.g. with the one of the previous session.
+// The song at current is loaded paused at position seconds, played tells
+// which songs were played before.
+func (p *Player) LoadQueue(items player.PlayerQueue, current int, played []bool, position float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.queue.Restore(items, current, played)
+	item, ok := p.queue.Current()
+	if !ok {
+		return nil
+	}
+
+	if err := p.instance.SetProperty("pause", mpv.FORMAT_FLAG, true); err != nil {
+		return err
+	}
+	p.replaceInProgress = true
+	p.stopped = false
+	if err := p.loadFile(item.Uri); err != nil {
+		return err
+	}
+	p.startPosition = position
+	return nil
+}
+
+// playCurrent starts the current song from the beginning, also when paused or
+// stopped.
+// must be called with mutex held
+func (p *Player) playCurrent() error {
+	item, ok := p.queue.Current()
+	if !ok {
+		return nil
+	}
+
 	p.replaceInProgress = true
 	if ip, e := p.IsPaused(); ip && e == nil {
-		if err := p.Pause(); err != nil {
+		if err := p.pause(); err != nil {
 			p.logger.PrintError("Pause", err)
 		}
 	}
-	return p.instance.Command([]string{"loadfile", uri})
+	return p.loadFile(item.Uri)
 }
 
 func (p *Player) Stop() error {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.stop()
+}
+
+// must be called with mutex held
+func (p *Player) stop() error {
 	p.logger.Printf("stopping (user)")
 	p.stopped = true
-	return p.instance.Command([]string{"stop"})
+	return p.temporaryStop()
 }
 
+// temporaryStop stops playback, which also clears mpv's playlist.
+// must be called with mutex held
 func (p *Player) temporaryStop() error {
+	p.prefetched = ""
 	return p.instance.Command([]string{"stop"})
 }
 
+// loadFile replaces mpv's playlist with uri and plays it. The next track is
+// appended once it started.
+// must be called with mutex held
+func (p *Player) loadFile(uri string) error {
+	p.prefetched = ""
+	p.startPosition = 0
+	return p.instance.Command([]string{"loadfile", uri})
+}
+
+// prefetchNext keeps the next queue item appended to mpv's playlist, so that
+// mpv can preload it and switch to it without a gap.
+// must be called with mutex held
+func (p *Player) prefetchNext() {
+	if p.stopped || p.replaceInProgress {
+		// the playlist is replaced anyway, the next track follows on start
+		return
+	}
+
+	next := ""
+	if item, ok := p.queue.Next(true); ok && !p.stopsAfterCurrent() {
+		next = item.Uri
+	}
+	if next == p.prefetched {
+		return
+	}
+
+	if p.prefetched != "" {
+		// removes everything but the current file
+		if err := p.instance.Command([]string{"playlist-clear"}); err != nil {
+			p.logger.PrintError("playlist-clear", err)
+			return
+		}
+		p.prefetched = ""
+	}
+	if next == "" {
+		return
+	}
+	if loaded, err := p.IsSongLoaded(); err != nil || !loaded {
+		// an idle mpv would just keep the file in its playlist
+		return
+	}
+	if err := p.instance.Command([]string{"loadfile", next, "append"}); err != nil {
+		p.logger.PrintError("prefetch", err)
+		return
+	}
+	p.prefetched = next
+}
+
 func (p *Player) IsSongLoaded() (bool, error) {
 	idle, err := p.getPropertyBool("idle-active")
 	return !idle, err
@@ -173,7 +425,14 @@ func (p *Player) Test() {
 // If a song is playing, it is paused. If a song is paused, playing resumes.
 // If stopped, the song starts playing.
 // The state after the toggle is returned, or an error.
-func (p *Player) Pause() (err error) {
+func (p *Player) Pause() error {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.pause()
+}
+
+// must be called with mutex held
+func (p *Player) pause() (err error) {
 	loaded, err := p.IsSongLoaded()
 	if err != nil {
 		return
@@ -192,20 +451,16 @@ func (p *Player) Pause() (err error) {
 		}
 		paused = !paused
 
-		currentSong := QueueItem{}
-		if len(p.queue) > 0 {
-			currentSong = p.queue[0]
-		}
+		currentSong, _ := p.queue.Current()
 
 		if paused {
-			p.sendGuiDataEvent(EventPaused, currentSong)
+			p.sendPlayState(player.EventPaused, currentSong)
 		} else {
-			p.sendGuiDataEvent(EventUnpaused, currentSong)
+			p.sendPlayState(player.EventUnpaused, currentSong)
 		}
 	} else {
-		if len(p.queue) > 0 {
-			currentSong := p.queue[0]
-			err = p.instance.Command([]string{"loadfile", currentSong.Uri})
+		if currentSong, ok := p.queue.Current(); ok {
+			err = p.loadFile(currentSong.Uri)
 			if err != nil {
 				p.logger.PrintError("loadfile", err)
 				return
@@ -220,11 +475,11 @@ func (p *Player) Pause() (err error) {
 				// mpv will send start file event which also sends the gui event
 				//p.sendGuiDataEvent(EventPlaying, currentSong)
 			} else {
-				p.sendGuiDataEvent(EventUnpaused, currentSong)
+				p.sendPlayState(player.EventUnpaused, currentSong)
 			}
 		} else {
 			p.stopped = true
-			p.sendGuiEvent(EventStopped)
+			p.sendGuiEvent(player.EventStopped)
 		}
 	}
 
@@ -241,6 +496,14 @@ func (p *Player) SetVolume(percentValue int) error {
 	return p.instance.SetProperty("volume", mpv.FORMAT_INT64, percentValue)
 }
 
+// GetVolume returns the volume in percent as last reported by mpv. The sleep
+// timer's fade out doesn't change it.
+func (p *Player) GetVolume() int {
+	p.mutex.Lock()
+	defer p.unlock()
+	return int(p.status.Volume)
+}
+
 func (p *Player) AdjustVolume(increment int) error {
 	volume, err := p.getPropertyInt64("volume")
 	if err != nil {
@@ -254,62 +517,108 @@ func (p *Player) Seek(increment int) error {
 	return p.instance.Command([]string{"seek", strconv.Itoa(increment)})
 }
 
-// accessed from gui context
 func (p *Player) ClearQueue() {
-	if err := p.Stop(); err != nil {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.clearQueue()
+}
+
+// must be called with mutex held
+func (p *Player) clearQueue() {
+	if err := p.stop(); err != nil {
 		p.logger.PrintError("Stop", err)
 	}
-	p.queue = make([]QueueItem, 0) // TODO mutex queue access
+	p.queue.Clear()
 }
 
 func (p *Player) DeleteQueueItem(index int) {
-	// TODO mutex queue access
-	if index >= len(p.queue) {
-		p.logger.Printf("DeleteQueueItem bad index %d (len %d)", index, len(p.queue))
-	} else if len(p.queue) > 1 {
-		if index == 0 {
-			if err := p.PlayNextTrack(); err != nil {
-				p.logger.PrintError("PlayNextTrack", err)
-			}
-		} else {
-			p.queue = append(p.queue[:index], p.queue[index+1:]...)
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if index < 0 || index >= p.queue.Len() {
+		p.logger.Printf("DeleteQueueItem bad index %d (len %d)", index, p.queue.Len())
+		return
+	}
+
+	if !p.queue.Remove(index) {
+		p.prefetchNext()
+	} else if next, ok := p.queue.Current(); ok {
+		// the current song, continue with the next one
+		if err := p.replaceCurrent(next); err != nil {
+			p.logger.PrintError("replaceCurrent", err)
 		}
-	} else {
-		p.ClearQueue()
+	} else if err := p.stop(); err != nil {
+		p.logger.PrintError("Stop", err)
 	}
 }
 
-func (p *Player) AddToQueue(item *QueueItem) {
-	p.queue = append(p.queue, *item)
+func (p *Player) AddToQueue(item *player.QueueItem) {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.queue.Add(*item)
+	p.prefetchNext()
 }
 
-func (p *Player) GetQueueItem(index int) (QueueItem, error) {
-	if index < 0 || index >= len(p.queue) {
-		return QueueItem{}, errors.New("invalid queue entry")
+// InsertNext adds item to the queue right after the current song
+func (p *Player) InsertNext(item *player.QueueItem) {
+	p.mutex.Lock()
+	defer p.unlock()
+	p.queue.InsertNext(*item)
+	p.prefetchNext()
+}
+
+// MoveQueueItem moves the song at index from to index to. The current song
+// keeps playing.
+func (p *Player) MoveQueueItem(from, to int) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if from < 0 || from >= p.queue.Len() || to < 0 || to >= p.queue.Len() {
+		return errors.New("invalid queue entry")
 	}
-	return p.queue[index], nil
+	p.queue.Move(from, to)
+	p.prefetchNext()
+	return nil
 }
 
-func (p *Player) GetQueueCopy() PlayerQueue {
-	cpy := make(PlayerQueue, len(p.queue))
-	copy(cpy, p.queue)
-	return cpy
+func (p *Player) GetQueueItem(index int) (player.QueueItem, error) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	item, ok := p.queue.Item(index)
+	if !ok {
+		return player.QueueItem{}, errors.New("invalid queue entry")
+	}
+	return item, nil
+}
+
+// GetQueueCopy returns the queue including the played songs, the index of the
+// current song and which songs were played. The order differs from the play
+// order when shuffling.
+func (p *Player) GetQueueCopy() (queue player.PlayerQueue, current int, played []bool) {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	return p.queue.Items(), p.queue.CurrentIndex(), p.queue.Played()
 }
 
 // accessed from background context
-func (p *Player) GetPlayingTrack() (QueueItem, error) {
+func (p *Player) GetPlayingTrack() (player.QueueItem, error) {
 	paused, err := p.IsPaused()
 	if err != nil {
-		return QueueItem{}, err
+		return player.QueueItem{}, err
 	}
 	if paused {
-		return QueueItem{}, errors.New("not playing")
+		return player.QueueItem{}, errors.New("not playing")
 	}
 
-	if len(p.queue) == 0 { // TODO mutex queue access
-		return QueueItem{}, errors.New("queue empty")
+	p.mutex.Lock()
+	defer p.unlock()
+
+	currentSong, ok := p.queue.Current()
+	if !ok {
+		return player.QueueItem{}, errors.New("queue empty")
 	}
-	currentSong := p.queue[0]
 	return currentSong, nil
 }
 
@@ -334,23 +643,55 @@ func (p *Player) OnSongChange(cb func(track remote.TrackInterface)) {
 	p.cbOnSongChange = append(p.cbOnSongChange, cb)
 }
 
+func (p *Player) OnModeChange(cb func()) {
+	p.cbOnModeChange = append(p.cbOnModeChange, cb)
+}
+
 func (p *Player) GetTimePos() float64 {
+	p.mutex.Lock()
+	defer p.unlock()
 	return p.remoteState.timePos
 }
 
 func (p *Player) IsSeeking() (bool, error) {
-	return false, nil
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.seeking, nil
 }
 
-func (p *Player) SeekAbsolute(float64) error {
-	return nil
+// SeekAbsolute jumps to position seconds into the current song
+func (p *Player) SeekAbsolute(position float64) error {
+	if position < 0 {
+		position = 0
+	}
+	return p.seekTo(strconv.FormatFloat(position, 'f', 3, 64), "absolute")
+}
+
+// SeekPercent jumps to the given share of the current song
+func (p *Player) SeekPercent(percent float64) error {
+	percent = math.Max(0, math.Min(percent, 100))
+	return p.seekTo(strconv.FormatFloat(percent, 'f', 3, 64), "absolute-percent")
+}
+
+func (p *Player) seekTo(target, flags string) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if loaded, err := p.IsSongLoaded(); err != nil || !loaded || p.stopped {
+		// nothing to seek in
+		return err
+	}
+	return p.instance.Command([]string{"seek", target, flags})
 }
 
 func (p *Player) Play() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
 	if isPlaying, err := p.IsPlaying(); err != nil {
 		return err
 	} else if !isPlaying {
-		return p.Pause()
+		return p.pause()
 	}
 	return nil
 }
@@ -359,9 +700,95 @@ func (p *Player) NextTrack() error {
 	return p.PlayNextTrack()
 }
 
-func (p *Player) PreviousTrack() (err error) {
-	if err = p.Stop(); err != nil {
-		return
+// PreviousTrack restarts the current song if it played for more than
+// RestartThreshold seconds, otherwise it goes back to the previous song
+func (p *Player) PreviousTrack() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	_, hasCurrent := p.queue.Current()
+	restart := hasCurrent && p.remoteState.timePos > player.RestartThreshold
+	if !restart && !p.queue.Previous() {
+		// at the first song
+		restart = true
 	}
-	return p.Pause()
+	item, ok := p.queue.Current()
+	if !ok {
+		// empty queue
+		return nil
+	}
+
+	loaded, err := p.IsSongLoaded()
+	if err != nil {
+		return err
+	}
+	if !loaded || p.stopped {
+		// start playing
+		p.stopped = true
+		return p.pause()
+	}
+	if restart {
+		return p.instance.Command([]string{"seek", "0", "absolute"})
+	}
+	return p.replaceCurrent(item)
+}
+
+func (p *Player) GetShuffle() bool {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.queue.Shuffle()
+}
+
+// SetShuffle plays the upcoming songs in random order, without changing the
+// order of the queue. When disabled playback continues after the current song
+// in queue order.
+func (p *Player) SetShuffle(shuffle bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if shuffle != p.queue.Shuffle() {
+		p.queue.SetShuffle(shuffle)
+		p.prefetchNext()
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetRepeat() remote.RepeatMode {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.queue.Repeat()
+}
+
+func (p *Player) SetRepeat(mode remote.RepeatMode) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	if mode != p.queue.Repeat() {
+		p.queue.SetRepeat(mode)
+		p.prefetchNext()
+		p.sendModes()
+	}
+	return nil
+}
+
+func (p *Player) GetModes() player.Modes {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.modes()
+}
+
+// must be called with mutex held
+func (p *Player) modes() player.Modes {
+	return player.Modes{
+		Shuffle:    p.queue.Shuffle(),
+		Repeat:     p.queue.Repeat(),
+		ReplayGain: p.replayGain.Mode,
+		Speed:      p.speed,
+	}
+}
+
+// must be called with mutex held
+func (p *Player) sendModes() {
+	p.sendGuiDataEvent(player.EventModes, p.modes())
 }
@@ -0,0 +1,1085 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Print(s string) {
+	l.t.Log(s)
+}
+
+func (l testLogger) Printf(s string, as ...interface{}) {
+	l.t.Logf(s, as...)
+}
+
+func (l testLogger) PrintError(source string, err error) {
+	l.t.Logf("Error(%s) -> %s", source, err)
+}
+
+// fakeMpv emits the events libmpv would emit for the commands the player
+// uses. Its event queue is unbounded like libmpv's, so commands never block.
+type fakeMpv struct {
+	mutex  sync.Mutex
+	events []*mpv.Event
+	notify chan struct{}
+
+	idle     bool
+	paused   bool
+	position int64
+	volume   int64
+	speed    float64
+	// audio output
+	audioDevice string
+	exclusive   bool
+
+	playlist    []string
+	playlistPos int
+	// files in the order they were started
+	started []string
+	// number of loadfile commands that replaced the playlist
+	replaced int
+	// audio filters by label
+	filters map[string]string
+	// files that start but never load, fail ends them
+	broken map[string]bool
+}
+
+var _ mpvInstance = (*fakeMpv)(nil)
+
+func newFakeMpv() *fakeMpv {
+	return &fakeMpv{
+		notify:      make(chan struct{}, 1),
+		idle:        true,
+		volume:      100,
+		speed:       1,
+		audioDevice: "auto",
+		playlistPos: -1,
+		filters:     map[string]string{},
+		broken:      map[string]bool{},
+	}
+}
+
+// must be called with mutex held
+func (m *fakeMpv) start(pos int) {
+	m.idle = false
+	m.position = 0
+	m.playlistPos = pos
+	m.started = append(m.started, m.playlist[pos])
+	m.emit(mpv.EVENT_START_FILE)
+	if m.broken[m.playlist[pos]] {
+		return
+	}
+	m.emitProperty("duration", int64(200))
+	m.emit(mpv.EVENT_FILE_LOADED)
+	m.emitProperty("audio-params", `{"format":"floatp","samplerate":44100,"channels":"stereo","hr-channels":"stereo"}`)
+}
+
+// must be called with mutex held
+func (m *fakeMpv) toIdle() {
+	m.idle = true
+	m.playlist = nil
+	m.playlistPos = -1
+	m.emit(mpv.EVENT_IDLE)
+}
+
+// must be called with mutex held
+func (m *fakeMpv) emit(id mpv.EventId) {
+	m.emitEvent(&mpv.Event{Event_Id: id})
+}
+
+// emitProperty emits a property change with the data laid out like libmpv's
+// mpv_event_property.
+// must be called with mutex held
+func (m *fakeMpv) emitProperty(name string, value interface{}) {
+	property := &eventProperty{name: cString(name)}
+	switch value := value.(type) {
+	case bool:
+		flag := int32(0)
+		if value {
+			flag = 1
+		}
+		property.format = int32(mpv.FORMAT_FLAG)
+		property.data = unsafe.Pointer(&flag)
+	case int64:
+		property.format = int32(mpv.FORMAT_INT64)
+		property.data = unsafe.Pointer(&value)
+	case string:
+		s := cString(value)
+		property.format = int32(mpv.FORMAT_STRING)
+		property.data = unsafe.Pointer(&s)
+	}
+	m.emitEvent(&mpv.Event{Event_Id: mpv.EVENT_PROPERTY_CHANGE, Data: unsafe.Pointer(property)})
+}
+
+// emitEndFile emits an end of file with the data laid out like libmpv's
+// mpv_event_end_file.
+// must be called with mutex held
+func (m *fakeMpv) emitEndFile(reason EndFileReason, code mpv.Error) {
+	data := &eventEndFile{reason: int32(reason), error: int32(code)}
+	m.emitEvent(&mpv.Event{Event_Id: mpv.EVENT_END_FILE, Data: unsafe.Pointer(data)})
+}
+
+func cString(s string) *byte {
+	return &append([]byte(s), 0)[0]
+}
+
+// must be called with mutex held
+func (m *fakeMpv) emitEvent(evt *mpv.Event) {
+	m.events = append(m.events, evt)
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (m *fakeMpv) Command(command []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch command[0] {
+	case "loadfile":
+		if len(command) > 2 && command[2] == "append" {
+			m.playlist = append(m.playlist, command[1])
+			return nil
+		}
+		if !m.idle {
+			m.emitEndFile(EndFileStop, 0)
+		}
+		m.replaced++
+		m.playlist = []string{command[1]}
+		m.start(0)
+	case "stop":
+		if !m.idle {
+			m.emitEndFile(EndFileStop, 0)
+		}
+		m.toIdle()
+	case "playlist-clear":
+		if m.playlistPos >= 0 {
+			m.playlist = []string{m.playlist[m.playlistPos]}
+			m.playlistPos = 0
+		} else {
+			m.playlist = nil
+		}
+	case "cycle":
+		m.paused = !m.paused
+		m.emitProperty("pause", m.paused)
+	case "seek":
+		target, err := strconv.ParseFloat(command[1], 64)
+		if err != nil {
+			return err
+		}
+		mode := "relative"
+		if len(command) > 2 {
+			mode = command[2]
+		}
+		switch mode {
+		case "absolute":
+			m.position = int64(target)
+		case "absolute-percent":
+			m.position = int64(target * 200 / 100)
+		default:
+			m.position += int64(target)
+		}
+		m.emit(mpv.EVENT_SEEK)
+		m.emit(mpv.EVENT_PLAYBACK_RESTART)
+		m.emitProperty("playback-time", m.position)
+	case "af":
+		label, filter, _ := strings.Cut(command[2], ":")
+		switch command[1] {
+		case "add":
+			m.filters[label] = filter
+		case "remove":
+			delete(m.filters, label)
+		}
+	default:
+		return fmt.Errorf("unknown command %v", command)
+	}
+	return nil
+}
+
+func (m *fakeMpv) SetProperty(name string, format mpv.Format, data interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch name {
+	case "pause":
+		m.paused = data.(bool)
+		m.emitProperty("pause", m.paused)
+	case "volume":
+		m.volume = int64(data.(int))
+		m.emitProperty("volume", m.volume)
+	case "speed":
+		m.speed = data.(float64)
+	case "audio-device":
+		m.audioDevice = data.(string)
+	case "audio-exclusive":
+		m.exclusive = data.(bool)
+	case "replaygain", "replaygain-preamp", "replaygain-clip":
+	default:
+		return fmt.Errorf("unknown property %s", name)
+	}
+	return nil
+}
+
+func (m *fakeMpv) GetProperty(name string, format mpv.Format) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch name {
+	case "idle-active":
+		return m.idle, nil
+	case "pause":
+		return m.paused, nil
+	case "playback-time":
+		return m.position, nil
+	case "path":
+		if m.playlistPos < 0 {
+			return nil, errors.New("property unavailable")
+		}
+		return m.playlist[m.playlistPos], nil
+	case "playlist-pos":
+		return int64(m.playlistPos), nil
+	case "duration":
+		return int64(200), nil
+	case "volume":
+		return m.volume, nil
+	case "audio-device":
+		return m.audioDevice, nil
+	case "audio-device-list":
+		return `[{"name":"auto","description":"Autoselect device"},{"name":"null","description":"Null audio output"}]`, nil
+	}
+	return nil, fmt.Errorf("unknown property %s", name)
+}
+
+func (m *fakeMpv) ObserveProperty(replyUserdata uint64, name string, format mpv.Format) error {
+	return nil
+}
+
+func (m *fakeMpv) WaitEvent(timeout float32) *mpv.Event {
+	deadline := time.After(time.Duration(timeout * float32(time.Second)))
+	for {
+		m.mutex.Lock()
+		if len(m.events) > 0 {
+			evt := m.events[0]
+			m.events = m.events[1:]
+			m.mutex.Unlock()
+			return evt
+		}
+		m.mutex.Unlock()
+
+		select {
+		case <-m.notify:
+		case <-deadline:
+			return &mpv.Event{Event_Id: mpv.EVENT_NONE}
+		}
+	}
+}
+
+func (m *fakeMpv) TerminateDestroy() {}
+
+// finish plays the current file to its end, mpv continues with the next
+// playlist entry
+func (m *fakeMpv) finish() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.idle {
+		return
+	}
+	m.emitEndFile(EndFileEOF, 0)
+	m.next()
+}
+
+// fail ends the current file with an error, mpv continues with the next
+// playlist entry. A broken file failed to load, others failed while playing.
+func (m *fakeMpv) fail() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.idle {
+		return
+	}
+	m.emitEndFile(EndFileError, mpv.ERROR_LOADING_FAILED)
+	m.next()
+}
+
+// must be called with mutex held
+func (m *fakeMpv) next() {
+	if m.playlistPos+1 < len(m.playlist) {
+		m.start(m.playlistPos + 1)
+	} else {
+		m.toIdle()
+	}
+}
+
+// breakFile makes the file at uri fail to load
+func (m *fakeMpv) breakFile(uri string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.broken[uri] = true
+}
+
+// progress advances the playback position and returns it
+func (m *fakeMpv) progress() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.position++
+	m.emitProperty("playback-time", m.position)
+	return m.position
+}
+
+func (m *fakeMpv) filter(label string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.filters[label]
+}
+
+func (m *fakeMpv) startedFiles() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string(nil), m.started...)
+}
+
+func (m *fakeMpv) state() (playlist []string, replaced int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string(nil), m.playlist...), m.replaced
+}
+
+// eventRecorder is an EventConsumer that calls back into the player like the
+// gui does
+type eventRecorder struct {
+	player *Player
+	events chan player.UiEvent
+}
+
+func (r *eventRecorder) SendEvent(event player.UiEvent) {
+	r.player.GetQueueCopy()
+	r.events <- event
+}
+
+// status updates of observed properties, skipped by expect
+var statusEvents = map[player.UiEventType]bool{
+	player.EventStatus:      true,
+	player.EventPosition:    true,
+	player.EventDuration:    true,
+	player.EventVolume:      true,
+	player.EventMute:        true,
+	player.EventMetadata:    true,
+	player.EventAudioParams: true,
+	player.EventCache:       true,
+	player.EventSleep:       true,
+}
+
+// expect waits for an event of the given type, skipping status updates
+func (r *eventRecorder) expect(t *testing.T, typ player.UiEventType) player.UiEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-r.events:
+			if statusEvents[event.Type] && event.Type != typ {
+				continue
+			}
+			if event.Type != typ {
+				t.Fatalf("expected event %v, got %+v", typ, event)
+			}
+			return event
+		case <-timeout:
+			t.Fatalf("timeout waiting for event %v", typ)
+		}
+	}
+}
+
+// expectPosition waits for a status update with the given position
+func (r *eventRecorder) expectPosition(t *testing.T, position int64) {
+	t.Helper()
+	for {
+		if status := r.expect(t, player.EventPosition).Data.(player.StatusData); status.Position == position {
+			return
+		}
+	}
+}
+
+// expectVolume waits for a status update with the given volume
+func (r *eventRecorder) expectVolume(t *testing.T, volume int64) {
+	t.Helper()
+	for {
+		if status := r.expect(t, player.EventVolume).Data.(player.StatusData); status.Volume == volume {
+			return
+		}
+	}
+}
+
+func startTestPlayer(t *testing.T) (*Player, *fakeMpv, *eventRecorder) {
+	t.Helper()
+	m := newFakeMpv()
+	p := newPlayer(m, testLogger{t})
+	recorder := &eventRecorder{p, make(chan player.UiEvent, 1000)}
+	p.RegisterEventConsumer(recorder)
+
+	done := make(chan struct{})
+	go func() {
+		p.EventLoop()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		p.Quit()
+		<-done
+	})
+	return p, m, recorder
+}
+
+func testItem(n int) *player.QueueItem {
+	return &player.QueueItem{
+		Id:    fmt.Sprintf("tr-%d", n),
+		Uri:   fmt.Sprintf("http://test/%d", n),
+		Title: fmt.Sprintf("Track %d", n),
+	}
+}
+
+func TestPlayerAdvancesQueue(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	for i := 1; i <= 3; i++ {
+		p.AddToQueue(testItem(i))
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected tr-1 playing, got %+v", event.Data)
+	}
+
+	recorder.expectPosition(t, m.progress())
+	if pos := p.GetTimePos(); pos != 1 {
+		t.Errorf("expected position 1, got %v", pos)
+	}
+
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	if queue, current, _ := p.GetQueueCopy(); len(queue) != 3 || current != 1 || queue[current].Id != "tr-2" {
+		t.Errorf("unexpected queue %+v, current %d", queue, current)
+	}
+
+	// skipping replaces the current track without advancing twice
+	if err := p.NextTrack(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-3" {
+		t.Errorf("expected tr-3 playing, got %+v", event.Data)
+	}
+
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+	if queue, current, _ := p.GetQueueCopy(); len(queue) != 3 || current != 3 {
+		t.Errorf("expected all songs played, got %+v, current %d", queue, current)
+	}
+
+	started := m.startedFiles()
+	if len(started) != 3 || started[2] != "http://test/3" {
+		t.Errorf("unexpected started files %v", started)
+	}
+}
+
+func TestPlayerGapless(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[1] != "http://test/2" {
+		t.Fatalf("next track not prefetched, playlist %v", playlist)
+	}
+
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	// added while playing the last track
+	p.AddToQueue(testItem(3))
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[0] != "http://test/2" || playlist[1] != "http://test/3" {
+		t.Fatalf("unexpected playlist %v", playlist)
+	}
+
+	// replacing the next track updates the prefetch
+	p.AddToQueue(testItem(4))
+	p.DeleteQueueItem(2)
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[1] != "http://test/4" {
+		t.Fatalf("unexpected playlist %v", playlist)
+	}
+
+	// the same track twice in a row advances the queue once
+	p.AddToQueue(testItem(4))
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-4" {
+		t.Errorf("expected tr-4 playing, got %+v", event.Data)
+	}
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-4" {
+		t.Errorf("expected tr-4 playing again, got %+v", event.Data)
+	}
+	if queue, current, _ := p.GetQueueCopy(); current != len(queue)-1 {
+		t.Errorf("expected last song current, got %+v, current %d", queue, current)
+	}
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+
+	// mpv went from track to track on its own
+	if _, replaced := m.state(); replaced != 1 {
+		t.Errorf("expected one loadfile replacing the playlist, got %d", replaced)
+	}
+}
+
+func TestPlayerStopKeepsQueue(t *testing.T) {
+	p, _, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventStopped)
+	if queue, current, _ := p.GetQueueCopy(); len(queue) != 2 || queue[current].Id != "tr-1" {
+		t.Errorf("stop must keep the current track, got %+v", queue)
+	}
+
+	// play starts the current track from the beginning
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected tr-1 playing, got %+v", event.Data)
+	}
+}
+
+func TestPlayerPreviousTrack(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	for i := 1; i <= 3; i++ {
+		p.AddToQueue(testItem(i))
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	m.finish()
+	recorder.expect(t, player.EventPlaying)
+
+	// played for a few seconds, restart
+	for i := 0; i <= player.RestartThreshold; i++ {
+		recorder.expectPosition(t, m.progress())
+	}
+	if err := p.PreviousTrack(); err != nil {
+		t.Fatal(err)
+	}
+	if _, current, _ := p.GetQueueCopy(); current != 1 {
+		t.Errorf("expected restart of the current song, current %d", current)
+	}
+	if status := recorder.expect(t, player.EventSeeked).Data.(player.StatusData); status.Position != 0 {
+		t.Errorf("expected seek to the start, got %+v", status)
+	}
+
+	// just started, go back
+	m.finish()
+	recorder.expect(t, player.EventPlaying)
+	if err := p.PreviousTrack(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	queue, current, _ := p.GetQueueCopy()
+	if len(queue) != 3 || current != 1 {
+		t.Errorf("unexpected queue %+v, current %d", queue, current)
+	}
+
+	// played songs can be removed
+	p.DeleteQueueItem(0)
+	if queue, current, _ := p.GetQueueCopy(); len(queue) != 2 || queue[current].Id != "tr-2" {
+		t.Errorf("unexpected queue %+v, current %d", queue, current)
+	}
+	if err := p.PreviousTrack(); err != nil {
+		t.Fatal(err)
+	}
+	if _, current, _ := p.GetQueueCopy(); current != 0 {
+		t.Errorf("expected first song to stay current, got %d", current)
+	}
+	recorder.expect(t, player.EventSeeked)
+
+	// back from the end of the queue
+	if err := p.NextTrack(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+	if err := p.PreviousTrack(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-3" {
+		t.Errorf("expected tr-3 playing, got %+v", event.Data)
+	}
+}
+
+func TestPlayerPlayFromQueue(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	// play from a song to the end of the album
+	if err := p.PlayItems(player.PlayerQueue{*testItem(1), *testItem(2), *testItem(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected tr-1 playing, got %+v", event.Data)
+	}
+
+	// jump to a queue row
+	if err := p.PlayQueueItem(2); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-3" {
+		t.Errorf("expected tr-3 playing, got %+v", event.Data)
+	}
+	if err := p.PlayQueueItem(3); err == nil {
+		t.Error("expected error for a bad index")
+	}
+
+	// reordering updates the prefetched track
+	p.InsertNext(testItem(4))
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[1] != "http://test/4" {
+		t.Fatalf("expected inserted song prefetched, playlist %v", playlist)
+	}
+	p.AddToQueue(testItem(5))
+	if err := p.MoveQueueItem(4, 3); err != nil {
+		t.Fatal(err)
+	}
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[1] != "http://test/5" {
+		t.Fatalf("expected moved song prefetched, playlist %v", playlist)
+	}
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-5" {
+		t.Errorf("expected tr-5 playing, got %+v", event.Data)
+	}
+
+	// replacing the upcoming songs keeps the played ones
+	if err := p.PlayItems(player.PlayerQueue{*testItem(6)}); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	queue, current, _ := p.GetQueueCopy()
+	if len(queue) != 5 || queue[current].Id != "tr-6" {
+		t.Errorf("unexpected queue %+v, current %d", queue, current)
+	}
+}
+
+func TestPlayerSeek(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	var seeks int32
+	p.OnSeek(func() { atomic.AddInt32(&seeks, 1) })
+
+	// nothing to seek in
+	if err := p.SeekAbsolute(10); err != nil {
+		t.Fatal(err)
+	}
+
+	p.AddToQueue(testItem(1))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.SeekAbsolute(42); err != nil {
+		t.Fatal(err)
+	}
+	event := recorder.expect(t, player.EventSeeked)
+	if status := event.Data.(player.StatusData); status.Position != 42 || status.Duration != 200 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if position := p.GetTimePos(); position != 42 {
+		t.Errorf("expected position 42, got %f", position)
+	}
+
+	if err := p.SeekPercent(150); err != nil {
+		t.Fatal(err)
+	}
+	if status := recorder.expect(t, player.EventSeeked).Data.(player.StatusData); status.Position != 200 {
+		t.Errorf("expected seek to the end, got %+v", status)
+	}
+	if seeking, _ := p.IsSeeking(); seeking {
+		t.Error("seek should be done")
+	}
+	if seeks := atomic.LoadInt32(&seeks); seeks != 2 {
+		t.Errorf("expected 2 seek callbacks, got %d", seeks)
+	}
+
+	// progress isn't a seek
+	recorder.expectPosition(t, m.progress())
+	if seeks := atomic.LoadInt32(&seeks); seeks != 2 {
+		t.Errorf("expected 2 seek callbacks, got %d", seeks)
+	}
+}
+
+func TestPlayerReplayGainFallback(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	item := testItem(1)
+	item.ReplayGain = subsonic.SubsonicReplayGain{TrackGain: -5, AlbumGain: -7}
+	p.AddToQueue(item)
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	recorder.expectPosition(t, m.progress())
+	if filter := m.filter(replayGainFilter); filter != "" {
+		t.Errorf("ReplayGain is off, got filter %q", filter)
+	}
+
+	if err := p.SetReplayGain(player.ReplayGain{Mode: player.ReplayGainAlbum}); err != nil {
+		t.Fatal(err)
+	}
+	if modes := recorder.expect(t, player.EventModes).Data.(player.Modes); modes.ReplayGain != player.ReplayGainAlbum {
+		t.Errorf("unexpected modes %+v", modes)
+	}
+	if filter := m.filter(replayGainFilter); filter != "lavfi-volume=volume=-7.00dB" {
+		t.Errorf("expected album gain, got filter %q", filter)
+	}
+
+	// the server has no gain for the next song
+	m.finish()
+	recorder.expect(t, player.EventPlaying)
+	// the file is loaded once the following event arrives
+	recorder.expectPosition(t, m.progress())
+	if filter := m.filter(replayGainFilter); filter != "" {
+		t.Errorf("expected filter removed, got %q", filter)
+	}
+}
+
+func TestPlayerEqualizer(t *testing.T) {
+	p, m, _ := startTestPlayer(t)
+
+	equalizer := player.Equalizer{}
+	equalizer[5] = 4
+	if err := p.SetEqualizer(equalizer); err != nil {
+		t.Fatal(err)
+	}
+	if filter := m.filter(equalizerFilter); filter != "lavfi=[equalizer=f=1000:t=o:w=1:g=4.0]" {
+		t.Errorf("unexpected filter %q", filter)
+	}
+	if p.GetEqualizer() != equalizer {
+		t.Errorf("unexpected equalizer %v", p.GetEqualizer())
+	}
+
+	// the replaygain filter is independent
+	if filter := m.filter(replayGainFilter); filter != "" {
+		t.Errorf("unexpected replaygain filter %q", filter)
+	}
+
+	if err := p.SetEqualizer(player.Equalizer{}); err != nil {
+		t.Fatal(err)
+	}
+	if filter := m.filter(equalizerFilter); filter != "" {
+		t.Errorf("expected filter removed, got %q", filter)
+	}
+}
+
+func TestPlayerSpeed(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	podcast := testItem(1)
+	podcast.MediaType = "podcast"
+	p.AddToQueue(podcast)
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.SetPitchCorrection(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetSpeed(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if modes := recorder.expect(t, player.EventModes).Data.(player.Modes); modes.Speed != 1.5 {
+		t.Errorf("unexpected modes %+v", modes)
+	}
+	m.mutex.Lock()
+	speed := m.speed
+	m.mutex.Unlock()
+	if speed != 1.5 || m.filter(speedFilter) != "scaletempo2" {
+		t.Errorf("expected speed 1.5 with pitch correction, got %v and filter %q", speed, m.filter(speedFilter))
+	}
+
+	// music plays normally
+	m.finish()
+	recorder.expect(t, player.EventModes)
+	recorder.expect(t, player.EventPlaying)
+	if p.GetSpeed() != 1 || m.filter(speedFilter) != "" {
+		t.Errorf("expected normal speed, got %v and filter %q", p.GetSpeed(), m.filter(speedFilter))
+	}
+
+	if err := p.SetSpeed(10); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventModes)
+	speeds := p.GetSpeeds()
+	if len(speeds) != 2 || speeds[player.ContentPodcast] != 1.5 || speeds[player.ContentMusic] != remote.MaxSpeed {
+		t.Errorf("unexpected speeds %v", speeds)
+	}
+}
+
+func TestPlayerAudioDevice(t *testing.T) {
+	p, m, _ := startTestPlayer(t)
+
+	devices, err := p.GetAudioDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[1] != (player.AudioDevice{Name: "null", Description: "Null audio output"}) {
+		t.Errorf("unexpected devices %+v", devices)
+	}
+
+	if err := p.SetAudioDevice("null", true); err != nil {
+		t.Fatal(err)
+	}
+	if device, err := p.GetAudioDevice(); err != nil || device != "null" {
+		t.Errorf("expected null device, got %q (%v)", device, err)
+	}
+	m.mutex.Lock()
+	exclusive := m.exclusive
+	m.mutex.Unlock()
+	if !exclusive {
+		t.Error("expected exclusive mode")
+	}
+}
+
+func TestPlayerHistoryLimit(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	for i := 0; i < player.MaxHistory+10; i++ {
+		p.AddToQueue(testItem(i))
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	for i := 0; i < player.MaxHistory+5; i++ {
+		m.finish()
+		recorder.expect(t, player.EventPlaying)
+	}
+
+	queue, current, _ := p.GetQueueCopy()
+	if current != player.MaxHistory || len(queue) != player.MaxHistory+5 || queue[current].Id != fmt.Sprintf("tr-%d", player.MaxHistory+5) {
+		t.Errorf("unexpected queue length %d, current %d", len(queue), current)
+	}
+}
+
+func TestPlayerModes(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	modeChanges := make(chan struct{}, 10)
+	p.OnModeChange(func() {
+		modeChanges <- struct{}{}
+	})
+
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.SetRepeat(remote.RepeatOne); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventModes); event.Data.(player.Modes).Repeat != remote.RepeatOne {
+		t.Errorf("unexpected modes %+v", event.Data)
+	}
+	<-modeChanges
+	if playlist, _ := m.state(); len(playlist) != 2 || playlist[1] != "http://test/1" {
+		t.Fatalf("expected the current song prefetched, playlist %v", playlist)
+	}
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected tr-1 repeated, got %+v", event.Data)
+	}
+
+	if err := p.SetRepeat(remote.RepeatAll); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventModes)
+	m.finish()
+	recorder.expect(t, player.EventPlaying)
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected the queue to start over, got %+v", event.Data)
+	}
+
+	if err := p.SetShuffle(true); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventModes); !event.Data.(player.Modes).Shuffle || !p.GetShuffle() {
+		t.Errorf("unexpected modes %+v", event.Data)
+	}
+}
+
+func TestPlayerCallbacksMayCallPlayer(t *testing.T) {
+	p, _, recorder := startTestPlayer(t)
+
+	songs := make(chan string, 10)
+	p.OnSongChange(func(track remote.TrackInterface) {
+		// callbacks run without the mutex held
+		if _, err := p.GetQueueItem(0); err != nil {
+			t.Error(err)
+		}
+		songs <- track.GetId()
+	})
+
+	p.AddToQueue(testItem(1))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	select {
+	case id := <-songs:
+		if id != "tr-1" {
+			t.Errorf("expected song change to tr-1, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no song change")
+	}
+}
+
+// TestPlayerConcurrentAccess drives the player from gui, remote and mpv
+// goroutines at once, run it with -race
+func TestPlayerConcurrentAccess(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	// keep consuming events like the gui
+	stopConsumer := make(chan struct{})
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		for {
+			select {
+			case <-recorder.events:
+			case <-stopConsumer:
+				return
+			}
+		}
+	}()
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	// gui
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			p.AddToQueue(testItem(i))
+			p.AddToQueue(testItem(i + rounds))
+			queue, _, _ := p.GetQueueCopy()
+			if len(queue) > 1 {
+				p.DeleteQueueItem(len(queue) - 1)
+			}
+			_, _ = p.GetQueueItem(0)
+			if i%50 == 49 {
+				p.ClearQueue()
+			}
+		}
+	}()
+
+	// remote control
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			switch i % 4 {
+			case 0:
+				_ = p.Play()
+			case 1:
+				_ = p.NextTrack()
+			case 2:
+				_ = p.Pause()
+			case 3:
+				_, _ = p.GetPlayingTrack()
+			}
+			p.GetTimePos()
+		}
+	}()
+
+	// mpv
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			m.progress()
+			if i%10 == 9 {
+				m.finish()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stopConsumer)
+	<-consumerDone
+}
+
+func TestPlayerLoadQueue(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	items := player.PlayerQueue{*testItem(1), *testItem(2), *testItem(3)}
+	if err := p.LoadQueue(items, 1, nil, 42); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPaused); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 paused, got %+v", event.Data)
+	}
+	if status := recorder.expect(t, player.EventSeeked).Data.(player.StatusData); status.Position != 42 {
+		t.Errorf("expected seek to the saved position, got %+v", status)
+	}
+	if files := m.startedFiles(); len(files) != 1 || files[0] != "http://test/2" {
+		t.Errorf("expected only tr-2 started, got %v", files)
+	}
+	if _, current, played := p.GetQueueCopy(); current != 1 || !played[0] || played[2] {
+		t.Errorf("unexpected current %d, played %v", current, played)
+	}
+
+	// play continues at the position
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventUnpaused)
+	if position := p.GetTimePos(); position != 42 {
+		t.Errorf("expected position 42, got %f", position)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"encoding/json"
+	"math"
+	"unsafe"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+)
+
+// observedProperties are the mpv properties the event loop is notified of,
+// with the format their values are decoded as. mpv only notifies if the value
+// in that format changed, e.g. the position once per second as int64. Node
+// properties are observed as json.
+var observedProperties = []struct {
+	name   string
+	format mpv.Format
+}{
+	{"playback-time", mpv.FORMAT_INT64},
+	{"duration", mpv.FORMAT_INT64},
+	{"volume", mpv.FORMAT_INT64},
+	{"mute", mpv.FORMAT_FLAG},
+	{"pause", mpv.FORMAT_FLAG},
+	{"playlist-pos", mpv.FORMAT_INT64},
+	{"metadata", mpv.FORMAT_STRING},
+	{"audio-params", mpv.FORMAT_STRING},
+	{"demuxer-cache-state", mpv.FORMAT_STRING},
+}
+
+// propertyChange is a decoded EVENT_PROPERTY_CHANGE
+type propertyChange struct {
+	name string
+	// bool, int64, float64 or string depending on the observed format, nil
+	// if the property is unavailable, e.g. the duration while idle
+	value interface{}
+}
+
+// eventProperty mirrors libmpv's struct mpv_event_property, the data of an
+// EVENT_PROPERTY_CHANGE
+type eventProperty struct {
+	name *byte
+	// mpv_format is a C enum
+	format int32
+	data   unsafe.Pointer
+}
+
+// decodeProperty copies the name and value of a changed property. The event's
+// data belongs to mpv and is only valid until the next WaitEvent call.
+func decodeProperty(data unsafe.Pointer) propertyChange {
+	if data == nil {
+		return propertyChange{}
+	}
+	property := (*eventProperty)(data)
+	change := propertyChange{name: goString(property.name)}
+	if property.data == nil {
+		return change
+	}
+
+	switch mpv.Format(property.format) {
+	case mpv.FORMAT_FLAG:
+		// C int
+		change.value = *(*int32)(property.data) != 0
+	case mpv.FORMAT_INT64:
+		change.value = *(*int64)(property.data)
+	case mpv.FORMAT_DOUBLE:
+		change.value = *(*float64)(property.data)
+	case mpv.FORMAT_STRING, mpv.FORMAT_OSD_STRING:
+		change.value = goString(*(**byte)(property.data))
+	}
+	return change
+}
+
+// goString copies a NUL-terminated C string
+func goString(s *byte) string {
+	if s == nil {
+		return ""
+	}
+	length := 0
+	for *(*byte)(unsafe.Add(unsafe.Pointer(s), length)) != 0 {
+		length++
+	}
+	return string(unsafe.Slice(s, length))
+}
+
+// handlePropertyChange updates the observed state and tells the gui about the
+// field that changed.
+// must be called with mutex held
+func (p *Player) handlePropertyChange(change propertyChange) {
+	switch change.name {
+	case "playback-time":
+		p.status.Position = int64Value(change.value)
+		p.remoteState.timePos = float64(p.status.Position)
+		if p.seekRestarted {
+			p.seeking = false
+			p.seekRestarted = false
+			p.sendGuiDataEvent(player.EventSeeked, p.status)
+		} else {
+			p.sendGuiDataEvent(player.EventPosition, p.status)
+		}
+
+	case "duration":
+		p.status.Duration = int64Value(change.value)
+		p.sendGuiDataEvent(player.EventDuration, p.status)
+
+	case "volume":
+		p.status.Volume = int64Value(change.value)
+		p.sendGuiDataEvent(player.EventVolume, p.status)
+
+	case "mute":
+		p.status.Muted, _ = change.value.(bool)
+		p.sendGuiDataEvent(player.EventMute, p.status)
+
+	case "pause":
+		// pausing with our commands is reported right away, this catches
+		// mpv pausing on its own. changes arrive in order, one outdated by
+		// further commands is followed by the current state. a file being
+		// loaded reports its state when it starts.
+		if p.stopped || p.replaceInProgress {
+			return
+		}
+		paused, _ := change.value.(bool)
+		if song, ok := p.queue.Current(); ok && paused != p.reportedPaused {
+			if paused {
+				p.sendPlayState(player.EventPaused, song)
+			} else {
+				p.sendPlayState(player.EventUnpaused, song)
+			}
+		}
+
+	case "playlist-pos":
+		// only logged to follow the prefetching. handleStartFile reads it
+		// itself since the change may be reported after the file started.
+		p.logger.Printf("mpv.EventLoop: playlist-pos %d", int64Value(change.value))
+
+	case "metadata":
+		metadata := map[string]string{}
+		if err := unmarshalProperty(change.value, &metadata); err != nil {
+			p.logger.PrintError("mpv.EventLoop: metadata", err)
+		}
+		p.sendGuiDataEvent(player.EventMetadata, metadata)
+
+	case "audio-params":
+		params := player.AudioParams{}
+		if err := unmarshalProperty(change.value, &params); err != nil {
+			p.logger.PrintError("mpv.EventLoop: audio-params", err)
+		}
+		p.sendGuiDataEvent(player.EventAudioParams, params)
+
+	case "demuxer-cache-state":
+		cache := player.CacheState{}
+		if err := unmarshalProperty(change.value, &cache); err != nil {
+			p.logger.PrintError("mpv.EventLoop: demuxer-cache-state", err)
+		}
+		// the state changes with every read from the network, the gui only
+		// shows whole seconds
+		cache.Duration = math.Floor(cache.Duration)
+		if cache != p.cache {
+			p.cache = cache
+			p.sendGuiDataEvent(player.EventCache, cache)
+		}
+	}
+}
+
+func int64Value(value interface{}) int64 {
+	i, _ := value.(int64)
+	return i
+}
+
+// unmarshalProperty decodes the json of a node property, leaving v as is if
+// the property is unavailable
+func unmarshalProperty(value interface{}, v interface{}) error {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), v)
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"testing"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+)
+
+func TestDecodeProperty(t *testing.T) {
+	m := newFakeMpv()
+	for _, expected := range []propertyChange{
+		{"pause", true},
+		{"mute", false},
+		{"playback-time", int64(42)},
+		{"metadata", `{"title":"Track 1"}`},
+	} {
+		m.emitProperty(expected.name, expected.value)
+		evt := m.WaitEvent(0)
+		if evt.Event_Id != mpv.EVENT_PROPERTY_CHANGE {
+			t.Fatalf("expected property change, got %v", evt.Event_Id)
+		}
+		if change := decodeProperty(evt.Data); change != expected {
+			t.Errorf("expected %+v, got %+v", expected, change)
+		}
+	}
+
+	// unavailable property
+	m.emitProperty("duration", nil)
+	if change := decodeProperty(m.WaitEvent(0).Data); change.name != "duration" || change.value != nil {
+		t.Errorf("expected duration without value, got %+v", change)
+	}
+}
+
+func TestPlayerObservedProperties(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	params := recorder.expect(t, player.EventAudioParams).Data.(player.AudioParams)
+	if params.SampleRate != 44100 || params.Channels != "stereo" {
+		t.Errorf("unexpected audio params %+v", params)
+	}
+
+	if err := p.SetVolume(50); err != nil {
+		t.Fatal(err)
+	}
+	if status := recorder.expect(t, player.EventVolume).Data.(player.StatusData); status.Volume != 50 || status.Duration != 200 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	m.mutex.Lock()
+	m.emitProperty("mute", true)
+	m.mutex.Unlock()
+	if status := recorder.expect(t, player.EventMute).Data.(player.StatusData); !status.Muted {
+		t.Errorf("expected muted, got %+v", status)
+	}
+
+	// only whole seconds of the cache are reported
+	m.mutex.Lock()
+	m.emitProperty("demuxer-cache-state", `{"cache-duration":10.2,"eof":false}`)
+	m.emitProperty("demuxer-cache-state", `{"cache-duration":10.7,"eof":false}`)
+	m.emitProperty("demuxer-cache-state", `{"cache-duration":12.1,"eof":true}`)
+	m.mutex.Unlock()
+	if cache := recorder.expect(t, player.EventCache).Data.(player.CacheState); cache.Duration != 10 || cache.EOF {
+		t.Errorf("unexpected cache %+v", cache)
+	}
+	if cache := recorder.expect(t, player.EventCache).Data.(player.CacheState); cache.Duration != 12 || !cache.EOF {
+		t.Errorf("unexpected cache %+v", cache)
+	}
+
+	// pausing with a command is reported once
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPaused)
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventUnpaused)
+
+	// mpv pausing on its own, the observed flag is used without reading
+	// the property again
+	m.mutex.Lock()
+	m.emitProperty("pause", true)
+	m.mutex.Unlock()
+	if event := recorder.expect(t, player.EventPaused); event.Data.(player.QueueItem).Id != "tr-1" {
+		t.Errorf("expected tr-1 paused, got %+v", event.Data)
+	}
+	m.mutex.Lock()
+	m.emitProperty("pause", false)
+	m.mutex.Unlock()
+	recorder.expect(t, player.EventUnpaused)
+}
+
+func TestPlayerSeekReportsObservedPosition(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	// mpv reports the new position after playback restarted
+	m.mutex.Lock()
+	m.emit(mpv.EVENT_SEEK)
+	m.emit(mpv.EVENT_PLAYBACK_RESTART)
+	m.emitProperty("playback-time", int64(77))
+	m.mutex.Unlock()
+	if status := recorder.expect(t, player.EventSeeked).Data.(player.StatusData); status.Position != 77 {
+		t.Errorf("expected seek to 77, got %+v", status)
+	}
+	if seeking, _ := p.IsSeeking(); seeking {
+		t.Error("seek should be done")
+	}
+
+	// then it's a plain position update again
+	m.mutex.Lock()
+	m.emitProperty("playback-time", int64(78))
+	m.mutex.Unlock()
+	if status := recorder.expect(t, player.EventPosition).Data.(player.StatusData); status.Position != 78 {
+		t.Errorf("expected position 78, got %+v", status)
+	}
+}
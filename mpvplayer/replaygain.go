@@ -0,0 +1,96 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// label of the audio filter that applies the server's gain
+const replayGainFilter = "@replaygain"
+
+// GetReplayGain returns the current volume normalisation settings
+func (p *Player) GetReplayGain() player.ReplayGain {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.replayGain
+}
+
+// SetReplayGain changes the volume normalisation, also for the current song
+func (p *Player) SetReplayGain(settings player.ReplayGain) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	mode := "no"
+	if settings.Mode != player.ReplayGainOff {
+		mode = settings.Mode.String()
+	}
+	if err := p.instance.SetProperty("replaygain", mpv.FORMAT_STRING, mode); err != nil {
+		return err
+	}
+	if err := p.instance.SetProperty("replaygain-preamp", mpv.FORMAT_DOUBLE, settings.Preamp); err != nil {
+		return err
+	}
+	if err := p.instance.SetProperty("replaygain-clip", mpv.FORMAT_FLAG, !settings.PreventClip); err != nil {
+		return err
+	}
+	p.replayGain = settings
+
+	if loaded, err := p.IsSongLoaded(); err == nil && loaded {
+		p.applyFallbackGain()
+	}
+	p.sendModes()
+	return nil
+}
+
+// applyFallbackGain applies the gain the server reported for the current song
+// if mpv didn't find ReplayGain tags in the stream, which happens when the
+// server transcodes it.
+// must be called with mutex held
+func (p *Player) applyFallbackGain() {
+	gain, apply := 0.0, false
+	if item, ok := p.queue.Current(); ok && p.replayGain.Mode != player.ReplayGainOff {
+		if _, err := p.instance.GetProperty("current-tracks/audio/replaygain-track-gain", mpv.FORMAT_DOUBLE); err != nil {
+			// unavailable, the stream has no tags
+			gain, apply = fallbackGain(item.ReplayGain, p.replayGain)
+		}
+	}
+
+	filter := ""
+	if apply {
+		filter = fmt.Sprintf("lavfi-volume=volume=%.2fdB", gain)
+	}
+	if err := p.setAudioFilter(replayGainFilter, filter); err != nil {
+		p.logger.PrintError("replaygain filter", err)
+	}
+}
+
+// fallbackGain returns the gain in dB for a song with the server's ReplayGain
+// values, false if the server doesn't have any
+func fallbackGain(values subsonic.SubsonicReplayGain, settings player.ReplayGain) (float64, bool) {
+	gain, peak := values.TrackGain, values.TrackPeak
+	otherGain, otherPeak := values.AlbumGain, values.AlbumPeak
+	if settings.Mode == player.ReplayGainAlbum {
+		gain, peak, otherGain, otherPeak = otherGain, otherPeak, gain, peak
+	}
+	if gain == 0 {
+		// use the other value if that's all the server knows
+		gain, peak = otherGain, otherPeak
+	}
+	if gain == 0 {
+		return 0, false
+	}
+
+	gain += settings.Preamp
+	if settings.PreventClip && peak > 0 {
+		// the peak after amplification must stay below full scale
+		gain = math.Min(gain, -20*math.Log10(peak))
+	}
+	return gain, true
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+func TestFallbackGain(t *testing.T) {
+	values := subsonic.SubsonicReplayGain{TrackGain: -4, TrackPeak: 0.5, AlbumGain: -6, AlbumPeak: 0.9}
+
+	tests := []struct {
+		name     string
+		values   subsonic.SubsonicReplayGain
+		settings player.ReplayGain
+		gain     float64
+		ok       bool
+	}{
+		{"track", values, player.ReplayGain{Mode: player.ReplayGainTrack}, -4, true},
+		{"album", values, player.ReplayGain{Mode: player.ReplayGainAlbum}, -6, true},
+		{"preamp", values, player.ReplayGain{Mode: player.ReplayGainTrack, Preamp: 3}, -1, true},
+		// a peak of 0.5 allows about +6 dB
+		{"clip", values, player.ReplayGain{Mode: player.ReplayGainTrack, Preamp: 15, PreventClip: true}, 6.0206, true},
+		{"clipping allowed", values, player.ReplayGain{Mode: player.ReplayGainTrack, Preamp: 15}, 11, true},
+		{"album missing", subsonic.SubsonicReplayGain{TrackGain: -4}, player.ReplayGain{Mode: player.ReplayGainAlbum}, -4, true},
+		{"track missing", subsonic.SubsonicReplayGain{AlbumGain: -6}, player.ReplayGain{Mode: player.ReplayGainTrack}, -6, true},
+		{"none", subsonic.SubsonicReplayGain{}, player.ReplayGain{Mode: player.ReplayGainTrack}, 0, false},
+	}
+	for _, test := range tests {
+		gain, ok := fallbackGain(test.values, test.settings)
+		if ok != test.ok || math.Abs(gain-test.gain) > 0.001 {
+			t.Errorf("%s: expected %f %v, got %f %v", test.name, test.gain, test.ok, gain, ok)
+		}
+	}
+}
+
+func TestParseReplayGainMode(t *testing.T) {
+	for _, mode := range []player.ReplayGainMode{player.ReplayGainOff, player.ReplayGainTrack, player.ReplayGainAlbum} {
+		if parsed, err := player.ParseReplayGainMode(mode.String()); err != nil || parsed != mode {
+			t.Errorf("%s: got %v %v", mode, parsed, err)
+		}
+	}
+	if _, err := player.ParseReplayGainMode("loud"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spezifisch/stmps/player"
+)
+
+// SleepFade is how long the volume fades out before the sleep timer stops
+const SleepFade = time.Minute
+
+// label of the audio filter that fades out, it leaves the user's volume alone
+const sleepFadeFilter = "@sleepfade"
+
+func (p *Player) GetSleepState() player.SleepState {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.sleepState()
+}
+
+// SetSleepTimer stops playback after duration, the volume fades out over the
+// last minute. Zero cancels the sleep timer.
+func (p *Player) SetSleepTimer(duration time.Duration) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.sleepEndOfAlbum = false
+	p.sleepDeadline = time.Time{}
+	if duration > 0 {
+		p.sleepDeadline = time.Now().Add(duration)
+	}
+	return p.updateSleep()
+}
+
+// SetSleepAtEndOfAlbum stops playback once the last song of the current album
+// in the queue ended, fading out over its last minute
+func (p *Player) SetSleepAtEndOfAlbum() error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.sleepDeadline = time.Time{}
+	p.sleepEndOfAlbum = true
+	return p.updateSleep()
+}
+
+// SetStopAfterCurrent stops playback when the current song ended. Playing
+// again starts the next song.
+func (p *Player) SetStopAfterCurrent(stop bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.stopAfterCurrent = stop
+	return p.updateSleep()
+}
+
+// updateSleep applies changed sleep settings.
+// must be called with mutex held
+func (p *Player) updateSleep() error {
+	if p.sleepDeadline.IsZero() && !p.sleepEndOfAlbum {
+		if err := p.endFade(); err != nil {
+			return err
+		}
+	}
+	// mpv mustn't continue with the next song on its own
+	p.prefetchNext()
+	p.tickSleep()
+	return nil
+}
+
+// must be called with mutex held
+func (p *Player) sleepState() player.SleepState {
+	state := player.SleepState{
+		EndOfAlbum:       p.sleepEndOfAlbum,
+		StopAfterCurrent: p.stopAfterCurrent,
+	}
+	if !p.sleepDeadline.IsZero() {
+		state.Remaining = time.Until(p.sleepDeadline)
+	} else if p.sleepEndOfAlbum {
+		state.Remaining = p.albumRemaining()
+	}
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+	// whole seconds are enough for the countdown
+	state.Remaining = state.Remaining.Round(time.Second)
+	return state
+}
+
+// albumRemaining returns the time until the last song of the current album in
+// the queue ends, at the current speed.
+// must be called with mutex held
+func (p *Player) albumRemaining() time.Duration {
+	current, ok := p.queue.Current()
+	if !ok {
+		return 0
+	}
+	duration := float64(current.Duration)
+	if duration <= 0 {
+		duration = float64(p.status.Duration)
+	}
+	seconds := math.Max(0, duration-p.remoteState.timePos)
+
+	for position := p.queue.Position() + 1; current.AlbumId != ""; position++ {
+		item, ok := p.queue.At(position)
+		if !ok || item.AlbumId != current.AlbumId {
+			break
+		}
+		seconds += float64(item.Duration)
+	}
+	return time.Duration(seconds / p.speed * float64(time.Second))
+}
+
+// stopsAfterCurrent returns true if playback stops when the current song ends
+// must be called with mutex held
+func (p *Player) stopsAfterCurrent() bool {
+	if p.stopAfterCurrent {
+		return true
+	}
+	if !p.sleepEndOfAlbum {
+		return false
+	}
+	current, _ := p.queue.Current()
+	next, ok := p.queue.Next(true)
+	return !ok || current.AlbumId == "" || next.AlbumId != current.AlbumId
+}
+
+// tickSleep is called by the event loop about once a second. It fades out the
+// volume during the last minute of the sleep timer, stops playback when the
+// time is up and sends the countdown.
+// must be called with mutex held
+func (p *Player) tickSleep() {
+	state := p.sleepState()
+
+	if !p.sleepDeadline.IsZero() && state.Remaining <= 0 {
+		p.logger.Print("mpv.EventLoop: sleep timer expired")
+		p.sleepDeadline = time.Time{}
+		if !p.stopped {
+			// the fade out ends once mpv stopped
+			if err := p.stop(); err != nil {
+				p.logger.PrintError("mpv.EventLoop: sleep timer stop", err)
+			}
+		} else if err := p.endFade(); err != nil {
+			p.logger.PrintError("mpv.EventLoop: end fade out", err)
+		}
+		state = p.sleepState()
+	} else if (!p.sleepDeadline.IsZero() || p.sleepEndOfAlbum) && state.Remaining <= SleepFade && !p.stopped {
+		gain := state.Remaining.Seconds() / SleepFade.Seconds()
+		if err := p.setAudioFilter(sleepFadeFilter, fmt.Sprintf("lavfi-volume=volume=%.2f", gain)); err != nil {
+			p.logger.PrintError("mpv.EventLoop: fade out", err)
+		}
+	}
+
+	if state != p.sleep {
+		p.sleep = state
+		p.sendGuiDataEvent(player.EventSleep, state)
+	}
+}
+
+// endFade removes the fade out filter, playing continues at the user's volume.
+// must be called with mutex held
+func (p *Player) endFade() error {
+	return p.setAudioFilter(sleepFadeFilter, "")
+}
+
+// handleSleepEnd stops playback at the end of the song if stop after current
+// or the end of the album was set. It returns false if playback continues.
+// must be called with mutex held
+func (p *Player) handleSleepEnd() bool {
+	if !p.stopsAfterCurrent() {
+		return false
+	}
+	p.logger.Print("mpv.EventLoop: stopping after the current song")
+	p.stopAfterCurrent = false
+	p.sleepEndOfAlbum = false
+	p.queue.Advance(true)
+	p.stopped = true
+	if err := p.endFade(); err != nil {
+		p.logger.PrintError("mpv.EventLoop: end fade out", err)
+	}
+	p.sendGuiEvent(player.EventStopped)
+	p.tickSleep()
+	return true
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/player"
+)
+
+func albumItem(n int, albumId string) *player.QueueItem {
+	item := testItem(n)
+	item.AlbumId = albumId
+	item.Duration = 200
+	return item
+}
+
+func TestPlayerStopAfterCurrent(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	p.AddToQueue(testItem(2))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.SetStopAfterCurrent(true); err != nil {
+		t.Fatal(err)
+	}
+	// mpv mustn't continue with the next song on its own
+	if playlist, _ := m.state(); len(playlist) != 1 {
+		t.Fatalf("next track still prefetched, playlist %v", playlist)
+	}
+	if state := recorder.expect(t, player.EventSleep).Data.(player.SleepState); !state.StopAfterCurrent {
+		t.Errorf("unexpected sleep state %+v", state)
+	}
+
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+	if state := p.GetSleepState(); state.IsActive() {
+		t.Errorf("expected stop after current reset, got %+v", state)
+	}
+
+	// play continues with the next song
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+}
+
+func TestPlayerSleepAtEndOfAlbum(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(albumItem(1, "al-1"))
+	p.AddToQueue(albumItem(2, "al-1"))
+	p.AddToQueue(albumItem(3, "al-2"))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+
+	if err := p.SetSleepAtEndOfAlbum(); err != nil {
+		t.Fatal(err)
+	}
+	if state := p.GetSleepState(); !state.EndOfAlbum || state.Remaining != 400*time.Second {
+		t.Errorf("unexpected sleep state %+v", state)
+	}
+
+	m.finish()
+	if event := recorder.expect(t, player.EventPlaying); event.Data.(player.QueueItem).Id != "tr-2" {
+		t.Errorf("expected tr-2 playing, got %+v", event.Data)
+	}
+	m.finish()
+	recorder.expect(t, player.EventStopped)
+	if queue, current, _ := p.GetQueueCopy(); queue[current].Id != "tr-3" {
+		t.Errorf("expected the next album current, got %+v, current %d", queue, current)
+	}
+	if started := m.startedFiles(); len(started) != 2 {
+		t.Errorf("unexpected started files %v", started)
+	}
+}
+
+func TestPlayerSleepTimer(t *testing.T) {
+	p, m, recorder := startTestPlayer(t)
+
+	p.AddToQueue(testItem(1))
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventPlaying)
+	if err := p.SetVolume(80); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expectVolume(t, 80)
+
+	// half of the fade out is left, the user's volume stays
+	if err := p.SetSleepTimer(SleepFade / 2); err != nil {
+		t.Fatal(err)
+	}
+	if filter := m.filter(sleepFadeFilter); filter != "lavfi-volume=volume=0.50" {
+		t.Errorf("unexpected fade out filter %q", filter)
+	}
+	if volume := p.GetVolume(); volume != 80 {
+		t.Errorf("expected the user's volume during the fade out, got %d", volume)
+	}
+
+	// changing the volume during the fade out isn't undone by it
+	if err := p.SetVolume(60); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expectVolume(t, 60)
+	if err := p.SetSleepTimer(SleepFade / 4); err != nil {
+		t.Fatal(err)
+	}
+	if filter := m.filter(sleepFadeFilter); filter != "lavfi-volume=volume=0.25" {
+		t.Errorf("unexpected fade out filter %q", filter)
+	}
+	if volume := p.GetVolume(); volume != 60 {
+		t.Errorf("expected the changed volume, got %d", volume)
+	}
+
+	// cancelling ends the fade out
+	if err := p.SetSleepTimer(0); err != nil {
+		t.Fatal(err)
+	}
+	if filter := m.filter(sleepFadeFilter); filter != "" {
+		t.Errorf("expected the fade out removed, got %q", filter)
+	}
+
+	if err := p.SetSleepTimer(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	recorder.expect(t, player.EventStopped)
+	if state := p.GetSleepState(); state.IsActive() {
+		t.Errorf("expected the sleep timer reset, got %+v", state)
+	}
+	if filter := m.filter(sleepFadeFilter); filter != "" {
+		t.Errorf("expected the fade out removed, got %q", filter)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.volume != 60 {
+		t.Errorf("expected the user's volume kept, got %d", m.volume)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"math"
+
+	"github.com/spezifisch/go-mpv"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+)
+
+// label of the audio filter keeping the pitch when the speed changes
+const speedFilter = "@scaletempo"
+
+// GetSpeed returns the playback speed for the current song's content kind
+func (p *Player) GetSpeed() float64 {
+	p.mutex.Lock()
+	defer p.unlock()
+	return p.speedFor(p.currentKind())
+}
+
+// SetSpeed changes the playback speed, 1 is normal. It's remembered for the
+// content kind of the current song, so podcasts keep their speed while music
+// plays normally.
+func (p *Player) SetSpeed(speed float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	speed = math.Max(remote.MinSpeed, math.Min(speed, remote.MaxSpeed))
+	p.speeds[p.currentKind()] = math.Round(speed*100) / 100
+	return p.applySpeed()
+}
+
+// GetSpeeds returns the speed of each content kind that isn't played normally
+func (p *Player) GetSpeeds() map[player.ContentKind]float64 {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	speeds := make(map[player.ContentKind]float64, len(p.speeds))
+	for kind, speed := range p.speeds {
+		if speed != 1 {
+			speeds[kind] = speed
+		}
+	}
+	return speeds
+}
+
+// SetSpeeds restores the speeds returned by GetSpeeds
+func (p *Player) SetSpeeds(speeds map[player.ContentKind]float64) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	for kind, speed := range speeds {
+		p.speeds[kind] = math.Max(remote.MinSpeed, math.Min(speed, remote.MaxSpeed))
+	}
+	return p.applySpeed()
+}
+
+// SetPitchCorrection keeps the pitch when the speed changes, with mpv's
+// scaletempo2 filter. Without it voices get higher when played faster.
+func (p *Player) SetPitchCorrection(enabled bool) error {
+	p.mutex.Lock()
+	defer p.unlock()
+
+	p.pitchCorrection = enabled
+	return p.applySpeed()
+}
+
+// must be called with mutex held
+func (p *Player) currentKind() player.ContentKind {
+	item, ok := p.queue.Current()
+	if !ok {
+		return player.ContentMusic
+	}
+	return item.Kind()
+}
+
+// must be called with mutex held
+func (p *Player) speedFor(kind player.ContentKind) float64 {
+	if speed, ok := p.speeds[kind]; ok {
+		return speed
+	}
+	return 1
+}
+
+// applySpeed sets the speed for the current song in mpv and tells the gui if
+// it changed.
+// must be called with mutex held
+func (p *Player) applySpeed() error {
+	speed := p.speedFor(p.currentKind())
+	if speed != p.speed {
+		if err := p.instance.SetProperty("speed", mpv.FORMAT_DOUBLE, speed); err != nil {
+			return err
+		}
+		p.speed = speed
+		p.sendModes()
+	}
+
+	filter := ""
+	if p.pitchCorrection && speed != 1 {
+		filter = "scaletempo2"
+	}
+	return p.setAudioFilter(speedFilter, filter)
+}
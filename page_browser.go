@@ -15,6 +15,7 @@ import (
 type BrowserPage struct {
 	Root               *tview.Flex
 	AddToPlaylistModal tview.Primitive
+	MusicFolderModal   tview.Primitive
 
 	artistFlex *tview.Flex
 
@@ -22,6 +23,9 @@ type BrowserPage struct {
 	entityList  *tview.List
 	searchField *tview.InputField
 
+	musicFolderList *tview.List
+	musicFolders    []subsonic.SubsonicMusicFolder
+
 	currentDirectory *subsonic.SubsonicDirectory
 	artistIdList     []string
 
@@ -46,6 +50,8 @@ func (ui *Ui) createBrowserPage(indexes *[]subsonic.SubsonicIndex) *BrowserPage
 		SetTitle(" artist ").
 		SetTitleAlign(tview.AlignLeft).
 		SetBorder(true)
+	// a folder restored at startup limits the artists too
+	browserPage.showRestoredMusicFolder()
 
 	for _, index := range *indexes {
 		for _, artist := range index.Artists {
@@ -114,22 +120,16 @@ func (ui *Ui) createBrowserPage(indexes *[]subsonic.SubsonicIndex) *BrowserPage
 			browserPage.showSearchField(true)
 			browserPage.searchPrev()
 			return nil
+		case 'f':
+			browserPage.showMusicFolderModal()
+			return nil
 		case 'R':
 			goBackTo := browserPage.artistList.GetCurrentItem()
 			// REFRESH artists
-			indexResponse, err := ui.connection.GetIndexes()
-			if err != nil {
+			if err := browserPage.UpdateArtists(); err != nil {
 				ui.logger.Printf("Error fetching indexes from server: %s\n", err)
 				return event
 			}
-			browserPage.artistList.Clear()
-			ui.connection.ClearCache()
-			for _, index := range indexResponse.Indexes.Index {
-				for _, artist := range index.Artists {
-					browserPage.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
-					browserPage.artistIdList = append(browserPage.artistIdList, artist.Id)
-				}
-			}
 			// Try to put the user to about where they were
 			if goBackTo < browserPage.artistList.GetItemCount() {
 				browserPage.artistList.SetCurrentItem(goBackTo)
@@ -177,6 +177,32 @@ func (ui *Ui) createBrowserPage(indexes *[]subsonic.SubsonicIndex) *BrowserPage
 		return event
 	})
 
+	// "select music folder" modal
+	browserPage.musicFolderList = tview.NewList().
+		ShowSecondaryText(false)
+	browserPage.musicFolderList.SetBorder(true).
+		SetTitle("Music Folder")
+
+	browserPage.MusicFolderModal = makeModal(browserPage.musicFolderList, 60, 20)
+
+	browserPage.musicFolderList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			ui.pages.HidePage(PageMusicFolder)
+			ui.pages.SwitchToPage(PageBrowser)
+			ui.app.SetFocus(browserPage.artistList)
+			return nil
+		} else if event.Key() == tcell.KeyEnter {
+			browserPage.handleMusicFolderSelected(browserPage.musicFolderList.GetCurrentItem())
+
+			ui.pages.HidePage(PageMusicFolder)
+			ui.pages.SwitchToPage(PageBrowser)
+			ui.app.SetFocus(browserPage.artistList)
+			return nil
+		}
+
+		return event
+	})
+
 	browserPage.entityList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyLeft {
 			ui.app.SetFocus(browserPage.artistList)
@@ -186,6 +212,10 @@ func (ui *Ui) createBrowserPage(indexes *[]subsonic.SubsonicIndex) *BrowserPage
 			browserPage.handleAddEntityToQueue()
 			return nil
 		}
+		if event.Rune() == 'e' {
+			browserPage.handlePlayEntityNext()
+			return nil
+		}
 		if event.Rune() == 'y' {
 			browserPage.handleToggleEntityStar()
 			return nil
@@ -221,6 +251,117 @@ func (ui *Ui) createBrowserPage(indexes *[]subsonic.SubsonicIndex) *BrowserPage
 	return &browserPage
 }
 
+// UpdateArtists reloads the artist list from the server and clears the
+// directory cache
+func (b *BrowserPage) UpdateArtists() error {
+	indexResponse, err := b.ui.connection.GetIndexes()
+	if err != nil {
+		return err
+	}
+	b.showArtists(indexResponse.Indexes.Index)
+	return nil
+}
+
+// showArtists replaces the artist list with the artists of indexes. The
+// directory cache is cleared as the library may have changed.
+func (b *BrowserPage) showArtists(indexes []subsonic.SubsonicIndex) {
+	b.ui.connection.ClearCache()
+	b.artistList.Clear()
+	b.artistIdList = []string{}
+	for _, index := range indexes {
+		for _, artist := range index.Artists {
+			b.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
+			b.artistIdList = append(b.artistIdList, artist.Id)
+		}
+	}
+}
+
+func (b *BrowserPage) showMusicFolderModal() {
+	response, err := b.ui.connection.GetMusicFolders()
+	if err != nil {
+		b.logger.PrintError("GetMusicFolders", err)
+		return
+	}
+	b.musicFolders = response.MusicFolders.Folders
+
+	b.musicFolderList.Clear()
+	b.musicFolderList.AddItem("(all folders)", "", 0, nil)
+	for i, folder := range b.musicFolders {
+		b.musicFolderList.AddItem(tview.Escape(folder.Name), "", 0, nil)
+		if string(folder.Id) == b.ui.connection.MusicFolderId {
+			b.musicFolderList.SetCurrentItem(i + 1)
+		}
+	}
+
+	b.ui.pages.ShowPage(PageMusicFolder)
+	b.ui.app.SetFocus(b.musicFolderList)
+}
+
+// showRestoredMusicFolder names the music folder selected in a previous
+// session in the artist list's title
+func (b *BrowserPage) showRestoredMusicFolder() {
+	folderId := b.ui.connection.MusicFolderId
+	if folderId == "" {
+		return
+	}
+
+	// the folder's id is shown if its name can't be found
+	name := folderId
+	if response, err := b.ui.connection.GetMusicFolders(); err != nil {
+		b.logger.PrintError("GetMusicFolders", err)
+	} else {
+		for _, folder := range response.MusicFolders.Folders {
+			if string(folder.Id) == folderId {
+				name = folder.Name
+				break
+			}
+		}
+	}
+	b.setMusicFolderTitle(name)
+}
+
+// setMusicFolderTitle shows the selected music folder in the artist list's
+// title, an empty name for all folders
+func (b *BrowserPage) setMusicFolderTitle(name string) {
+	title := " artist "
+	if name != "" {
+		title = " artist (" + tview.Escape(name) + ") "
+	}
+	b.artistList.Box.SetTitle(title)
+}
+
+// index 0 is "all folders", the others are offset by one
+func (b *BrowserPage) handleMusicFolderSelected(index int) {
+	if index < 0 || index > len(b.musicFolders) {
+		return
+	}
+
+	if index == 0 {
+		b.ui.connection.MusicFolderId = ""
+		b.setMusicFolderTitle("")
+	} else {
+		folder := b.musicFolders[index-1]
+		b.ui.connection.MusicFolderId = string(folder.Id)
+		b.setMusicFolderTitle(folder.Name)
+	}
+
+	if err := saveMusicFolder(b.ui.connection); err != nil {
+		b.logger.PrintError("saveMusicFolder", err)
+	}
+
+	if err := b.UpdateArtists(); err != nil {
+		b.logger.PrintError("UpdateArtists", err)
+		return
+	}
+
+	b.currentDirectory = nil
+	b.entityList.Clear()
+	if len(b.artistIdList) > 0 {
+		b.artistList.SetCurrentItem(0)
+		b.handleEntitySelected(b.artistIdList[0])
+	}
+}
+
 func (b *BrowserPage) showSearchField(visible bool) {
 	b.Root.Clear()
 	b.Root.AddItem(b.artistFlex, 0, 1, true)
@@ -289,6 +430,31 @@ func (b *BrowserPage) handleAddEntityToQueue() {
 	b.ui.queuePage.UpdateQueue()
 }
 
+// handlePlayEntityNext inserts the selected song or album after the current
+// song in the queue
+func (b *BrowserPage) handlePlayEntityNext() {
+	currentIndex := b.entityList.GetCurrentItem()
+	// account for [..] entry that we show, see handleEntitySelected()
+	if b.currentDirectory.Parent != "" {
+		currentIndex--
+	}
+	if currentIndex < 0 || len(b.currentDirectory.Entities) <= currentIndex {
+		return
+	}
+
+	entity := b.currentDirectory.Entities[currentIndex]
+	songs := []subsonic.SubsonicEntity{entity}
+	if entity.IsDirectory {
+		songs = b.directorySongs(&entity)
+	}
+	// each song is inserted right after the current one, so go backwards
+	for i := len(songs) - 1; i >= 0; i-- {
+		b.ui.insertSongNext(&songs[i])
+	}
+
+	b.ui.queuePage.UpdateQueue()
+}
+
 func (b *BrowserPage) handleEntitySelected(directoryId string) {
 	if directoryId == "" {
 		return
@@ -314,7 +480,7 @@ func (b *BrowserPage) handleEntitySelected(directoryId string) {
 		b.entityList.Box.SetTitle(" album ")
 	}
 
-	for _, entity := range b.currentDirectory.Entities {
+	for i, entity := range b.currentDirectory.Entities {
 		var handler func()
 		title := entityListTextFormat(entity, b.ui.starIdList) // handles escaping
 
@@ -323,7 +489,7 @@ func (b *BrowserPage) handleEntitySelected(directoryId string) {
 			handler = b.makeEntityHandler(entity.Id)
 		} else {
 			// it's a song
-			handler = makeSongHandler(&entity, b.ui, b.currentDirectory.Name)
+			handler = makeSongHandler(b.currentDirectory.Entities, i, b.ui, b.currentDirectory.Name)
 		}
 
 		b.entityList.AddItem(title, "", 0, handler)
@@ -385,21 +551,29 @@ func entityListTextFormat(entity subsonic.SubsonicEntity, starredItems map[strin
 }
 
 func (b *BrowserPage) addDirectoryToQueue(entity *subsonic.SubsonicEntity) {
+	for _, e := range b.directorySongs(entity) {
+		// TODO maybe BrowserPage gets its own version of this function that uses dirname as artist name as fallback
+		b.ui.addSongToQueue(&e)
+	}
+}
+
+// directorySongs returns the songs in a directory and its subdirectories
+func (b *BrowserPage) directorySongs(entity *subsonic.SubsonicEntity) (songs []subsonic.SubsonicEntity) {
 	response, err := b.ui.connection.GetMusicDirectory(entity.Id)
 	if err != nil {
-		b.logger.Printf("addDirectoryToQueue: GetMusicDirectory %s -- %s", entity.Id, err.Error())
+		b.logger.Printf("directorySongs: GetMusicDirectory %s -- %s", entity.Id, err.Error())
 		return
 	}
 
 	sort.Sort(response.Directory.Entities)
 	for _, e := range response.Directory.Entities {
 		if e.IsDirectory {
-			b.addDirectoryToQueue(&e)
+			songs = append(songs, b.directorySongs(&e)...)
 		} else {
-			// TODO maybe BrowserPage gets its own version of this function that uses dirname as artist name as fallback
-			b.ui.addSongToQueue(&e)
+			songs = append(songs, e)
 		}
 	}
+	return
 }
 
 func (b *BrowserPage) search() {
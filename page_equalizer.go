@@ -0,0 +1,460 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spf13/viper"
+)
+
+// built-in presets, always listed first
+var builtinEqualizerPresets = []struct {
+	name  string
+	gains player.Equalizer
+}{
+	{"flat", player.Equalizer{}},
+	{"bass", player.Equalizer{6, 5, 4, 2, 0, 0, 0, 0, 0, 0}},
+	{"treble", player.Equalizer{0, 0, 0, 0, 0, 0, 2, 4, 5, 6}},
+	{"loudness", player.Equalizer{5, 4, 2, 0, -1, 0, 0, 1, 3, 4}},
+	{"vocal", player.Equalizer{-2, -2, -1, 0, 2, 4, 4, 2, 0, -1}},
+	{"rock", player.Equalizer{4, 3, 2, 0, -1, -1, 1, 2, 3, 4}},
+	{"electronic", player.Equalizer{5, 4, 1, 0, -2, 1, 0, 1, 4, 5}},
+}
+
+type EqualizerPage struct {
+	Root            *tview.Flex
+	SavePresetModal tview.Primitive
+
+	presetList      *tview.List
+	sliders         *EqualizerWidget
+	presetNameInput *tview.InputField
+
+	// all presets by name, listed in presetNames order
+	presets     map[string]player.Equalizer
+	presetNames []string
+	// presets saved from the ui, these can be deleted
+	savedPresets map[string]player.Equalizer
+
+	// lowercase genre to preset name
+	genrePresets map[string]string
+	// the equalizer chosen by the user
+	manual player.Equalizer
+	// preset applied for the genre of the current song, empty if none
+	autoPreset string
+
+	// external refs
+	ui     *Ui
+	logger logger.LoggerInterface
+}
+
+func (ui *Ui) createEqualizerPage() *EqualizerPage {
+	equalizerPage := EqualizerPage{
+		presets:      map[string]player.Equalizer{},
+		savedPresets: map[string]player.Equalizer{},
+		genrePresets: map[string]string{},
+
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	equalizerPage.presetList = tview.NewList().ShowSecondaryText(false)
+	equalizerPage.presetList.Box.
+		SetTitle(" presets ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	equalizerPage.loadPresets()
+
+	equalizerPage.sliders = ui.createEqualizerWidget(&equalizerPage)
+	equalizerPage.sliders.Box.
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	equalizerPage.presetList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRight {
+			ui.app.SetFocus(equalizerPage.sliders)
+			return nil
+		}
+		if event.Rune() == 'd' {
+			equalizerPage.handleDeletePreset()
+			return nil
+		}
+		return equalizerPage.handleCommonKeys(event)
+	})
+
+	equalizerPage.sliders.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyLeft || event.Rune() == 'h':
+			if equalizerPage.sliders.band == 0 {
+				ui.app.SetFocus(equalizerPage.presetList)
+			} else {
+				equalizerPage.sliders.band--
+			}
+			return nil
+		case event.Key() == tcell.KeyRight || event.Rune() == 'l':
+			if equalizerPage.sliders.band < player.EqualizerBands-1 {
+				equalizerPage.sliders.band++
+			}
+			return nil
+		case event.Key() == tcell.KeyUp || event.Rune() == 'k':
+			equalizerPage.adjustBand(equalizerPage.sliders.band, 1)
+			return nil
+		case event.Key() == tcell.KeyDown || event.Rune() == 'j':
+			equalizerPage.adjustBand(equalizerPage.sliders.band, -1)
+			return nil
+		}
+		return equalizerPage.handleCommonKeys(event)
+	})
+
+	// "save preset" modal
+	equalizerPage.presetNameInput = tview.NewInputField().
+		SetLabel("Name: ").
+		SetFieldWidth(30)
+	equalizerPage.presetNameInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			equalizerPage.savePreset(strings.TrimSpace(equalizerPage.presetNameInput.GetText()))
+		}
+		ui.pages.HidePage(PageSavePreset)
+		ui.pages.SwitchToPage(PageEqualizer)
+		ui.app.SetFocus(equalizerPage.sliders)
+	})
+	presetNameFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(equalizerPage.presetNameInput, 0, 1, true)
+	presetNameFlex.SetTitle("Save equalizer preset").
+		SetBorder(true)
+	equalizerPage.SavePresetModal = makeModal(presetNameFlex, 40, 3)
+
+	equalizerPage.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(equalizerPage.presetList, 24, 0, false).
+		AddItem(equalizerPage.sliders, 0, 1, true)
+
+	// start with the configured preset
+	if name := viper.GetString("equalizer.preset"); name != "" {
+		if preset, ok := equalizerPage.findPreset(name); ok {
+			equalizerPage.setManual(preset)
+		} else {
+			equalizerPage.logger.Printf("equalizer preset %q not found", name)
+		}
+	}
+	equalizerPage.updateTitle()
+
+	return &equalizerPage
+}
+
+// loadPresets collects the built-in presets, the ones from the config file
+// and the ones saved from the ui
+func (e *EqualizerPage) loadPresets() {
+	for _, preset := range builtinEqualizerPresets {
+		e.addPreset(preset.name, preset.gains)
+	}
+
+	// config presets are lists of gains in dB from the lowest to the highest band
+	configPresets := map[string][]float64{}
+	if err := viper.UnmarshalKey("equalizer.presets", &configPresets); err != nil {
+		e.logger.PrintError("equalizer.presets", err)
+	}
+	names := make([]string, 0, len(configPresets))
+	for name := range configPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gains := configPresets[name]
+		if len(gains) != player.EqualizerBands {
+			e.logger.Printf("equalizer preset %q needs %d gains, has %d", name, player.EqualizerBands, len(gains))
+			continue
+		}
+		var preset player.Equalizer
+		copy(preset[:], gains)
+		e.addPreset(name, preset)
+	}
+
+	saved, err := loadEqualizerPresets()
+	if err != nil {
+		e.logger.PrintError("loadEqualizerPresets", err)
+	}
+	names = names[:0]
+	for name := range saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.savedPresets[name] = saved[name]
+		e.addPreset(name, saved[name])
+	}
+
+	for genre, name := range viper.GetStringMapString("equalizer.genres") {
+		e.genrePresets[strings.ToLower(genre)] = name
+	}
+}
+
+// addPreset adds a preset to the list or replaces the one with the same name
+func (e *EqualizerPage) addPreset(name string, preset player.Equalizer) {
+	if _, ok := e.presets[name]; !ok {
+		e.presetNames = append(e.presetNames, name)
+		e.presetList.AddItem(name, "", 0, func() {
+			e.handleSelectPreset(name)
+		})
+	}
+	e.presets[name] = preset
+}
+
+// findPreset looks up a preset by name, ignoring case because the config file
+// keys are lowercase
+func (e *EqualizerPage) findPreset(name string) (player.Equalizer, bool) {
+	if preset, ok := e.presets[name]; ok {
+		return preset, true
+	}
+	for _, presetName := range e.presetNames {
+		if strings.EqualFold(presetName, name) {
+			return e.presets[presetName], true
+		}
+	}
+	return player.Equalizer{}, false
+}
+
+// keys handled by both the preset list and the sliders
+func (e *EqualizerPage) handleCommonKeys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Rune() {
+	case 'f':
+		e.setManual(player.Equalizer{})
+		return nil
+	case 's':
+		e.presetNameInput.SetText("")
+		e.ui.pages.ShowPage(PageSavePreset)
+		e.ui.pages.SendToFront(PageSavePreset)
+		e.ui.app.SetFocus(e.presetNameInput)
+		return nil
+	}
+	return event
+}
+
+func (e *EqualizerPage) handleSelectPreset(name string) {
+	e.setManual(e.presets[name])
+}
+
+func (e *EqualizerPage) handleDeletePreset() {
+	index := e.presetList.GetCurrentItem()
+	if index < 0 || index >= len(e.presetNames) {
+		return
+	}
+	name := e.presetNames[index]
+	if _, ok := e.savedPresets[name]; !ok {
+		e.ui.showMessageBox("Only presets saved in stmps can be deleted")
+		return
+	}
+
+	delete(e.savedPresets, name)
+	delete(e.presets, name)
+	e.presetNames = append(e.presetNames[:index], e.presetNames[index+1:]...)
+	e.presetList.RemoveItem(index)
+	if err := saveEqualizerPresets(e.savedPresets); err != nil {
+		e.logger.PrintError("saveEqualizerPresets", err)
+	}
+}
+
+func (e *EqualizerPage) IsPresetNameInputFocused(focused tview.Primitive) bool {
+	return focused == e.presetNameInput
+}
+
+// adjustBand changes the gain of a band by delta dB
+func (e *EqualizerPage) adjustBand(band int, delta float64) {
+	equalizer := e.ui.player.GetEqualizer()
+	equalizer[band] += delta
+	e.setManual(equalizer)
+}
+
+// setManual applies an equalizer chosen by the user
+func (e *EqualizerPage) setManual(equalizer player.Equalizer) {
+	if err := e.ui.player.SetEqualizer(equalizer); err != nil {
+		e.logger.PrintError("SetEqualizer", err)
+		e.ui.showMessageBox("Unable to set the equalizer: " + err.Error())
+		return
+	}
+	e.manual = e.ui.player.GetEqualizer()
+	e.autoPreset = ""
+	e.updateTitle()
+}
+
+func (e *EqualizerPage) savePreset(name string) {
+	if name == "" {
+		return
+	}
+	if _, ok := e.presets[name]; ok {
+		if _, ok := e.savedPresets[name]; !ok {
+			e.ui.showMessageBox("A built-in or configured preset is called " + name)
+			return
+		}
+	}
+	preset := e.ui.player.GetEqualizer()
+	e.savedPresets[name] = preset
+	e.addPreset(name, preset)
+	if err := saveEqualizerPresets(e.savedPresets); err != nil {
+		e.logger.PrintError("saveEqualizerPresets", err)
+		e.ui.showMessageBox("Unable to save the preset: " + err.Error())
+	}
+}
+
+// SongChanged applies the preset configured for the genre of the song, or the
+// user's equalizer if there is none
+func (e *EqualizerPage) SongChanged(song *player.QueueItem) {
+	if len(e.genrePresets) == 0 {
+		return
+	}
+
+	equalizer, autoPreset := e.manual, ""
+	if name, ok := e.genrePresets[strings.ToLower(song.Genre)]; ok {
+		if preset, ok := e.findPreset(name); ok {
+			equalizer, autoPreset = preset, name
+		} else {
+			e.logger.Printf("equalizer preset %q for genre %q not found", name, song.Genre)
+		}
+	}
+	if autoPreset == e.autoPreset {
+		return
+	}
+
+	if err := e.ui.player.SetEqualizer(equalizer); err != nil {
+		e.logger.PrintError("SetEqualizer", err)
+		return
+	}
+	e.autoPreset = autoPreset
+	e.updateTitle()
+}
+
+func (e *EqualizerPage) updateTitle() {
+	if e.autoPreset != "" {
+		e.sliders.SetTitle(fmt.Sprintf(" equalizer (%s for this genre) ", e.autoPreset))
+	} else {
+		e.sliders.SetTitle(" equalizer ")
+	}
+}
+
+// EqualizerWidget shows a vertical slider for each equalizer band. Clicking a
+// slider sets the band's gain.
+type EqualizerWidget struct {
+	*tview.Box
+
+	// selected band
+	band int
+
+	trackStyle    tcell.Style
+	gainStyle     tcell.Style
+	selectedStyle tcell.Style
+
+	// external references
+	ui   *Ui
+	page *EqualizerPage
+}
+
+func (ui *Ui) createEqualizerWidget(page *EqualizerPage) *EqualizerWidget {
+	return &EqualizerWidget{
+		Box: tview.NewBox(),
+
+		trackStyle:    tcell.StyleDefault.Foreground(tcell.ColorGray),
+		gainStyle:     tcell.StyleDefault.Foreground(tcell.ColorGreen),
+		selectedStyle: tcell.StyleDefault.Foreground(tcell.ColorYellow),
+
+		ui:   ui,
+		page: page,
+	}
+}
+
+// layout returns the width of a band's column and the rows of the sliders,
+// below a row showing the gains and above a row with the frequencies
+func (w *EqualizerWidget) layout() (columnWidth, top, rows int) {
+	_, y, width, height := w.GetInnerRect()
+	return width / player.EqualizerBands, y + 1, height - 2
+}
+
+// gainRow returns the slider row of a gain, 0 being the top
+func gainRow(gain float64, rows int) int {
+	if rows <= 1 {
+		return 0
+	}
+	return int(math.Round((player.EqualizerMaxGain - gain) * float64(rows-1) / (2 * player.EqualizerMaxGain)))
+}
+
+func (w *EqualizerWidget) Draw(screen tcell.Screen) {
+	w.Box.DrawForSubclass(screen, w)
+	x, y, _, height := w.GetInnerRect()
+	columnWidth, top, rows := w.layout()
+	if columnWidth < 4 || rows < 3 {
+		tview.Print(screen, "too small", x, y, 10, tview.AlignLeft, tcell.ColorGray)
+		return
+	}
+
+	equalizer := w.ui.player.GetEqualizer()
+	zeroRow := gainRow(0, rows)
+	for band, gain := range equalizer {
+		left := x + band*columnWidth
+		center := left + columnWidth/2
+		style := w.gainStyle
+		color := tcell.ColorWhite
+		if band == w.band {
+			style = w.selectedStyle
+			color = tcell.ColorYellow
+		}
+
+		tview.Print(screen, fmt.Sprintf("%+.0f", gain), left, y, columnWidth, tview.AlignCenter, color)
+		tview.Print(screen, formatFrequency(player.EqualizerFrequencies[band]), left, y+height-1, columnWidth, tview.AlignCenter, color)
+
+		knob := gainRow(gain, rows)
+		for row := 0; row < rows; row++ {
+			switch {
+			case row == knob:
+				screen.SetContent(center, top+row, '■', nil, style)
+			case (row > knob && row <= zeroRow) || (row < knob && row >= zeroRow):
+				screen.SetContent(center, top+row, '┃', nil, style)
+			default:
+				screen.SetContent(center, top+row, '│', nil, w.trackStyle)
+			}
+		}
+	}
+}
+
+func (w *EqualizerWidget) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	return w.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		x, y := event.Position()
+		if action != tview.MouseLeftClick || !w.InRect(x, y) {
+			return false, nil
+		}
+		setFocus(w)
+
+		left, _, _, _ := w.GetInnerRect()
+		columnWidth, top, rows := w.layout()
+		if columnWidth <= 0 || rows <= 1 {
+			return true, nil
+		}
+		band := (x - left) / columnWidth
+		if band < 0 || band >= player.EqualizerBands {
+			return true, nil
+		}
+		w.band = band
+
+		row := y - top
+		if row >= 0 && row < rows {
+			gain := player.EqualizerMaxGain - float64(row)*2*player.EqualizerMaxGain/float64(rows-1)
+			equalizer := w.ui.player.GetEqualizer()
+			equalizer[band] = math.Round(gain)
+			w.page.setManual(equalizer)
+		}
+		return true, nil
+	})
+}
+
+func formatFrequency(hz int) string {
+	if hz >= 1000 {
+		return fmt.Sprintf("%dk", hz/1000)
+	}
+	return fmt.Sprintf("%d", hz)
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// columns: user, player, title, artist, minutes ago
+const nowPlayingDataColumns = 5
+
+// data for rendering now playing table
+type nowPlayingData struct {
+	tview.TableContentReadOnly
+
+	entries []subsonic.SubsonicNowPlayingEntry
+}
+
+var _ tview.TableContent = (*nowPlayingData)(nil)
+
+type NowPlayingPage struct {
+	Root *tview.Flex
+
+	nowPlayingList *tview.Table
+	nowPlayingData nowPlayingData
+
+	// external refs
+	ui     *Ui
+	logger logger.LoggerInterface
+}
+
+func (ui *Ui) createNowPlayingPage() *NowPlayingPage {
+	nowPlayingPage := NowPlayingPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	// main table
+	nowPlayingPage.nowPlayingList = tview.NewTable().
+		SetSelectable(true, false). // rows selectable
+		SetSelectedStyle(tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack))
+	nowPlayingPage.nowPlayingList.Box.
+		SetTitle(" now playing ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	nowPlayingPage.nowPlayingList.SetContent(&nowPlayingPage.nowPlayingData)
+	nowPlayingPage.nowPlayingList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEnter {
+			nowPlayingPage.handlePlayEntry()
+			return nil
+		} else if event.Rune() == 'a' {
+			nowPlayingPage.handleAddEntryToQueue()
+			return nil
+		} else if event.Rune() == 'R' {
+			ui.eventLoop.RefreshNowPlaying()
+			return nil
+		}
+
+		return event
+	})
+
+	// flex wrapper
+	nowPlayingPage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nowPlayingPage.nowPlayingList, 0, 1, true)
+
+	return &nowPlayingPage
+}
+
+// UpdateNowPlaying replaces the table contents, call from gui context
+func (n *NowPlayingPage) UpdateNowPlaying(entries []subsonic.SubsonicNowPlayingEntry) {
+	n.nowPlayingData.entries = entries
+	n.nowPlayingList.SetContent(&n.nowPlayingData)
+}
+
+func (n *NowPlayingPage) getSelectedEntry() (entry subsonic.SubsonicNowPlayingEntry, err error) {
+	index, _ := n.nowPlayingList.GetSelection()
+	if index < 0 || index >= len(n.nowPlayingData.entries) {
+		err = errors.New("invalid index")
+		return
+	}
+	entry = n.nowPlayingData.entries[index]
+	return
+}
+
+// button handler
+func (n *NowPlayingPage) handleAddEntryToQueue() {
+	entry, err := n.getSelectedEntry()
+	if err != nil {
+		return
+	}
+
+	n.ui.addSongToQueue(&entry.SubsonicEntity)
+	n.ui.queuePage.UpdateQueue()
+}
+
+// button handler
+func (n *NowPlayingPage) handlePlayEntry() {
+	entry, err := n.getSelectedEntry()
+	if err != nil {
+		return
+	}
+
+	songs := []subsonic.SubsonicEntity{entry.SubsonicEntity}
+	makeSongHandler(songs, 0, n.ui, entry.Artist)()
+}
+
+// nowPlayingData methods, used by tview to lazily render the table
+func (n *nowPlayingData) GetCell(row, column int) *tview.TableCell {
+	if row >= len(n.entries) || column >= nowPlayingDataColumns {
+		return nil
+	}
+	entry := n.entries[row]
+
+	switch column {
+	case 0: // user
+		return &tview.TableCell{
+			Text:        tview.Escape(entry.Username),
+			Color:       tcell.ColorYellow,
+			Expansion:   0,
+			Transparent: true,
+		}
+	case 1: // player
+		return &tview.TableCell{
+			Text:        tview.Escape(entry.PlayerName),
+			Color:       tcell.ColorGray,
+			Expansion:   0,
+			Transparent: true,
+		}
+	case 2: // title
+		return &tview.TableCell{
+			Text:        tview.Escape(entry.GetSongTitle()),
+			Expansion:   1,
+			Transparent: true,
+		}
+	case 3: // artist
+		return &tview.TableCell{
+			Text:        tview.Escape(entry.Artist),
+			Expansion:   1,
+			Transparent: true,
+		}
+	case 4: // minutes ago
+		text := "now"
+		if entry.MinutesAgo > 0 {
+			text = fmt.Sprintf("%d min ago", entry.MinutesAgo)
+		}
+		return &tview.TableCell{
+			Text:        text,
+			Align:       tview.AlignRight,
+			Expansion:   0,
+			Transparent: true,
+		}
+	}
+
+	return nil
+}
+
+// Return the total number of rows in the table.
+func (n *nowPlayingData) GetRowCount() int {
+	return len(n.entries)
+}
+
+// Return the total number of columns in the table.
+func (n *nowPlayingData) GetColumnCount() int {
+	return nowPlayingDataColumns
+}
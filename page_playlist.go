@@ -123,6 +123,10 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 			playlistPage.handleAddPlaylistSongToQueue()
 			return nil
 		}
+		if event.Rune() == 'e' {
+			playlistPage.handlePlayPlaylistSongNext()
+			return nil
+		}
 		return event
 	})
 
@@ -219,6 +223,22 @@ func (p *PlaylistPage) handleAddPlaylistSongToQueue() {
 	p.ui.queuePage.UpdateQueue()
 }
 
+func (p *PlaylistPage) handlePlayPlaylistSongNext() {
+	playlistIndex := p.playlistList.GetCurrentItem()
+	entityIndex := p.selectedPlaylist.GetCurrentItem()
+	if playlistIndex < 0 || playlistIndex >= len(p.ui.playlists) {
+		return
+	}
+	if entityIndex < 0 || entityIndex >= len(p.ui.playlists[playlistIndex].Entries) {
+		return
+	}
+
+	entity := p.ui.playlists[playlistIndex].Entries[entityIndex]
+	p.ui.insertSongNext(&entity)
+
+	p.ui.queuePage.UpdateQueue()
+}
+
 func (p *PlaylistPage) handleAddPlaylistToQueue() {
 	currentIndex := p.playlistList.GetCurrentItem()
 	if currentIndex < 0 || currentIndex >= p.playlistList.GetItemCount() || currentIndex >= len(p.ui.playlists) {
@@ -242,8 +262,8 @@ func (p *PlaylistPage) handlePlaylistSelected(playlist subsonic.SubsonicPlaylist
 	p.selectedPlaylist.Clear()
 	p.selectedPlaylist.SetSelectedFocusOnly(true)
 
-	for _, entity := range playlist.Entries {
-		handler := makeSongHandler(&entity, p.ui, entity.Artist)
+	for i, entity := range playlist.Entries {
+		handler := makeSongHandler(playlist.Entries, i, p.ui, "")
 		line := formatSongForPlaylistEntry(entity)
 		p.selectedPlaylist.AddItem(line, "", 0, handler)
 	}
@@ -10,11 +10,11 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/logger"
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
 )
 
-// columns: star, title, artist, duration
-const queueDataColumns = 4
+// columns: star, title, artist, album, year, format, duration
+const queueDataColumns = 7
 const starIcon = "♥"
 
 // data for rendering queue table
@@ -22,7 +22,9 @@ type queueData struct {
 	tview.TableContentReadOnly
 
 	// our copy of the queue
-	playerQueue mpvplayer.PlayerQueue
+	playerQueue player.PlayerQueue
+	// which songs were played, they are dimmed
+	played []bool
 	// we also need to know which elements are starred
 	starIdList map[string]struct{}
 }
@@ -35,6 +37,9 @@ type QueuePage struct {
 	queueList *tview.Table
 	queueData queueData
 
+	// row being dragged with the mouse, -1 if none
+	dragRow int
+
 	// external refs
 	ui     *Ui
 	logger logger.LoggerInterface
@@ -42,8 +47,9 @@ type QueuePage struct {
 
 func (ui *Ui) createQueuePage() *QueuePage {
 	queuePage := QueuePage{
-		ui:     ui,
-		logger: ui.logger,
+		dragRow: -1,
+		ui:      ui,
+		logger:  ui.logger,
 	}
 
 	// main table
@@ -61,10 +67,44 @@ func (ui *Ui) createQueuePage() *QueuePage {
 		} else if event.Rune() == 'y' {
 			queuePage.handleToggleStar()
 			return nil
+		} else if event.Key() == tcell.KeyEnter {
+			queuePage.handlePlaySelected()
+			return nil
+		} else if event.Rune() == '[' || (event.Key() == tcell.KeyUp && event.Modifiers()&tcell.ModShift != 0) {
+			queuePage.handleMoveSelected(-1)
+			return nil
+		} else if event.Rune() == ']' || (event.Key() == tcell.KeyDown && event.Modifiers()&tcell.ModShift != 0) {
+			queuePage.handleMoveSelected(1)
+			return nil
 		}
 
 		return event
 	})
+	queuePage.queueList.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+		switch action {
+		case tview.MouseLeftDown:
+			queuePage.dragRow = queuePage.rowAt(event.Position())
+		case tview.MouseLeftUp:
+			queuePage.dragRow = -1
+		case tview.MouseMove:
+			// drag the song to the row under the mouse
+			if queuePage.dragRow < 0 || event.Buttons()&tcell.ButtonPrimary == 0 {
+				break
+			}
+			if row := queuePage.rowAt(event.Position()); row >= 0 && row != queuePage.dragRow {
+				queuePage.moveItem(queuePage.dragRow, row)
+				queuePage.dragRow = row
+			}
+			return action, nil
+		case tview.MouseLeftDoubleClick:
+			if row := queuePage.rowAt(event.Position()); row >= 0 {
+				queuePage.queueList.Select(row, 0)
+				queuePage.handlePlaySelected()
+				return action, nil
+			}
+		}
+		return action, event
+	})
 
 	// flex wrapper
 	queuePage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
@@ -103,6 +143,57 @@ func (q *QueuePage) handleDeleteFromQueue() {
 	q.updateQueue()
 }
 
+// button handler
+func (q *QueuePage) handlePlaySelected() {
+	currentIndex, err := q.getSelectedItem()
+	if err != nil {
+		return
+	}
+
+	if err := q.ui.player.PlayQueueItem(currentIndex); err != nil {
+		q.logger.PrintError("PlayQueueItem", err)
+	}
+	q.updateQueue()
+}
+
+// button handler, moves the selected song by offset rows
+func (q *QueuePage) handleMoveSelected(offset int) {
+	currentIndex, err := q.getSelectedItem()
+	if err != nil {
+		return
+	}
+
+	to := currentIndex + offset
+	if to < 0 || to >= len(q.queueData.playerQueue) {
+		return
+	}
+	q.moveItem(currentIndex, to)
+}
+
+// moveItem moves a song in the queue and keeps it selected
+func (q *QueuePage) moveItem(from, to int) {
+	if err := q.ui.player.MoveQueueItem(from, to); err != nil {
+		q.logger.PrintError("MoveQueueItem", err)
+		return
+	}
+	q.updateQueue()
+	q.queueList.Select(to, 0)
+}
+
+// rowAt returns the queue row at the screen position, -1 if there is none
+func (q *QueuePage) rowAt(x, y int) int {
+	left, top, width, height := q.queueList.GetInnerRect()
+	if x < left || x >= left+width || y < top || y >= top+height {
+		return -1
+	}
+	rowOffset, _ := q.queueList.GetOffset()
+	row := y - top + rowOffset
+	if row < 0 || row >= len(q.queueData.playerQueue) {
+		return -1
+	}
+	return row
+}
+
 // button handler
 func (q *QueuePage) handleToggleStar() {
 	starIdList := q.queueData.starIdList
@@ -137,12 +228,12 @@ func (q *QueuePage) handleToggleStar() {
 	q.ui.browserPage.UpdateStars()
 }
 
-// re-read queue data from mpvplayer which is the authoritative source for the queue
+// re-read queue data from the player which is the authoritative source for the queue
 func (q *QueuePage) updateQueue() {
 	queueWasEmpty := len(q.queueData.playerQueue) == 0
 
 	// tell tview table to update its data
-	q.queueData.playerQueue = q.ui.player.GetQueueCopy()
+	q.queueData.playerQueue, _, q.queueData.played = q.ui.player.GetQueueCopy()
 	q.queueList.SetContent(&q.queueData)
 
 	// by default we're scrolled down after initially adding rows, fix this
@@ -158,6 +249,11 @@ func (q *queueData) GetCell(row, column int) *tview.TableCell {
 	}
 	song := q.playerQueue[row]
 
+	textColor := tcell.ColorDefault
+	if row < len(q.played) && q.played[row] {
+		textColor = tcell.ColorGray
+	}
+
 	switch column {
 	case 0: // star
 		text := " "
@@ -174,22 +270,69 @@ func (q *queueData) GetCell(row, column int) *tview.TableCell {
 			Transparent: true,
 		}
 	case 1: // title
+		color := textColor
+		if song.Error != "" {
+			color = tcell.ColorRed
+		}
 		return &tview.TableCell{
 			Text:        tview.Escape(song.Title),
+			Color:       color,
 			Expansion:   1,
 			Transparent: true,
 		}
 	case 2: // artist
 		return &tview.TableCell{
 			Text:        tview.Escape(song.Artist),
+			Color:       textColor,
+			Expansion:   1,
+			Transparent: true,
+		}
+	case 3: // album
+		return &tview.TableCell{
+			Text:        tview.Escape(song.Album),
+			Color:       textColor,
 			Expansion:   1,
 			Transparent: true,
 		}
-	case 3: // duration
+	case 4: // year
+		text := ""
+		if song.Year > 0 {
+			text = fmt.Sprint(song.Year)
+		}
+		return &tview.TableCell{
+			Text:        text,
+			Color:       textColor,
+			Align:       tview.AlignRight,
+			Expansion:   0,
+			MaxWidth:    4,
+			Transparent: true,
+		}
+	case 5: // format
+		if song.Error != "" {
+			// why the song was skipped
+			return &tview.TableCell{
+				Text:        tview.Escape(song.Error),
+				Color:       tcell.ColorRed,
+				Align:       tview.AlignRight,
+				Expansion:   0,
+				MaxWidth:    30,
+				Transparent: true,
+			}
+		}
+		return &tview.TableCell{
+			Text:        tview.Escape(formatAudioFormat(&song)),
+			Color:       tcell.ColorGray,
+			Align:       tview.AlignRight,
+			Expansion:   0,
+			MaxWidth:    13,
+			Transparent: true,
+		}
+	case 6: // duration
 		min, sec := iSecondsToMinAndSec(song.Duration)
 		text := fmt.Sprintf("%3d:%02d", min, sec)
 		return &tview.TableCell{
 			Text:        text,
+			Color:       textColor,
 			Align:       tview.AlignRight,
 			Expansion:   0,
 			MaxWidth:    6,
@@ -0,0 +1,88 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/spezifisch/stmps/keyring"
+	"github.com/spf13/viper"
+)
+
+// passwordEnv overrides all other password sources
+const passwordEnv = "STMP_AUTH_PASSWORD"
+
+// resolvePassword returns the server password from the first of these
+// sources that is set:
+//
+//  1. the STMP_AUTH_PASSWORD environment variable
+//  2. the first line of the output of auth.password_command
+//  3. the Secret Service keyring if auth.keyring is enabled
+//  4. auth.password
+func resolvePassword() (string, error) {
+	if password, ok := os.LookupEnv(passwordEnv); ok {
+		return password, nil
+	}
+
+	if command := viper.GetString("auth.password_command"); command != "" {
+		password, err := runPasswordCommand(command)
+		if err != nil {
+			return "", fmt.Errorf("auth.password_command: %w", err)
+		}
+		return password, nil
+	}
+
+	if viper.GetBool("auth.keyring") {
+		password, err := lookupKeyring(viper.GetString("auth.username"), viper.GetString("server.host"))
+		if err != nil {
+			return "", fmt.Errorf("keyring: %w", err)
+		}
+		return password, nil
+	}
+
+	return viper.GetString("auth.password"), nil
+}
+
+// runPasswordCommand runs command with the shell. The terminal is passed on
+// so that e.g. gpg can ask for a passphrase.
+func runPasswordCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	// like pass, extra lines may hold other data
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	if !scanner.Scan() || scanner.Text() == "" {
+		return "", fmt.Errorf("%q printed no password", command)
+	}
+	return scanner.Text(), nil
+}
+
+// lookupKeyring is replaced in tests, which don't have a session bus
+var lookupKeyring = keyringPassword
+
+// keyringPassword looks up the item stored with
+// secret-tool store --label=stmp service stmp server <host> username <username>
+func keyringPassword(username, host string) (string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return keyring.Lookup(conn, map[string]string{
+		"service":  "stmp",
+		"server":   host,
+		"username": username,
+	})
+}
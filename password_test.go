@@ -0,0 +1,73 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolvePassword(t *testing.T) {
+	keyringErr := errors.New("no such item")
+
+	for _, tc := range []struct {
+		name     string
+		env      string
+		command  string
+		keyring  bool
+		password string
+
+		expected string
+		err      string
+	}{
+		{name: "env beats command", env: "env", command: "echo command", keyring: true, password: "plain", expected: "env"},
+		{name: "command beats keyring", command: "echo command", keyring: true, password: "plain", expected: "command"},
+		{name: "first line of command", command: "printf 'command\\nurl: x\\n'", expected: "command"},
+		{name: "keyring beats plaintext", keyring: true, password: "plain", expected: "keyring"},
+		{name: "plaintext", password: "plain", expected: "plain"},
+		{name: "nothing set"},
+		{name: "failing command", command: "exit 1", password: "plain", err: "auth.password_command"},
+		{name: "command without output", command: "true", password: "plain", err: "printed no password"},
+		{name: "failing keyring", keyring: true, password: "plain", err: "keyring"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			t.Setenv(passwordEnv, tc.env)
+			if tc.env == "" {
+				os.Unsetenv(passwordEnv)
+			}
+
+			lookupKeyring = func(username, host string) (string, error) {
+				if tc.err == "keyring" {
+					return "", keyringErr
+				}
+				return "keyring", nil
+			}
+			t.Cleanup(func() { lookupKeyring = keyringPassword })
+
+			viper.Set("auth.password_command", tc.command)
+			viper.Set("auth.keyring", tc.keyring)
+			viper.Set("auth.password", tc.password)
+
+			password, err := resolvePassword()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v (password %q)", tc.err, err, password)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if password != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import "math"
+
+const EqualizerBands = 10
+
+// EqualizerFrequencies are the center frequencies of the bands in Hz, one
+// octave apart
+var EqualizerFrequencies = [EqualizerBands]int{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// highest boost or cut of a band in dB
+const EqualizerMaxGain = 12
+
+// Equalizer holds the gain of each band in dB
+type Equalizer [EqualizerBands]float64
+
+// IsFlat returns true if the equalizer doesn't change the sound
+func (e Equalizer) IsFlat() bool {
+	return e == Equalizer{}
+}
+
+// Clamp limits the gains to EqualizerMaxGain
+func (e Equalizer) Clamp() Equalizer {
+	for i, gain := range e {
+		e[i] = math.Max(-EqualizerMaxGain, math.Min(gain, EqualizerMaxGain))
+	}
+	return e
+}
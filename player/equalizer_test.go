@@ -0,0 +1,16 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import "testing"
+
+func TestEqualizerClamp(t *testing.T) {
+	clamped := Equalizer{20, -20, 3}.Clamp()
+	if clamped[0] != EqualizerMaxGain || clamped[1] != -EqualizerMaxGain || clamped[2] != 3 {
+		t.Errorf("unexpected clamped gains %v", clamped)
+	}
+	if !(Equalizer{}).IsFlat() || clamped.IsFlat() {
+		t.Error("only the equalizer without gains is flat")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package player holds what the players have in common: the interface the ui
+// controls them through, the events they report and the play queue. It doesn't
+// need cgo, mpvplayer implements the interface with libmpv.
+package player
+
+import (
+	"time"
+
+	"github.com/spezifisch/stmps/remote"
+)
+
+type UiEventType int
+
+const (
+	// song stopped at end of queue, data: nil
+	EventStopped UiEventType = iota
+	// new song started playing, data: QueueItem
+	EventPlaying
+	// unpaused/paused song, data: QueueItem
+	EventUnpaused
+	EventPaused
+	// UI status update of all fields, data: StatusData
+	EventStatus
+	// a single field of the status changed, the others are as before. data:
+	// StatusData
+	EventPosition
+	EventDuration
+	EventVolume
+	EventMute
+	// shuffle or repeat mode changed, data: Modes
+	EventModes
+	// playback resumed after seeking, data: StatusData
+	EventSeeked
+	// tags of the stream changed, data: map[string]string
+	EventMetadata
+	// format of the decoded audio changed, data: AudioParams
+	EventAudioParams
+	// buffered part of the song changed, data: CacheState
+	EventCache
+	// sleep timer counted down or was changed, data: SleepState
+	EventSleep
+	// a song failed to play twice and was skipped, data: PlaybackError
+	EventFailed
+)
+
+type UiEvent struct {
+	Type UiEventType
+	Data interface{}
+}
+
+type EventConsumer interface {
+	// create event that goes from a player to a UI frontend
+	SendEvent(event UiEvent)
+}
+
+// PlayerInterface is implemented by everything that can play the queue: the
+// mpv player, the server's jukebox and the fake player of the demo mode. State
+// changes are reported as UiEvents to the registered EventConsumer.
+type PlayerInterface interface {
+	remote.ControlledPlayer
+
+	RegisterEventConsumer(consumer EventConsumer)
+	// runs until Quit is called
+	EventLoop()
+	Quit()
+
+	// transport
+	PlayNextTrack() error
+	PlayUri(item *QueueItem) error
+	PlayItems(items PlayerQueue) error
+	PlayQueueItem(index int) error
+	Seek(increment int) error
+	SeekPercent(percent float64) error
+
+	// volume and sound
+	GetVolume() int
+	AdjustVolume(increment int) error
+	GetModes() Modes
+	GetReplayGain() ReplayGain
+	SetReplayGain(settings ReplayGain) error
+	GetEqualizer() Equalizer
+	SetEqualizer(equalizer Equalizer) error
+	GetAudioDevices() ([]AudioDevice, error)
+	GetAudioDevice() (string, error)
+	SetAudioDevice(name string, exclusive bool) error
+
+	// sleep timer
+	GetSleepState() SleepState
+	SetSleepTimer(duration time.Duration) error
+	SetSleepAtEndOfAlbum() error
+	SetStopAfterCurrent(stop bool) error
+
+	// queue management
+	LoadQueue(items PlayerQueue, current int, played []bool, position float64) error
+	ClearQueue()
+	DeleteQueueItem(index int)
+	AddToQueue(item *QueueItem)
+	InsertNext(item *QueueItem)
+	MoveQueueItem(from, to int) error
+	GetQueueItem(index int) (QueueItem, error)
+	GetQueueCopy() (queue PlayerQueue, current int, played []bool)
+	GetPlayingTrack() (QueueItem, error)
+}
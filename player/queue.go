@@ -0,0 +1,390 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/spezifisch/stmps/remote"
+)
+
+// MaxHistory is the number of played songs kept in the queue
+const MaxHistory = 100
+
+// Queue is the queue in the order it's shown and the order it's played
+// in, which differs when shuffling. Songs before the current one in play order
+// were played. It isn't safe for concurrent use, players guard it with their
+// mutex.
+type Queue struct {
+	items PlayerQueue
+	// indexes of items in play order
+	order []int
+	// position of the current song in order, len(order) after the last song
+	// ended
+	position int
+
+	shuffle bool
+	repeat  remote.RepeatMode
+	random  *rand.Rand
+}
+
+func NewQueue() Queue {
+	return Queue{
+		items:  make(PlayerQueue, 0),
+		order:  make([]int, 0),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// CurrentIndex returns the index of the current song in items, len(items) if
+// there is none
+func (q *Queue) CurrentIndex() int {
+	if q.position >= len(q.order) {
+		return len(q.items)
+	}
+	return q.order[q.position]
+}
+
+// Len returns the number of songs including the played ones
+func (q *Queue) Len() int {
+	return len(q.items)
+}
+
+// Item returns the song at index in queue order
+func (q *Queue) Item(index int) (QueueItem, bool) {
+	if index < 0 || index >= len(q.items) {
+		return QueueItem{}, false
+	}
+	return q.items[index], true
+}
+
+// Items returns a copy of the songs in queue order
+func (q *Queue) Items() PlayerQueue {
+	items := make(PlayerQueue, len(q.items))
+	copy(items, q.items)
+	return items
+}
+
+// Position returns the position of the current song in play order, which is
+// the number of songs played before it
+func (q *Queue) Position() int {
+	return q.position
+}
+
+func (q *Queue) Shuffle() bool {
+	return q.shuffle
+}
+
+func (q *Queue) Repeat() remote.RepeatMode {
+	return q.repeat
+}
+
+func (q *Queue) SetRepeat(mode remote.RepeatMode) {
+	q.repeat = mode
+}
+
+func (q *Queue) Current() (QueueItem, bool) {
+	return q.At(q.position)
+}
+
+// SetError marks the current song as failed, or clears the mark if err is
+// empty
+func (q *Queue) SetError(err string) {
+	if q.position < len(q.order) {
+		q.items[q.order[q.position]].Error = err
+	}
+}
+
+// At returns the song at position in play order
+func (q *Queue) At(position int) (QueueItem, bool) {
+	if position < 0 || position >= len(q.order) {
+		return QueueItem{}, false
+	}
+	return q.items[q.order[position]], true
+}
+
+// nextPosition returns the position of the song that follows the current one.
+// At the end of a song it's repeated with RepeatOne, skipping it goes on.
+func (q *Queue) nextPosition(songEnded bool) (int, bool) {
+	if songEnded && q.repeat == remote.RepeatOne && q.position < len(q.order) {
+		return q.position, true
+	}
+	next := q.position + 1
+	if next < len(q.order) {
+		return next, true
+	}
+	if q.repeat == remote.RepeatAll && len(q.order) > 0 {
+		return 0, true
+	}
+	return len(q.order), false
+}
+
+// Next returns the song that follows the current one
+func (q *Queue) Next(songEnded bool) (QueueItem, bool) {
+	position, ok := q.nextPosition(songEnded)
+	if !ok {
+		return QueueItem{}, false
+	}
+	return q.At(position)
+}
+
+// Advance moves on to the song that follows the current one, or to the end
+func (q *Queue) Advance(songEnded bool) {
+	q.position, _ = q.nextPosition(songEnded)
+	q.trimHistory()
+}
+
+// Previous goes back one song, it returns false if there is none
+func (q *Queue) Previous() bool {
+	if q.position > 0 {
+		q.position--
+		return true
+	}
+	if q.repeat == remote.RepeatAll && len(q.order) > 1 {
+		q.position = len(q.order) - 1
+		return true
+	}
+	return false
+}
+
+// trimHistory removes the oldest played songs if there are more than
+// MaxHistory. They are kept when repeating the queue.
+func (q *Queue) trimHistory() {
+	if q.repeat == remote.RepeatAll {
+		return
+	}
+	for q.position > MaxHistory {
+		q.Remove(q.order[0])
+	}
+}
+
+// Add appends a song to the queue. When shuffling it's played at a random
+// time after the current song.
+func (q *Queue) Add(item QueueItem) {
+	q.items = append(q.items, item)
+	index := len(q.items) - 1
+
+	position := len(q.order)
+	if q.shuffle && q.position < len(q.order) {
+		position = q.position + 1 + q.random.Intn(len(q.order)-q.position)
+	}
+	q.order = append(q.order, 0)
+	copy(q.order[position+1:], q.order[position:])
+	q.order[position] = index
+}
+
+// Remove deletes the song at index in items. It returns true if it was the
+// current song, the following song is current then.
+func (q *Queue) Remove(index int) (wasCurrent bool) {
+	q.items = append(q.items[:index], q.items[index+1:]...)
+
+	removed := -1
+	for position, i := range q.order {
+		if i == index {
+			removed = position
+		} else if i > index {
+			q.order[position]--
+		}
+	}
+	q.order = append(q.order[:removed], q.order[removed+1:]...)
+
+	wasCurrent = removed == q.position
+	if removed < q.position {
+		q.position--
+	}
+	return
+}
+
+func (q *Queue) Clear() {
+	q.items = make(PlayerQueue, 0)
+	q.order = make([]int, 0)
+	q.position = 0
+}
+
+// ReplaceUpcoming replaces the songs after the current one with items, the
+// first of which becomes the current song. Played songs are kept in the order
+// they were played.
+func (q *Queue) ReplaceUpcoming(items ...QueueItem) {
+	played := q.position
+	if played < len(q.order) {
+		// the current song counts as played
+		played++
+	}
+
+	queue := make(PlayerQueue, 0, played+len(items))
+	for _, index := range q.order[:played] {
+		queue = append(queue, q.items[index])
+	}
+	q.items = append(queue, items...)
+	q.order = make([]int, len(q.items))
+	for i := range q.order {
+		q.order[i] = i
+	}
+	q.position = played
+	if q.shuffle {
+		q.shuffleUpcoming()
+	}
+	q.trimHistory()
+}
+
+// Restore replaces the queue with items, the song at current becomes the
+// current one. When shuffling the played songs come first in play order and
+// the upcoming ones are shuffled, otherwise the songs before current were
+// played.
+func (q *Queue) Restore(items PlayerQueue, current int, played []bool) {
+	if current < 0 || current > len(items) {
+		current = len(items)
+	}
+	q.items = append(make(PlayerQueue, 0, len(items)), items...)
+	q.order = make([]int, 0, len(items))
+
+	if !q.shuffle {
+		for i := range q.items {
+			q.order = append(q.order, i)
+		}
+		q.position = current
+		q.trimHistory()
+		return
+	}
+
+	wasPlayed := func(i int) bool {
+		return i != current && i < len(played) && played[i]
+	}
+	for i := range q.items {
+		if wasPlayed(i) {
+			q.order = append(q.order, i)
+		}
+	}
+	q.position = len(q.order)
+	if current < len(q.items) {
+		q.order = append(q.order, current)
+	}
+	for i := range q.items {
+		if i != current && !wasPlayed(i) {
+			q.order = append(q.order, i)
+		}
+	}
+	q.shuffleUpcoming()
+	q.trimHistory()
+}
+
+// InsertNext inserts a song after the current one in both queue and play
+// order. At the end of the queue it becomes the current song.
+func (q *Queue) InsertNext(item QueueItem) {
+	index := len(q.items)
+	if q.position < len(q.order) {
+		index = q.order[q.position] + 1
+	}
+	q.items = append(q.items, QueueItem{})
+	copy(q.items[index+1:], q.items[index:])
+	q.items[index] = item
+
+	for position, i := range q.order {
+		if i >= index {
+			q.order[position]++
+		}
+	}
+	position := len(q.order)
+	if q.position < len(q.order) {
+		position = q.position + 1
+	}
+	q.order = append(q.order, 0)
+	copy(q.order[position+1:], q.order[position:])
+	q.order[position] = index
+}
+
+// Move moves the song at index from to index to in items. The play order
+// stays the same when shuffling, otherwise it follows the new queue order.
+func (q *Queue) Move(from, to int) {
+	if from == to {
+		return
+	}
+	item := q.items[from]
+	if from < to {
+		copy(q.items[from:], q.items[from+1:to+1])
+	} else {
+		copy(q.items[to+1:], q.items[to:from])
+	}
+	q.items[to] = item
+
+	for position, i := range q.order {
+		switch {
+		case i == from:
+			q.order[position] = to
+		case from < to && i > from && i <= to:
+			q.order[position]--
+		case to < from && i >= to && i < from:
+			q.order[position]++
+		}
+	}
+
+	if !q.shuffle {
+		current := q.CurrentIndex()
+		for i := range q.order {
+			q.order[i] = i
+		}
+		q.position = current
+	}
+}
+
+// JumpTo makes the song at index in items the current one. When shuffling an
+// upcoming song is moved up in play order, so that the songs skipped over are
+// still played later.
+func (q *Queue) JumpTo(index int) {
+	target := 0
+	for position, i := range q.order {
+		if i == index {
+			target = position
+			break
+		}
+	}
+
+	if q.shuffle && target > q.position && q.position < len(q.order) {
+		copy(q.order[q.position+2:target+1], q.order[q.position+1:target])
+		q.order[q.position+1] = index
+		target = q.position + 1
+	}
+	q.position = target
+	q.trimHistory()
+}
+
+// SetShuffle shuffles the songs after the current one, or returns to the
+// order of the queue after the current song
+func (q *Queue) SetShuffle(shuffle bool) {
+	if shuffle == q.shuffle {
+		return
+	}
+	q.shuffle = shuffle
+
+	if shuffle {
+		q.shuffleUpcoming()
+		return
+	}
+
+	current := q.CurrentIndex()
+	for i := range q.order {
+		q.order[i] = i
+	}
+	q.position = current
+}
+
+// shuffleUpcoming puts the songs after the current one in random order
+func (q *Queue) shuffleUpcoming() {
+	if q.position+1 < len(q.order) {
+		upcoming := q.order[q.position+1:]
+		q.random.Shuffle(len(upcoming), func(i, j int) {
+			upcoming[i], upcoming[j] = upcoming[j], upcoming[i]
+		})
+	}
+}
+
+// Played returns which songs in items were played
+func (q *Queue) Played() []bool {
+	played := make([]bool, len(q.items))
+	for _, index := range q.order[:q.position] {
+		played[index] = true
+	}
+	return played
+}
@@ -0,0 +1,102 @@
+package player
+
+import (
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+var _ remote.TrackInterface = (*QueueItem)(nil)
+
+// NewQueueItem copies the metadata of a song entity into a queue item
+func NewQueueItem(entity *subsonic.SubsonicEntity, uri string) QueueItem {
+	return QueueItem{
+		Id:       entity.Id,
+		Uri:      uri,
+		Title:    entity.GetSongTitle(),
+		Artist:   entity.Artist,
+		Duration: entity.Duration,
+
+		Album:       entity.Album,
+		AlbumId:     entity.AlbumId,
+		ArtistId:    entity.ArtistId,
+		Track:       entity.Track,
+		DiskNumber:  entity.DiskNumber,
+		Year:        entity.Year,
+		Genre:       entity.Genre,
+		CoverArtId:  entity.CoverArtId,
+		Suffix:      entity.Suffix,
+		ContentType: entity.ContentType,
+		MediaType:   entity.Type,
+		BitRate:     entity.BitRate,
+		Size:        entity.Size,
+
+		ReplayGain: entity.ReplayGain,
+	}
+}
+
+func (q *QueueItem) GetId() string {
+	if q == nil {
+		return ""
+	}
+	return q.Id
+}
+
+func (q *QueueItem) GetArtist() string {
+	if q == nil {
+		return ""
+	}
+	return q.Artist
+}
+
+func (q *QueueItem) GetTitle() string {
+	if q == nil {
+		return ""
+	}
+	return q.Title
+}
+
+func (q *QueueItem) GetDuration() int {
+	if q == nil {
+		return 0
+	}
+	return q.Duration
+}
+
+func (q *QueueItem) IsValid() bool {
+	return q != nil && q.Id != ""
+}
+
+func (q *QueueItem) GetAlbum() string {
+	if q == nil {
+		return ""
+	}
+	return q.Album
+}
+
+func (q *QueueItem) GetTrackNumber() int {
+	if q == nil {
+		return 0
+	}
+	return q.Track
+}
+
+func (q *QueueItem) GetDiskNumber() int {
+	if q == nil {
+		return 0
+	}
+	return q.DiskNumber
+}
+
+func (q *QueueItem) GetYear() int {
+	if q == nil {
+		return 0
+	}
+	return q.Year
+}
+
+func (q *QueueItem) GetGenre() string {
+	if q == nil {
+		return ""
+	}
+	return q.Genre
+}
@@ -0,0 +1,332 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/spezifisch/stmps/remote"
+)
+
+func testItem(n int) *QueueItem {
+	return &QueueItem{
+		Id:    fmt.Sprintf("tr-%d", n),
+		Uri:   fmt.Sprintf("http://test/%d", n),
+		Title: fmt.Sprintf("Track %d", n),
+	}
+}
+
+func testPlayQueue(n int) Queue {
+	q := NewQueue()
+	q.random = rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		q.Add(*testItem(i))
+	}
+	return q
+}
+
+// checkOrder fails if order isn't a permutation of the item indexes
+func checkOrder(t *testing.T, q *Queue) {
+	t.Helper()
+	order := append([]int(nil), q.order...)
+	sort.Ints(order)
+	if len(order) != len(q.items) {
+		t.Fatalf("order %v doesn't match %d items", q.order, len(q.items))
+	}
+	for i, index := range order {
+		if i != index {
+			t.Fatalf("order %v isn't a permutation", q.order)
+		}
+	}
+}
+
+// playAll advances to the end and returns the ids in play order
+func playAll(q *Queue) (ids []string) {
+	for {
+		item, ok := q.Current()
+		if !ok {
+			return
+		}
+		ids = append(ids, item.Id)
+		q.Advance(true)
+	}
+}
+
+func TestPlayQueueShuffle(t *testing.T) {
+	q := testPlayQueue(20)
+	q.Advance(true)
+
+	q.SetShuffle(true)
+	checkOrder(t, &q)
+	if q.items[5].Id != "tr-5" {
+		t.Error("shuffling must not reorder the queue")
+	}
+	if current, _ := q.Current(); current.Id != "tr-1" || q.order[0] != 0 {
+		t.Errorf("shuffling must keep played and current songs, order %v", q.order)
+	}
+
+	// songs added while shuffling are played after the current song
+	q.Add(*testItem(20))
+	checkOrder(t, &q)
+	if q.order[0] != 0 || q.order[1] != 1 {
+		t.Errorf("unexpected order %v", q.order)
+	}
+
+	ids := playAll(&q)
+	if len(ids) != 20 {
+		t.Fatalf("expected 20 songs played, got %v", ids)
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	if len(seen) != 20 || seen["tr-0"] {
+		t.Errorf("every upcoming song must be played once, got %v", ids)
+	}
+	sorted := sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if sorted {
+		t.Errorf("expected random order, got %v", ids)
+	}
+}
+
+func TestPlayQueueUnshuffle(t *testing.T) {
+	q := testPlayQueue(10)
+	q.SetShuffle(true)
+	q.Advance(false)
+	q.Advance(false)
+	current, _ := q.Current()
+
+	// continue after the current song in queue order
+	q.SetShuffle(false)
+	checkOrder(t, &q)
+	if again, _ := q.Current(); again.Id != current.Id {
+		t.Errorf("current song changed from %s to %s", current.Id, again.Id)
+	}
+	if q.CurrentIndex() != q.position {
+		t.Errorf("expected queue order, got %v at %d", q.order, q.position)
+	}
+	played := q.Played()
+	for i := range played {
+		if played[i] != (i < q.CurrentIndex()) {
+			t.Errorf("unexpected played songs %v", played)
+			break
+		}
+	}
+}
+
+func TestPlayQueueRepeat(t *testing.T) {
+	q := testPlayQueue(3)
+
+	q.repeat = remote.RepeatOne
+	q.Advance(true)
+	if current, _ := q.Current(); current.Id != "tr-0" {
+		t.Errorf("repeat one must repeat the song at its end, got %s", current.Id)
+	}
+	q.Advance(false)
+	if current, _ := q.Current(); current.Id != "tr-1" {
+		t.Errorf("skipping must go on with repeat one, got %s", current.Id)
+	}
+
+	q.repeat = remote.RepeatAll
+	q.Advance(true)
+	q.Advance(true)
+	if current, _ := q.Current(); current.Id != "tr-0" {
+		t.Errorf("repeat all must start over, got %s", current.Id)
+	}
+	if !q.Previous() {
+		t.Fatal("repeat all must go back from the first song")
+	}
+	if current, _ := q.Current(); current.Id != "tr-2" {
+		t.Errorf("expected last song, got %s", current.Id)
+	}
+
+	q.repeat = remote.RepeatOff
+	q.Advance(true)
+	if _, ok := q.Current(); ok || q.position != 3 {
+		t.Errorf("expected end of queue, position %d", q.position)
+	}
+	if _, ok := q.Next(true); ok {
+		t.Error("no song follows the end of the queue")
+	}
+}
+
+func TestPlayQueueRemove(t *testing.T) {
+	q := testPlayQueue(6)
+	q.SetShuffle(true)
+	q.Advance(true)
+	q.Advance(true)
+	current, _ := q.Current()
+
+	// a played song
+	played := q.order[0]
+	if q.Remove(played) {
+		t.Error("removed song wasn't current")
+	}
+	checkOrder(t, &q)
+	if again, _ := q.Current(); again.Id != current.Id || q.position != 1 {
+		t.Errorf("current song changed from %s to %s", current.Id, again.Id)
+	}
+
+	// the current song, the next one follows
+	next, _ := q.Next(false)
+	if !q.Remove(q.CurrentIndex()) {
+		t.Error("removed song was current")
+	}
+	checkOrder(t, &q)
+	if again, _ := q.Current(); again.Id != next.Id {
+		t.Errorf("expected %s to follow, got %s", next.Id, again.Id)
+	}
+}
+
+func TestPlayQueueReplaceUpcoming(t *testing.T) {
+	q := testPlayQueue(5)
+	q.Advance(true)
+
+	q.ReplaceUpcoming(*testItem(9))
+	checkOrder(t, &q)
+	if len(q.items) != 3 || q.position != 2 {
+		t.Fatalf("unexpected queue %v at %d", q.items, q.position)
+	}
+	if current, _ := q.Current(); current.Id != "tr-9" {
+		t.Errorf("expected new song current, got %s", current.Id)
+	}
+	if played := q.Played(); !played[0] || !played[1] || played[2] {
+		t.Errorf("unexpected played songs %v", played)
+	}
+}
+
+func TestPlayQueueInsertNext(t *testing.T) {
+	q := testPlayQueue(4)
+	q.Advance(true)
+
+	q.InsertNext(*testItem(9))
+	checkOrder(t, &q)
+	if q.items[2].Id != "tr-9" {
+		t.Errorf("expected song after the current one, got %v", q.items)
+	}
+	if next, _ := q.Next(false); next.Id != "tr-9" {
+		t.Errorf("expected tr-9 next, got %s", next.Id)
+	}
+
+	// also next when shuffling
+	q.SetShuffle(true)
+	q.InsertNext(*testItem(8))
+	checkOrder(t, &q)
+	if next, _ := q.Next(false); next.Id != "tr-8" {
+		t.Errorf("expected tr-8 next, got %s", next.Id)
+	}
+
+	// at the end of the queue it's played right away
+	playAll(&q)
+	q.InsertNext(*testItem(7))
+	checkOrder(t, &q)
+	if current, ok := q.Current(); !ok || current.Id != "tr-7" {
+		t.Errorf("expected tr-7 current, got %s", current.Id)
+	}
+}
+
+func TestPlayQueueMove(t *testing.T) {
+	q := testPlayQueue(5)
+	q.Advance(true)
+
+	// an upcoming song before the current one
+	q.Move(3, 0)
+	checkOrder(t, &q)
+	if q.items[0].Id != "tr-3" || q.items[2].Id != "tr-1" {
+		t.Fatalf("unexpected queue %v", q.items)
+	}
+	if current, _ := q.Current(); current.Id != "tr-1" || q.CurrentIndex() != 2 {
+		t.Errorf("current song changed to %s", current.Id)
+	}
+	if played := q.Played(); !played[0] || !played[1] || played[3] {
+		t.Errorf("queue order decides what was played, got %v", played)
+	}
+
+	// the current song
+	q.Move(2, 4)
+	checkOrder(t, &q)
+	if current, _ := q.Current(); current.Id != "tr-1" || q.CurrentIndex() != 4 {
+		t.Errorf("current song changed to %s", current.Id)
+	}
+
+	// the play order stays when shuffling
+	q = testPlayQueue(5)
+	q.SetShuffle(true)
+	ids := []string{}
+	for _, index := range q.order {
+		ids = append(ids, q.items[index].Id)
+	}
+	q.Move(4, 1)
+	q.Move(0, 3)
+	checkOrder(t, &q)
+	for position, index := range q.order {
+		if q.items[index].Id != ids[position] {
+			t.Fatalf("play order changed from %v at %d", ids, position)
+		}
+	}
+}
+
+func TestPlayQueueJumpTo(t *testing.T) {
+	q := testPlayQueue(5)
+	q.JumpTo(3)
+	if current, _ := q.Current(); current.Id != "tr-3" {
+		t.Errorf("expected tr-3 current, got %s", current.Id)
+	}
+	q.JumpTo(1)
+	if next, _ := q.Next(false); next.Id != "tr-2" {
+		t.Errorf("expected queue order to continue, got %s", next.Id)
+	}
+
+	// songs skipped over are still played when shuffling
+	q = testPlayQueue(10)
+	q.SetShuffle(true)
+	target := q.order[6]
+	q.JumpTo(target)
+	checkOrder(t, &q)
+	if q.CurrentIndex() != target || q.position != 1 {
+		t.Errorf("expected %d current at 1, got %d at %d", target, q.CurrentIndex(), q.position)
+	}
+	if len(playAll(&q)) != 9 {
+		t.Error("expected the remaining songs to be played")
+	}
+}
+
+func TestPlayQueueRestore(t *testing.T) {
+	items := testPlayQueue(5).items
+
+	q := testPlayQueue(0)
+	q.Restore(items, 2, nil)
+	checkOrder(t, &q)
+	if current, _ := q.Current(); current.Id != "tr-2" {
+		t.Errorf("expected tr-2 current, got %s", current.Id)
+	}
+	if played := q.Played(); !played[0] || !played[1] || played[2] {
+		t.Errorf("expected the songs before the current one played, got %v", played)
+	}
+
+	// shuffled, tr-1 and tr-3 were played
+	q = testPlayQueue(0)
+	q.SetShuffle(true)
+	q.Restore(items, 4, []bool{false, true, false, true, false})
+	checkOrder(t, &q)
+	if current, _ := q.Current(); current.Id != "tr-4" || q.position != 2 {
+		t.Errorf("expected tr-4 current after 2 played songs, got %s at %d", current.Id, q.position)
+	}
+	if played := q.Played(); played[0] || !played[1] || played[2] || !played[3] || played[4] {
+		t.Errorf("unexpected played songs %v", played)
+	}
+	if ids := playAll(&q); len(ids) != 3 {
+		t.Errorf("expected 3 songs left, got %v", ids)
+	}
+
+	// no current song
+	q = testPlayQueue(0)
+	q.Restore(items, 5, nil)
+	if _, ok := q.Current(); ok {
+		t.Error("expected no current song")
+	}
+}
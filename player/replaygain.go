@@ -0,0 +1,50 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import "fmt"
+
+// ReplayGainMode selects which ReplayGain values adjust the volume
+type ReplayGainMode int
+
+const (
+	ReplayGainOff ReplayGainMode = iota
+	// every track has the same loudness
+	ReplayGainTrack
+	// albums have the same loudness, keeping the differences between their
+	// tracks
+	ReplayGainAlbum
+)
+
+func (m ReplayGainMode) String() string {
+	switch m {
+	case ReplayGainTrack:
+		return "track"
+	case ReplayGainAlbum:
+		return "album"
+	}
+	return "off"
+}
+
+// ParseReplayGainMode reads a mode as returned by String
+func ParseReplayGainMode(mode string) (ReplayGainMode, error) {
+	switch mode {
+	case "off", "":
+		return ReplayGainOff, nil
+	case "track":
+		return ReplayGainTrack, nil
+	case "album":
+		return ReplayGainAlbum, nil
+	}
+	return ReplayGainOff, fmt.Errorf("invalid replaygain mode %q", mode)
+}
+
+// ReplayGain are the volume normalisation settings
+type ReplayGain struct {
+	Mode ReplayGainMode
+	// added to the gain, in dB
+	Preamp float64
+	// lower the gain so that the peak doesn't clip
+	PreventClip bool
+}
@@ -0,0 +1,21 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import "time"
+
+// SleepState tells when playback is going to stop
+type SleepState struct {
+	// time until the sleep timer stops playback, 0 if there is none
+	Remaining time.Duration
+	// the sleep timer ends with the last song of the current album
+	EndOfAlbum bool
+	// playback stops when the current song ended
+	StopAfterCurrent bool
+}
+
+// IsActive returns true if the sleep timer runs or stop after current is set
+func (s SleepState) IsActive() bool {
+	return s.Remaining > 0 || s.EndOfAlbum || s.StopAfterCurrent
+}
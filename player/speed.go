@@ -0,0 +1,30 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import "strings"
+
+// ContentKind tells music from spoken word, each kind has its own speed
+type ContentKind string
+
+const (
+	ContentMusic ContentKind = "music"
+	// podcasts and audiobooks
+	ContentPodcast ContentKind = "podcast"
+)
+
+// Kind returns the content kind of the song, by its Subsonic media type or
+// its genre
+func (q *QueueItem) Kind() ContentKind {
+	if q == nil {
+		return ContentMusic
+	}
+	for _, value := range []string{q.MediaType, q.Genre} {
+		value = strings.ToLower(value)
+		if strings.Contains(value, "podcast") || strings.Contains(value, "audiobook") {
+			return ContentPodcast
+		}
+	}
+	return ContentMusic
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package player
+
+import (
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// PreviousTrack restarts the current song instead of going back to the
+// previous one once it played for more than this many seconds
+const RestartThreshold = 3
+
+// MaxFailures is the number of songs in a row that may fail before playback
+// stops, so that an unreachable server doesn't skip through the whole queue
+const MaxFailures = 3
+
+type QueueItem struct {
+	Id       string
+	Uri      string
+	Title    string
+	Artist   string
+	Duration int
+
+	Album       string
+	AlbumId     string
+	ArtistId    string
+	Track       int
+	DiskNumber  int
+	Year        int
+	Genre       string
+	CoverArtId  string
+	Suffix      string
+	ContentType string
+	// Subsonic media type: music, podcast, audiobook or video
+	MediaType string
+	BitRate   int // kbps
+	Size      int64
+
+	ReplayGain subsonic.SubsonicReplayGain
+
+	// why the song couldn't be played, empty unless it failed
+	Error string
+}
+
+type PlayerQueue []QueueItem
+
+// StatusData is a player progress report for the UI
+type StatusData struct {
+	Volume   int64
+	Muted    bool
+	Position int64
+	Duration int64
+}
+
+// Modes are the playback modes of the player
+type Modes struct {
+	Shuffle    bool
+	Repeat     remote.RepeatMode
+	ReplayGain ReplayGainMode
+	Speed      float64
+}
+
+// AudioDevice is an audio output as listed by mpv
+type AudioDevice struct {
+	// e.g. "auto", "pulse/alsa_output.usb-dac" or "null"
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AudioParams is the format of the decoded audio
+type AudioParams struct {
+	// sample format, e.g. "s16" or "floatp"
+	Format     string `json:"format"`
+	SampleRate int    `json:"samplerate"`
+	// e.g. "stereo" or "5.1"
+	Channels string `json:"hr-channels"`
+}
+
+// CacheState tells how much of the song mpv has buffered
+type CacheState struct {
+	// seconds buffered ahead of the position
+	Duration float64 `json:"cache-duration"`
+	// the rest of the song is buffered
+	EOF bool `json:"eof"`
+}
+
+// PlaybackError tells the gui about a song that failed twice and was skipped
+type PlaybackError struct {
+	Item QueueItem
+	Err  error
+	// playback stopped since MaxFailures songs failed in a row
+	Stopped bool
+}
@@ -0,0 +1,350 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/jukebox"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+)
+
+// uiPlayer is the player the ui controls. Besides playing locally it can
+// hand playback over to the server's jukebox.
+type uiPlayer interface {
+	player.PlayerInterface
+
+	IsJukebox() bool
+	SetJukebox(enabled bool) error
+}
+
+// playerSwitch forwards all calls to either local playback, with mpv or the
+// fake player in demo mode, or the server's jukebox. Events and callbacks of
+// the inactive player are dropped.
+type playerSwitch struct {
+	local   player.PlayerInterface
+	jukebox *jukebox.Player
+
+	mutex         sync.RWMutex
+	jukeboxActive bool
+
+	eventConsumer player.EventConsumer
+}
+
+var _ uiPlayer = (*playerSwitch)(nil)
+
+func newPlayerSwitch(local player.PlayerInterface, jukebox *jukebox.Player) *playerSwitch {
+	s := &playerSwitch{
+		local:   local,
+		jukebox: jukebox,
+	}
+
+	local.RegisterEventConsumer(&switchedConsumer{s, false})
+	jukebox.RegisterEventConsumer(&switchedConsumer{s, true})
+	return s
+}
+
+// switchedConsumer passes events on if they come from the active player
+type switchedConsumer struct {
+	s       *playerSwitch
+	jukebox bool
+}
+
+func (c *switchedConsumer) SendEvent(event player.UiEvent) {
+	if c.s.IsJukebox() == c.jukebox && c.s.eventConsumer != nil {
+		c.s.eventConsumer.SendEvent(event)
+	}
+}
+
+// IsJukebox returns true if the server's jukebox is controlled
+func (s *playerSwitch) IsJukebox() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.jukeboxActive
+}
+
+// SetJukebox switches between local playback and the server's jukebox.
+// Local playback is stopped when switching to the jukebox, the jukebox keeps
+// playing when switching back.
+func (s *playerSwitch) SetJukebox(enabled bool) error {
+	if enabled == s.IsJukebox() {
+		return nil
+	}
+
+	if enabled {
+		if err := s.jukebox.Check(); err != nil {
+			return err
+		}
+		if err := s.local.Stop(); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	s.jukeboxActive = enabled
+	s.mutex.Unlock()
+
+	// the newly active player announces its state
+	s.jukebox.SetPolling(enabled)
+	if !enabled && s.eventConsumer != nil {
+		s.eventConsumer.SendEvent(player.UiEvent{Type: player.EventStopped})
+	}
+	return nil
+}
+
+func (s *playerSwitch) active() player.PlayerInterface {
+	if s.IsJukebox() {
+		return s.jukebox
+	}
+	return s.local
+}
+
+func (s *playerSwitch) RegisterEventConsumer(consumer player.EventConsumer) {
+	s.eventConsumer = consumer
+}
+
+// EventLoop runs the event loops of both players
+func (s *playerSwitch) EventLoop() {
+	go s.jukebox.EventLoop()
+	s.local.EventLoop()
+}
+
+func (s *playerSwitch) Quit() {
+	s.jukebox.Quit()
+	s.local.Quit()
+}
+
+func (s *playerSwitch) PlayNextTrack() error {
+	return s.active().PlayNextTrack()
+}
+
+func (s *playerSwitch) PlayUri(item *player.QueueItem) error {
+	return s.active().PlayUri(item)
+}
+
+func (s *playerSwitch) PlayItems(items player.PlayerQueue) error {
+	return s.active().PlayItems(items)
+}
+
+func (s *playerSwitch) PlayQueueItem(index int) error {
+	return s.active().PlayQueueItem(index)
+}
+
+func (s *playerSwitch) GetVolume() int {
+	return s.active().GetVolume()
+}
+
+func (s *playerSwitch) AdjustVolume(increment int) error {
+	return s.active().AdjustVolume(increment)
+}
+
+func (s *playerSwitch) Seek(increment int) error {
+	return s.active().Seek(increment)
+}
+
+func (s *playerSwitch) SeekPercent(percent float64) error {
+	return s.active().SeekPercent(percent)
+}
+
+func (s *playerSwitch) GetSleepState() player.SleepState {
+	return s.active().GetSleepState()
+}
+
+func (s *playerSwitch) SetSleepTimer(duration time.Duration) error {
+	return s.active().SetSleepTimer(duration)
+}
+
+func (s *playerSwitch) SetSleepAtEndOfAlbum() error {
+	return s.active().SetSleepAtEndOfAlbum()
+}
+
+func (s *playerSwitch) SetStopAfterCurrent(stop bool) error {
+	return s.active().SetStopAfterCurrent(stop)
+}
+
+func (s *playerSwitch) LoadQueue(items player.PlayerQueue, current int, played []bool, position float64) error {
+	return s.active().LoadQueue(items, current, played, position)
+}
+
+func (s *playerSwitch) ClearQueue() {
+	s.active().ClearQueue()
+}
+
+func (s *playerSwitch) DeleteQueueItem(index int) {
+	s.active().DeleteQueueItem(index)
+}
+
+func (s *playerSwitch) AddToQueue(item *player.QueueItem) {
+	s.active().AddToQueue(item)
+}
+
+func (s *playerSwitch) InsertNext(item *player.QueueItem) {
+	s.active().InsertNext(item)
+}
+
+func (s *playerSwitch) MoveQueueItem(from, to int) error {
+	return s.active().MoveQueueItem(from, to)
+}
+
+func (s *playerSwitch) GetQueueItem(index int) (player.QueueItem, error) {
+	return s.active().GetQueueItem(index)
+}
+
+func (s *playerSwitch) GetQueueCopy() (player.PlayerQueue, int, []bool) {
+	return s.active().GetQueueCopy()
+}
+
+func (s *playerSwitch) GetPlayingTrack() (player.QueueItem, error) {
+	return s.active().GetPlayingTrack()
+}
+
+// remote.ControlledPlayer
+func (s *playerSwitch) IsSeeking() (bool, error) {
+	return s.active().IsSeeking()
+}
+
+func (s *playerSwitch) IsPaused() (bool, error) {
+	return s.active().IsPaused()
+}
+
+func (s *playerSwitch) IsPlaying() (bool, error) {
+	return s.active().IsPlaying()
+}
+
+// callbacks are registered with both players, but only called for the active one
+func (s *playerSwitch) OnPaused(cb func()) {
+	s.local.OnPaused(s.filter(false, cb))
+	s.jukebox.OnPaused(s.filter(true, cb))
+}
+
+func (s *playerSwitch) OnStopped(cb func()) {
+	s.local.OnStopped(s.filter(false, cb))
+	s.jukebox.OnStopped(s.filter(true, cb))
+}
+
+func (s *playerSwitch) OnPlaying(cb func()) {
+	s.local.OnPlaying(s.filter(false, cb))
+	s.jukebox.OnPlaying(s.filter(true, cb))
+}
+
+func (s *playerSwitch) OnSeek(cb func()) {
+	s.local.OnSeek(s.filter(false, cb))
+	s.jukebox.OnSeek(s.filter(true, cb))
+}
+
+func (s *playerSwitch) OnSongChange(cb func(track remote.TrackInterface)) {
+	s.local.OnSongChange(func(track remote.TrackInterface) {
+		if !s.IsJukebox() {
+			cb(track)
+		}
+	})
+	s.jukebox.OnSongChange(func(track remote.TrackInterface) {
+		if s.IsJukebox() {
+			cb(track)
+		}
+	})
+}
+
+func (s *playerSwitch) OnModeChange(cb func()) {
+	s.local.OnModeChange(s.filter(false, cb))
+	s.jukebox.OnModeChange(s.filter(true, cb))
+}
+
+func (s *playerSwitch) filter(jukebox bool, cb func()) func() {
+	return func() {
+		if s.IsJukebox() == jukebox {
+			cb()
+		}
+	}
+}
+
+func (s *playerSwitch) GetTimePos() float64 {
+	return s.active().GetTimePos()
+}
+
+func (s *playerSwitch) Play() error {
+	return s.active().Play()
+}
+
+func (s *playerSwitch) Pause() error {
+	return s.active().Pause()
+}
+
+func (s *playerSwitch) Stop() error {
+	return s.active().Stop()
+}
+
+func (s *playerSwitch) SeekAbsolute(position float64) error {
+	return s.active().SeekAbsolute(position)
+}
+
+func (s *playerSwitch) NextTrack() error {
+	return s.active().NextTrack()
+}
+
+func (s *playerSwitch) PreviousTrack() error {
+	return s.active().PreviousTrack()
+}
+
+func (s *playerSwitch) SetVolume(percentValue int) error {
+	return s.active().SetVolume(percentValue)
+}
+
+func (s *playerSwitch) GetShuffle() bool {
+	return s.active().GetShuffle()
+}
+
+func (s *playerSwitch) SetShuffle(shuffle bool) error {
+	return s.active().SetShuffle(shuffle)
+}
+
+func (s *playerSwitch) GetRepeat() remote.RepeatMode {
+	return s.active().GetRepeat()
+}
+
+func (s *playerSwitch) SetRepeat(mode remote.RepeatMode) error {
+	return s.active().SetRepeat(mode)
+}
+
+func (s *playerSwitch) GetModes() player.Modes {
+	return s.active().GetModes()
+}
+
+func (s *playerSwitch) GetSpeed() float64 {
+	return s.active().GetSpeed()
+}
+
+func (s *playerSwitch) SetSpeed(speed float64) error {
+	return s.active().SetSpeed(speed)
+}
+
+func (s *playerSwitch) GetReplayGain() player.ReplayGain {
+	return s.active().GetReplayGain()
+}
+
+func (s *playerSwitch) SetReplayGain(settings player.ReplayGain) error {
+	return s.active().SetReplayGain(settings)
+}
+
+func (s *playerSwitch) GetEqualizer() player.Equalizer {
+	return s.active().GetEqualizer()
+}
+
+func (s *playerSwitch) SetEqualizer(equalizer player.Equalizer) error {
+	return s.active().SetEqualizer(equalizer)
+}
+
+func (s *playerSwitch) GetAudioDevices() ([]player.AudioDevice, error) {
+	return s.active().GetAudioDevices()
+}
+
+func (s *playerSwitch) GetAudioDevice() (string, error) {
+	return s.active().GetAudioDevice()
+}
+
+func (s *playerSwitch) SetAudioDevice(name string, exclusive bool) error {
+	return s.active().SetAudioDevice(name, exclusive)
+}
@@ -3,6 +3,34 @@
 
 package remote
 
+// RepeatMode decides what is played when a song ends
+type RepeatMode int
+
+const (
+	// play the queue once
+	RepeatOff RepeatMode = iota
+	// play the current song again
+	RepeatOne
+	// start over at the end of the queue
+	RepeatAll
+)
+
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatOne:
+		return "one"
+	case RepeatAll:
+		return "all"
+	}
+	return "off"
+}
+
+// playback speeds the players support, 1 is normal
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 3.0
+)
+
 type ControlledPlayer interface {
 	// Returns true if a seek is currently in progress.
 	IsSeeking() (bool, error)
@@ -23,6 +51,9 @@ type ControlledPlayer interface {
 
 	OnSongChange(cb func(track TrackInterface))
 
+	// Registers a callback which is invoked when the shuffle or repeat mode or the speed changes.
+	OnModeChange(cb func())
+
 	GetTimePos() float64
 
 	Play() error
@@ -33,12 +64,25 @@ type ControlledPlayer interface {
 	PreviousTrack() error
 
 	SetVolume(percentValue int) error
+
+	GetShuffle() bool
+	SetShuffle(shuffle bool) error
+	GetRepeat() RepeatMode
+	SetRepeat(mode RepeatMode) error
+	GetSpeed() float64
+	SetSpeed(speed float64) error
 }
 
 type TrackInterface interface {
+	GetId() string
 	GetArtist() string
 	GetTitle() string
 	GetDuration() int
+	GetAlbum() string
+	GetTrackNumber() int
+	GetDiskNumber() int
+	GetYear() int
+	GetGenre() string
 
 	// something like ID != ""
 	IsValid() bool
@@ -4,7 +4,9 @@
 package remote
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"math"
 	"strings"
 
@@ -16,10 +18,15 @@ import (
 
 type MprisPlayer struct {
 	dbus   *dbus.Conn
+	props  *prop.Properties
 	player ControlledPlayer
 	logger logger.LoggerInterface
 }
 
+const noTrackPath = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+
+const playerInterface = "org.mpris.MediaPlayer2.Player"
+
 func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface) (mpp *MprisPlayer, err error) {
 	conn, err := dbus.ConnectSessionBus()
 	if err != nil {
@@ -34,7 +41,9 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 		logger: logger_,
 	}
 
-	err = conn.ExportAll(mpp, "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+	// Seek can't be a Go method name, go vet expects io.Seeker's signature
+	methodNames := map[string]string{"SeekBy": "Seek"}
+	err = conn.ExportWithMap(mpp, methodNames, "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
 	if err != nil {
 		return
 	}
@@ -46,22 +55,9 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 			playing := mpp.player.Queue[0]
 			return fmt.Sprintf("%s - %s", playing.Artist, playing.Title)
 		}
-		Shuffle true/false
-		LoopStatus "Noneon, "Track", "Playlist"
 		Position time_in_us
-		MaximumRate, Rate, MinimumRate (float 0-1, x speed)
 	*/
-	metadata := map[string]interface{}{
-		"mpris:trackid":     "",
-		"mpris:length":      int64(0),
-		"xesam:album":       "",
-		"xesam:albumArtist": "",
-		"xesam:artist":      []string{},
-		"xesam:composer":    []string{},
-		"xesam:genre":       []string{},
-		"xesam:title":       "",
-		"xesam:trackNumber": int(0),
-	}
+	metadata := trackMetadata(nil)
 
 	propSpec := map[string]map[string]*prop.Prop{
 		"org.mpris.MediaPlayer2.Player": {
@@ -69,11 +65,17 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 			"CanGoNext":      {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 			"CanPause":       {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 			"CanPlay":        {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
-			"CanSeek":        {Value: false, Writable: false, Emit: prop.EmitFalse, Callback: nil},
-			"CanGoPrevious":  {Value: false, Writable: false, Emit: prop.EmitFalse, Callback: nil},
+			"CanSeek":        {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
+			"CanGoPrevious":  {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 			"Metadata":       {Value: metadata, Writable: false, Emit: prop.EmitTrue, Callback: nil},
 			"Volume":         {Value: float64(0.0), Writable: true, Emit: prop.EmitTrue, Callback: mpp.volumeChange},
 			"PlaybackStatus": {Value: "", Writable: false, Emit: prop.EmitFalse, Callback: nil},
+			"Position":       {Value: int64(0), Writable: false, Emit: prop.EmitFalse, Callback: nil},
+			"Shuffle":        {Value: player.GetShuffle(), Writable: true, Emit: prop.EmitTrue, Callback: mpp.shuffleChange},
+			"LoopStatus":     {Value: loopStatus(player.GetRepeat()), Writable: true, Emit: prop.EmitTrue, Callback: mpp.loopStatusChange},
+			"Rate":           {Value: player.GetSpeed(), Writable: true, Emit: prop.EmitTrue, Callback: mpp.rateChange},
+			"MinimumRate":    {Value: float64(MinSpeed), Writable: false, Emit: prop.EmitConst, Callback: nil},
+			"MaximumRate":    {Value: float64(MaxSpeed), Writable: false, Emit: prop.EmitConst, Callback: nil},
 		},
 	}
 
@@ -81,7 +83,38 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 	if err != nil {
 		return
 	}
+	mpp.props = props
 
+	player.OnSongChange(func(track TrackInterface) {
+		mpp.props.SetMust("org.mpris.MediaPlayer2.Player", "Metadata", trackMetadata(track))
+	})
+	// clients extrapolate the position while playing, it's only updated when
+	// that goes wrong
+	updatePosition := func() {
+		mpp.props.SetMust(playerInterface, "Position", mpp.position())
+	}
+	player.OnPlaying(updatePosition)
+	player.OnPaused(updatePosition)
+	player.OnStopped(updatePosition)
+	player.OnSeek(func() {
+		position := mpp.position()
+		mpp.props.SetMust(playerInterface, "Position", position)
+		if err := conn.Emit("/org/mpris/MediaPlayer2", playerInterface+".Seeked", position); err != nil {
+			mpp.logger.PrintError("mpp Seeked", err)
+		}
+	})
+	player.OnModeChange(func() {
+		mpp.props.SetMust("org.mpris.MediaPlayer2.Player", "Shuffle", player.GetShuffle())
+		mpp.props.SetMust("org.mpris.MediaPlayer2.Player", "LoopStatus", loopStatus(player.GetRepeat()))
+		mpp.props.SetMust("org.mpris.MediaPlayer2.Player", "Rate", player.GetSpeed())
+	})
+
+	methods := introspect.Methods(mpp)
+	for i := range methods {
+		if name, ok := methodNames[methods[i].Name]; ok {
+			methods[i].Name = name
+		}
+	}
 	n := &introspect.Node{
 		Name: "/org/mpris/MediaPlayer2",
 		Interfaces: []introspect.Interface{
@@ -89,8 +122,11 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 			prop.IntrospectData,
 			{
 				Name:       "org.mpris.MediaPlayer2.Player",
-				Methods:    introspect.Methods(mpp),
+				Methods:    methods,
 				Properties: props.Introspection("org.mpris.MediaPlayer2.Player"),
+				Signals: []introspect.Signal{
+					{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}},
+				},
 			},
 		},
 	}
@@ -110,68 +146,149 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ logger.LoggerInterface
 	return
 }
 
+// trackMetadata converts a track to MPRIS metadata, track may be nil
+func trackMetadata(track TrackInterface) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"mpris:trackid":     noTrackPath,
+		"mpris:length":      int64(0),
+		"xesam:album":       "",
+		"xesam:albumArtist": []string{},
+		"xesam:artist":      []string{},
+		"xesam:composer":    []string{},
+		"xesam:genre":       []string{},
+		"xesam:title":       "",
+		"xesam:trackNumber": int(0),
+		"xesam:discNumber":  int(0),
+	}
+	if track == nil || !track.IsValid() {
+		return metadata
+	}
+
+	// object paths only allow [A-Za-z0-9_], so the id is hex encoded
+	metadata["mpris:trackid"] = dbus.ObjectPath("/com/github/spezifisch/stmps/track/" + hex.EncodeToString([]byte(track.GetId())))
+	metadata["mpris:length"] = int64(track.GetDuration()) * 1000000 // microseconds
+	metadata["xesam:album"] = track.GetAlbum()
+	if artist := track.GetArtist(); artist != "" {
+		metadata["xesam:artist"] = []string{artist}
+	}
+	if genre := track.GetGenre(); genre != "" {
+		metadata["xesam:genre"] = []string{genre}
+	}
+	metadata["xesam:title"] = track.GetTitle()
+	metadata["xesam:trackNumber"] = track.GetTrackNumber()
+	metadata["xesam:discNumber"] = track.GetDiskNumber()
+	if year := track.GetYear(); year > 0 {
+		metadata["xesam:contentCreated"] = fmt.Sprintf("%04d-01-01T00:00:00Z", year)
+	}
+	return metadata
+}
+
 func (m *MprisPlayer) Close() {
 	if err := m.dbus.Close(); err != nil {
 		m.logger.PrintError("mpp Close", err)
 	}
 }
 
-// Mandatory functions
-func (m *MprisPlayer) Stop() {
+// Methods of the MPRIS player interface. They return *dbus.Error to be
+// exported, see RegisterMprisPlayer.
+func (m *MprisPlayer) Stop() *dbus.Error {
 	if err := m.player.Stop(); err != nil {
 		m.logger.PrintError("mpp Stop", err)
+		return dbus.MakeFailedError(err)
 	}
+	return nil
 }
 
-func (m *MprisPlayer) Next() {
+func (m *MprisPlayer) Next() *dbus.Error {
 	if err := m.player.NextTrack(); err != nil {
 		m.logger.PrintError("mpp PlayNextTrack", err)
+		return dbus.MakeFailedError(err)
 	}
 	//TODO updateQueueList(ui.player, ui.queueList, ui.starIdList)
+	return nil
 }
 
 // set paused
-func (m *MprisPlayer) Pause() {
+func (m *MprisPlayer) Pause() *dbus.Error {
 	if paused, err := m.player.IsPaused(); err != nil {
 		m.logger.PrintError("mpp IsPaused", err)
+		return dbus.MakeFailedError(err)
 	} else if !paused {
 		if err = m.player.Pause(); err != nil {
 			m.logger.PrintError("mpp Pause", err)
+			return dbus.MakeFailedError(err)
 		}
 	}
+	return nil
 }
 
 // set playing
-func (m *MprisPlayer) Play() {
+func (m *MprisPlayer) Play() *dbus.Error {
 	if playing, err := m.player.IsPlaying(); err != nil {
 		m.logger.PrintError("mpp IsPlaying", err)
+		return dbus.MakeFailedError(err)
 	} else if !playing {
 		if err = m.player.Pause(); err != nil {
 			m.logger.PrintError("mpp Pause", err)
+			return dbus.MakeFailedError(err)
 		}
 	}
+	return nil
 }
 
-func (m *MprisPlayer) PlayPause() {
+func (m *MprisPlayer) PlayPause() *dbus.Error {
 	if err := m.player.Pause(); err != nil {
 		m.logger.PrintError("mpp Pause", err)
+		return dbus.MakeFailedError(err)
 	}
+	return nil
 }
 
-func (m *MprisPlayer) OpenUri(string) {
+func (m *MprisPlayer) OpenUri(string) *dbus.Error {
 	// TODO not implemented
+	return nil
 }
-func (m *MprisPlayer) Previous() {
-	// TODO not implemented
+
+func (m *MprisPlayer) Previous() *dbus.Error {
+	if err := m.player.PreviousTrack(); err != nil {
+		m.logger.PrintError("mpp PreviousTrack", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
 }
-func (m *MprisPlayer) Seek(int) {
-	// TODO not implemented
+
+// SeekBy is exported as Seek, which moves the position by offset
+// microseconds. Seeking before the start goes to the start.
+func (m *MprisPlayer) SeekBy(offset int64) *dbus.Error {
+	position := m.player.GetTimePos() + float64(offset)/1000000
+	if err := m.player.SeekAbsolute(math.Max(position, 0)); err != nil {
+		m.logger.PrintError("mpp Seek", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
 }
-func (m *MprisPlayer) Seeked(int) {
-	// TODO not implemented
+
+// SetPosition jumps to position microseconds, if trackId is still the current
+// track
+func (m *MprisPlayer) SetPosition(trackId dbus.ObjectPath, position int64) *dbus.Error {
+	metadata, ok := m.props.GetMust(playerInterface, "Metadata").(map[string]interface{})
+	if !ok || metadata["mpris:trackid"] != trackId {
+		// stale request
+		return nil
+	}
+	if length, ok := metadata["mpris:length"].(int64); position < 0 || (ok && position > length) {
+		return nil
+	}
+	if err := m.player.SeekAbsolute(float64(position) / 1000000); err != nil {
+		m.logger.PrintError("mpp SetPosition", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
 }
-func (m *MprisPlayer) SetPosition(string, int) {
-	// TODO not implemented
+
+// position returns the playback position in microseconds
+func (m *MprisPlayer) position() int64 {
+	return int64(m.player.GetTimePos() * 1000000)
 }
 
 func (m *MprisPlayer) volumeChange(c *prop.Change) *dbus.Error {
@@ -186,3 +303,57 @@ func (m *MprisPlayer) volumeChange(c *prop.Change) *dbus.Error {
 	}
 	return nil
 }
+
+func (m *MprisPlayer) shuffleChange(c *prop.Change) *dbus.Error {
+	if err := m.player.SetShuffle(c.Value.(bool)); err != nil {
+		m.logger.PrintError("shuffleChange", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (m *MprisPlayer) loopStatusChange(c *prop.Change) *dbus.Error {
+	var mode RepeatMode
+	switch c.Value.(string) {
+	case "None":
+		mode = RepeatOff
+	case "Track":
+		mode = RepeatOne
+	case "Playlist":
+		mode = RepeatAll
+	default:
+		return dbus.MakeFailedError(fmt.Errorf("invalid loop status %q", c.Value))
+	}
+
+	if err := m.player.SetRepeat(mode); err != nil {
+		m.logger.PrintError("loopStatusChange", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// rateChange sets the speed, rates outside of MinimumRate and MaximumRate are
+// rejected
+func (m *MprisPlayer) rateChange(c *prop.Change) *dbus.Error {
+	rate := c.Value.(float64)
+	if rate < MinSpeed || rate > MaxSpeed {
+		return dbus.MakeFailedError(fmt.Errorf("rate %v out of range", rate))
+	}
+
+	if err := m.player.SetSpeed(rate); err != nil {
+		m.logger.PrintError("rateChange", err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// loopStatus converts a repeat mode to the MPRIS LoopStatus
+func loopStatus(mode RepeatMode) string {
+	switch mode {
+	case RepeatOne:
+		return "Track"
+	case RepeatAll:
+		return "Playlist"
+	}
+	return "None"
+}
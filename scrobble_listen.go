@@ -0,0 +1,155 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// scrobbleThresholds decide when a track counts as listened to. The defaults
+// follow https://www.last.fm/api/scrobbling: the track must be longer than 30
+// seconds and played for half its duration or 4 minutes, whichever is earlier.
+type scrobbleThresholds struct {
+	percent    int
+	maxSeconds int
+	minLength  int
+}
+
+func scrobbleThresholdsFromConfig() scrobbleThresholds {
+	thresholds := scrobbleThresholds{
+		percent:    50,
+		maxSeconds: 240,
+		minLength:  30,
+	}
+	if viper.IsSet("scrobble.percent") {
+		thresholds.percent = viper.GetInt("scrobble.percent")
+	}
+	if viper.IsSet("scrobble.max_seconds") {
+		thresholds.maxSeconds = viper.GetInt("scrobble.max_seconds")
+	}
+	if viper.IsSet("scrobble.min_length") {
+		thresholds.minLength = viper.GetInt("scrobble.min_length")
+	}
+	return thresholds
+}
+
+// required returns the listening time needed to scrobble a track of the given
+// duration, false if it can't be scrobbled at all
+func (t scrobbleThresholds) required(duration int) (time.Duration, bool) {
+	if duration <= 0 || duration < t.minLength {
+		return 0, false
+	}
+	seconds := duration * t.percent / 100
+	if t.maxSeconds > 0 && seconds > t.maxSeconds {
+		seconds = t.maxSeconds
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// listenTracker accumulates the time the current track was actually played,
+// from the position reports of the player. Only the time while playing
+// counts, the position reported after pausing, unpausing or seeking is the
+// new starting point. Accessed from gui context only.
+type listenTracker struct {
+	thresholds scrobbleThresholds
+	// replaced in tests, time.Now if nil
+	now func() time.Time
+
+	track    pendingScrobble
+	duration int
+	listened time.Duration
+	done     bool
+	playing  bool
+
+	// last position report, -1 if the next one is the starting point
+	position   int64
+	reportedAt time.Time
+}
+
+// Start resets the tracker for a new track that started playing, also when a
+// track is repeated
+func (l *listenTracker) Start(track pendingScrobble) {
+	*l = listenTracker{
+		thresholds: l.thresholds,
+		now:        l.now,
+		track:      track,
+		duration:   track.Duration,
+		playing:    track.Id != "",
+		position:   -1,
+	}
+}
+
+// Stop forgets the current track
+func (l *listenTracker) Stop() {
+	l.Start(pendingScrobble{})
+}
+
+// Pause stops counting until Resume. If another track was loaded paused, it
+// is tracked from now on instead of the previous one.
+func (l *listenTracker) Pause(track pendingScrobble) {
+	if track.Id != l.track.Id {
+		l.Start(track)
+	}
+	l.playing = false
+	l.position = -1
+}
+
+// Resume counts the time from the next position report on. If another track
+// is playing now, it is tracked instead of the previous one.
+func (l *listenTracker) Resume(track pendingScrobble) {
+	if track.Id != l.track.Id {
+		l.Start(track)
+	} else if l.listened == 0 {
+		// a track loaded paused was played from now on
+		l.track.PlayedAt = track.PlayedAt
+	}
+	l.playing = l.track.Id != ""
+	l.position = -1
+}
+
+// Seeked sets the position the player jumped to as the new starting point
+func (l *listenTracker) Seeked(position int64) {
+	l.position = position
+	l.reportedAt = l.clock()
+}
+
+func (l *listenTracker) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// Update takes a position report. It returns the track once when it was
+// listened to long enough to be scrobbled.
+func (l *listenTracker) Update(position, duration int64) (pendingScrobble, bool) {
+	if l.track.Id == "" || l.done || !l.playing {
+		return pendingScrobble{}, false
+	}
+	if l.duration <= 0 {
+		// the server didn't know, use what the player found out
+		l.duration = int(duration)
+	}
+
+	now := l.clock()
+	if l.position >= 0 {
+		delta := time.Duration(position-l.position) * time.Second
+		// the position can't advance faster than the clock, plus one
+		// second of rounding, otherwise the user skipped ahead
+		if delta > 0 && delta <= now.Sub(l.reportedAt)+time.Second {
+			l.listened += delta
+		}
+	}
+	l.position = position
+	l.reportedAt = now
+
+	required, ok := l.thresholds.required(l.duration)
+	if !ok || l.listened < required {
+		return pendingScrobble{}, false
+	}
+	l.done = true
+	return l.track, true
+}
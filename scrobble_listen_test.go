@@ -0,0 +1,219 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/scrobbler"
+)
+
+var defaultThresholds = scrobbleThresholds{percent: 50, maxSeconds: 240, minLength: 30}
+
+func TestScrobbleThresholdsRequired(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		thresholds scrobbleThresholds
+		duration   int
+
+		required time.Duration
+		ok       bool
+	}{
+		{name: "half of the song", thresholds: defaultThresholds, duration: 200, required: 100 * time.Second, ok: true},
+		{name: "max seconds of a long song", thresholds: defaultThresholds, duration: 600, required: 240 * time.Second, ok: true},
+		{name: "min length", thresholds: defaultThresholds, duration: 30, required: 15 * time.Second, ok: true},
+		{name: "shorter than min length", thresholds: defaultThresholds, duration: 29},
+		{name: "unknown duration", thresholds: defaultThresholds, duration: 0},
+		{name: "whole song", thresholds: scrobbleThresholds{percent: 100}, duration: 600, required: 600 * time.Second, ok: true},
+		{name: "custom percent", thresholds: scrobbleThresholds{percent: 80, maxSeconds: 240}, duration: 100, required: 80 * time.Second, ok: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			required, ok := tc.thresholds.required(tc.duration)
+			if required != tc.required || ok != tc.ok {
+				t.Errorf("expected %v %v, got %v %v", tc.required, tc.ok, required, ok)
+			}
+		})
+	}
+}
+
+// listenStep is something happening to the tracker after wait
+type listenStep struct {
+	wait time.Duration
+	// "play" reports positions from..to once a second, "pause", "resume",
+	// "seek" to from, "start" the track again
+	action   string
+	from, to int64
+}
+
+func play(from, to int64) listenStep {
+	return listenStep{action: "play", from: from, to: to}
+}
+
+func TestListenTracker(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		duration int
+		steps    []listenStep
+
+		scrobbles int
+		listened  time.Duration
+	}{
+		{name: "played to the threshold", duration: 200, steps: []listenStep{play(0, 100)},
+			scrobbles: 1, listened: 100 * time.Second},
+		{name: "below the threshold", duration: 200, steps: []listenStep{play(0, 99)},
+			listened: 99 * time.Second},
+		{name: "too short", duration: 20, steps: []listenStep{play(0, 20)},
+			listened: 20 * time.Second},
+		{name: "long song", duration: 3600, steps: []listenStep{play(0, 240)},
+			scrobbles: 1, listened: 240 * time.Second},
+		{name: "paused for long, then seeking forward", duration: 200, steps: []listenStep{
+			play(0, 10),
+			{action: "pause"},
+			{wait: 10 * time.Minute, action: "seek", from: 150},
+			{action: "resume"},
+			play(150, 160),
+		}, listened: 20 * time.Second},
+		{name: "paused, position reports ignored", duration: 200, steps: []listenStep{
+			play(0, 10),
+			{action: "pause"},
+			play(10, 20),
+		}, listened: 10 * time.Second},
+		{name: "pause and resume", duration: 200, steps: []listenStep{
+			play(0, 60),
+			{action: "pause"},
+			{wait: time.Hour, action: "resume"},
+			play(60, 100),
+		}, scrobbles: 1, listened: 100 * time.Second},
+		{name: "seeking forward", duration: 200, steps: []listenStep{
+			play(0, 10),
+			{action: "seek", from: 180},
+			play(180, 200),
+		}, listened: 30 * time.Second},
+		{name: "seeking back counts again", duration: 200, steps: []listenStep{
+			play(0, 60),
+			{action: "seek", from: 10},
+			play(10, 50),
+		}, scrobbles: 1, listened: 100 * time.Second},
+		{name: "jump without seek event", duration: 200, steps: []listenStep{
+			play(0, 10),
+			play(150, 160),
+		}, listened: 20 * time.Second},
+		{name: "repeat one restarts", duration: 200, steps: []listenStep{
+			play(0, 200),
+			{action: "start"},
+			play(0, 120),
+		}, scrobbles: 2, listened: 100 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+			l := listenTracker{thresholds: defaultThresholds, now: func() time.Time { return now }}
+			track := pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: tc.duration}, PlayedAt: now}
+			l.Start(track)
+
+			scrobbles := 0
+			for _, step := range tc.steps {
+				now = now.Add(step.wait)
+				switch step.action {
+				case "play":
+					for position := step.from; position <= step.to; position++ {
+						if position > step.from {
+							now = now.Add(time.Second)
+						}
+						if scrobble, ok := l.Update(position, int64(tc.duration)); ok {
+							if scrobble.Id != "tr-1" {
+								t.Errorf("unexpected scrobble %+v", scrobble)
+							}
+							scrobbles++
+						}
+					}
+				case "pause":
+					l.Pause(track)
+				case "resume":
+					l.Resume(track)
+				case "seek":
+					l.Seeked(step.from)
+				case "start":
+					l.Start(track)
+				}
+			}
+
+			if scrobbles != tc.scrobbles {
+				t.Errorf("expected %d scrobbles, got %d", tc.scrobbles, scrobbles)
+			}
+			if l.listened != tc.listened {
+				t.Errorf("expected %v listened, got %v", tc.listened, l.listened)
+			}
+		})
+	}
+}
+
+func TestListenTrackerOtherSong(t *testing.T) {
+	l := listenTracker{thresholds: defaultThresholds}
+	l.Start(pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: 60}})
+	for position := int64(0); position < 20; position++ {
+		l.Update(position, 60)
+	}
+
+	// another song was loaded paused, it's tracked instead of tr-1
+	l.Pause(pendingScrobble{Track: scrobbler.Track{Id: "tr-2", Duration: 60}})
+	if l.track.Id != "tr-2" || l.listened != 0 {
+		t.Fatalf("expected tr-2 tracked from the start, tracking %s listened %v", l.track.Id, l.listened)
+	}
+}
+
+func TestListenTrackerStartedPaused(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	l := listenTracker{thresholds: defaultThresholds, now: func() time.Time { return now }}
+	track := pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: 60}, PlayedAt: now}
+
+	// the first event for the song is paused, e.g. a restored session
+	l.Pause(track)
+	if _, ok := l.Update(0, 60); ok {
+		t.Fatal("scrobbled while paused")
+	}
+
+	now = now.Add(time.Hour)
+	resumedAt := now
+	track.PlayedAt = resumedAt
+	l.Resume(track)
+	scrobbles := 0
+	for position := int64(0); position <= 30; position++ {
+		if scrobble, ok := l.Update(position, 60); ok {
+			if scrobble.Id != "tr-1" || !scrobble.PlayedAt.Equal(resumedAt) {
+				t.Errorf("unexpected scrobble %+v", scrobble)
+			}
+			scrobbles++
+		}
+		now = now.Add(time.Second)
+	}
+	if scrobbles != 1 {
+		t.Errorf("expected 1 scrobble, got %d", scrobbles)
+	}
+}
+
+func TestListenTrackerResumedAfterStop(t *testing.T) {
+	l := listenTracker{thresholds: defaultThresholds}
+	l.Start(pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: 60}})
+	l.Stop()
+
+	// the jukebox reports playing again after stop as unpaused
+	l.Resume(pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: 60}})
+	if l.track.Id != "tr-1" || !l.playing {
+		t.Fatalf("expected tr-1 tracked, tracking %q playing %v", l.track.Id, l.playing)
+	}
+}
+
+func TestListenTrackerStopped(t *testing.T) {
+	l := listenTracker{thresholds: defaultThresholds}
+	l.Start(pendingScrobble{Track: scrobbler.Track{Id: "tr-1", Duration: 60}})
+	l.Stop()
+	// resumed without a song, or without scrobble targets
+	l.Resume(pendingScrobble{})
+	for position := int64(0); position < 60; position++ {
+		if _, ok := l.Update(position, 60); ok {
+			t.Fatal("scrobbled without a track")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+
+	"github.com/spezifisch/stmps/scrobbler"
+)
+
+const scrobblesFile = "scrobbles.json"
+
+// how often pending scrobbles are retried while the server is unreachable
+const scrobbleRetryInterval = time.Minute
+
+// pendingScrobble is a submission that wasn't accepted by the server yet
+type pendingScrobble struct {
+	scrobbler.Track
+	PlayedAt time.Time `json:"playedAt"`
+}
+
+// scrobbleQueue keeps submissions on disk until they are accepted, so that
+// scrobbles made offline aren't lost. Accessed from background context only.
+type scrobbleQueue struct {
+	// key in the state file
+	key     string
+	pending []pendingScrobble
+}
+
+// loadScrobbleQueue reads the pending scrobbles stored under key
+func loadScrobbleQueue(key string) (*scrobbleQueue, error) {
+	queues := map[string][]pendingScrobble{}
+	q := &scrobbleQueue{key: key}
+	if err := readStateFile(scrobblesFile, &queues); err != nil {
+		return q, err
+	}
+	q.pending = queues[key]
+	return q, nil
+}
+
+func (q *scrobbleQueue) save() error {
+	queues := map[string][]pendingScrobble{}
+	if err := readStateFile(scrobblesFile, &queues); err != nil {
+		return err
+	}
+	if len(q.pending) == 0 {
+		delete(queues, q.key)
+	} else {
+		queues[q.key] = q.pending
+	}
+	return writeStateFile(scrobblesFile, queues)
+}
+
+func (q *scrobbleQueue) Len() int {
+	return len(q.pending)
+}
+
+// Add appends a scrobble and stores the queue
+func (q *scrobbleQueue) Add(scrobble pendingScrobble) error {
+	q.pending = append(q.pending, scrobble)
+	return q.save()
+}
+
+// Flush submits the pending scrobbles in order. It stops at the first error
+// and keeps the remaining scrobbles for the next try.
+func (q *scrobbleQueue) Flush(submit func(pendingScrobble) error) error {
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	var err error
+	sent := 0
+	for _, scrobble := range q.pending {
+		if err = submit(scrobble); err != nil {
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return err
+	}
+
+	q.pending = q.pending[sent:]
+	if saveErr := q.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
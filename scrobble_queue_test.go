@@ -0,0 +1,181 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/scrobbler"
+)
+
+var errOffline = errors.New("offline")
+
+// fakeTarget accepts scrobbles until it has taken accept of them
+type fakeTarget struct {
+	accept    int
+	submitted []string
+}
+
+var _ scrobbler.Target = (*fakeTarget)(nil)
+
+func (f *fakeTarget) Name() string {
+	return "fake"
+}
+
+func (f *fakeTarget) NowPlaying(track scrobbler.Track) error {
+	return nil
+}
+
+func (f *fakeTarget) Submit(track scrobbler.Track, playedAt time.Time) error {
+	if len(f.submitted) >= f.accept {
+		return errOffline
+	}
+	f.submitted = append(f.submitted, track.Id)
+	return nil
+}
+
+func (f *fakeTarget) flush(q *scrobbleQueue) error {
+	return q.Flush(func(scrobble pendingScrobble) error {
+		return f.Submit(scrobble.Track, scrobble.PlayedAt)
+	})
+}
+
+func testScrobble(id string) pendingScrobble {
+	return pendingScrobble{
+		Track:    scrobbler.Track{Id: id},
+		PlayedAt: time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func pendingIds(q *scrobbleQueue) (ids []string) {
+	for _, scrobble := range q.pending {
+		ids = append(ids, scrobble.Id)
+	}
+	return
+}
+
+func equalIds(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScrobbleQueueFlush(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		added  []string
+		accept int
+
+		submitted []string
+		remaining []string
+		err       error
+	}{
+		{name: "empty"},
+		{name: "all accepted in order", added: []string{"a", "b", "c"}, accept: 3, submitted: []string{"a", "b", "c"}},
+		{name: "offline keeps all", added: []string{"a", "b"}, err: errOffline, remaining: []string{"a", "b"}},
+		{name: "partial flush keeps the rest", added: []string{"a", "b", "c", "d"}, accept: 2, err: errOffline,
+			submitted: []string{"a", "b"}, remaining: []string{"c", "d"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+			q, err := loadScrobbleQueue("server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tc.added {
+				if err := q.Add(testScrobble(id)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			target := &fakeTarget{accept: tc.accept}
+			if err := target.flush(q); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !equalIds(target.submitted, tc.submitted) {
+				t.Errorf("expected %v submitted, got %v", tc.submitted, target.submitted)
+			}
+			if !equalIds(pendingIds(q), tc.remaining) || q.Len() != len(tc.remaining) {
+				t.Errorf("expected %v pending, got %v", tc.remaining, pendingIds(q))
+			}
+
+			// the rest is still there after a restart
+			restored, err := loadScrobbleQueue("server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalIds(pendingIds(restored), tc.remaining) {
+				t.Errorf("expected %v pending after restart, got %v", tc.remaining, pendingIds(restored))
+			}
+			if len(restored.pending) > 0 && !restored.pending[0].PlayedAt.Equal(testScrobble("").PlayedAt) {
+				t.Errorf("play time not kept: %v", restored.pending[0].PlayedAt)
+			}
+		})
+	}
+}
+
+func TestScrobbleQueueAddAfterFailure(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	q, _ := loadScrobbleQueue("server")
+	target := &fakeTarget{}
+
+	// scrobbles made offline are sent before newer ones
+	_ = q.Add(testScrobble("a"))
+	_ = target.flush(q)
+	_ = q.Add(testScrobble("b"))
+	target.accept = 2
+	if err := target.flush(q); err != nil {
+		t.Fatal(err)
+	}
+	if !equalIds(target.submitted, []string{"a", "b"}) || q.Len() != 0 {
+		t.Errorf("unexpected submissions %v, pending %v", target.submitted, pendingIds(q))
+	}
+}
+
+func TestScrobbleQueuePerService(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	server, _ := loadScrobbleQueue("admin@server")
+	listenBrainz, _ := loadScrobbleQueue("listenbrainz")
+	_ = server.Add(testScrobble("a"))
+	_ = listenBrainz.Add(testScrobble("b"))
+	_ = listenBrainz.Add(testScrobble("c"))
+
+	// one service being reachable doesn't flush the others
+	if err := (&fakeTarget{accept: 1}).flush(server); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string][]string{
+		"admin@server": nil,
+		"listenbrainz": {"b", "c"},
+		"lastfm":       nil,
+	} {
+		q, err := loadScrobbleQueue(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalIds(pendingIds(q), expected) {
+			t.Errorf("%s: expected %v pending, got %v", key, expected, pendingIds(q))
+		}
+	}
+
+	// emptied queues are removed from the file
+	queues := map[string][]pendingScrobble{}
+	if err := readStateFile(scrobblesFile, &queues); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := queues["admin@server"]; ok || len(queues) != 1 {
+		t.Errorf("unexpected queues in the state file: %v", queues)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/scrobbler"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// scrobbleTarget is a scrobble service with its own retry queue
+type scrobbleTarget struct {
+	target scrobbler.Target
+	// key of the retry queue in the state file
+	queueKey string
+	queue    *scrobbleQueue
+}
+
+// subsonicScrobbler scrobbles through the Subsonic server, which forwards
+// scrobbles if it's configured to
+type subsonicScrobbler struct {
+	connection *subsonic.SubsonicConnection
+}
+
+var _ scrobbler.Target = (*subsonicScrobbler)(nil)
+
+func (s *subsonicScrobbler) Name() string {
+	return "subsonic"
+}
+
+func (s *subsonicScrobbler) NowPlaying(track scrobbler.Track) error {
+	response, err := s.connection.ScrobbleSubmission(track.Id, false)
+	return subsonicScrobbleError(response, err)
+}
+
+func (s *subsonicScrobbler) Submit(track scrobbler.Track, playedAt time.Time) error {
+	response, err := s.connection.ScrobbleSubmissionAt(track.Id, playedAt)
+	return subsonicScrobbleError(response, err)
+}
+
+// Subsonic error codes of scrobbles the server won't accept on retry either.
+// Others like wrong credentials (40) or an expired token (44) can be fixed.
+const (
+	subsonicErrorMissingParam = 10
+	subsonicErrorNotFound     = 70
+)
+
+func subsonicScrobbleError(response *subsonic.SubsonicResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if response.Status == "ok" {
+		return nil
+	}
+	switch response.Error.Code {
+	case subsonicErrorMissingParam, subsonicErrorNotFound:
+		return fmt.Errorf("%w: %s", scrobbler.ErrRejected, response.Error.Message)
+	}
+	return fmt.Errorf("subsonic error %d: %s", response.Error.Code, response.Error.Message)
+}
+
+// scrobbleTargetsFromConfig returns the enabled scrobble targets
+func scrobbleTargetsFromConfig(connection *subsonic.SubsonicConnection) (targets []*scrobbleTarget) {
+	if connection.Scrobble {
+		// the queue is per server, the Subsonic target keeps the key of the
+		// queue it had on its own so that queued scrobbles carry over
+		targets = append(targets, &scrobbleTarget{
+			target:   &subsonicScrobbler{connection},
+			queueKey: serverProfile(connection),
+		})
+	}
+
+	if viper.GetBool("listenbrainz.enabled") {
+		targets = append(targets, &scrobbleTarget{
+			target: &scrobbler.ListenBrainz{
+				Url:           stringOr(viper.GetString("listenbrainz.url"), scrobbler.ListenBrainzUrl),
+				Token:         viper.GetString("listenbrainz.token"),
+				ClientName:    clientName,
+				ClientVersion: clientVersion,
+			},
+			queueKey: "listenbrainz",
+		})
+	}
+
+	if viper.GetBool("lastfm.enabled") {
+		targets = append(targets, &scrobbleTarget{
+			target:   newLastFm(),
+			queueKey: "lastfm",
+		})
+	}
+	return
+}
+
+func newLastFm() *scrobbler.LastFm {
+	return &scrobbler.LastFm{
+		Url:        stringOr(viper.GetString("lastfm.url"), scrobbler.LastFmUrl),
+		ApiKey:     viper.GetString("lastfm.api_key"),
+		Secret:     viper.GetString("lastfm.secret"),
+		SessionKey: viper.GetString("lastfm.session_key"),
+	}
+}
+
+// authenticateLastFm runs the Last.fm authentication flow on the terminal and
+// prints the session key for the config
+func authenticateLastFm() error {
+	lastFm := newLastFm()
+	if lastFm.ApiKey == "" || lastFm.Secret == "" {
+		return errors.New("lastfm.api_key and lastfm.secret are required, see https://www.last.fm/api/account/create")
+	}
+
+	token, err := lastFm.GetToken()
+	if err != nil {
+		return err
+	}
+	authUrl := stringOr(viper.GetString("lastfm.auth_url"), scrobbler.LastFmAuthUrl)
+	fmt.Printf("Allow access for stmp at:\n\n  %s\n\nthen press Enter.\n", lastFm.AuthUrl(authUrl, token))
+	_, _ = fmt.Scanln()
+
+	name, key, err := lastFm.GetSession(token)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Authenticated as %s. Add this to the [lastfm] section of stmp.toml:\n\n  session_key = '%s'\n", name, key)
+	return nil
+}
+
+// scrobbleTrack returns the metadata scrobble services need
+func scrobbleTrack(item *player.QueueItem) scrobbler.Track {
+	return scrobbler.Track{
+		Id:          item.Id,
+		Title:       item.Title,
+		Artist:      item.Artist,
+		Album:       item.Album,
+		Duration:    item.Duration,
+		TrackNumber: item.Track,
+	}
+}
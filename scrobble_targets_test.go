@@ -0,0 +1,51 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spezifisch/stmps/scrobbler"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+func TestSubsonicScrobbleError(t *testing.T) {
+	failed := func(code int) *subsonic.SubsonicResponse {
+		return &subsonic.SubsonicResponse{Status: "failed", Error: subsonic.SubsonicError{Code: code, Message: "error"}}
+	}
+	networkErr := errors.New("connection refused")
+
+	for _, tc := range []struct {
+		name     string
+		response *subsonic.SubsonicResponse
+		err      error
+
+		ok       bool
+		rejected bool
+	}{
+		{name: "ok", response: &subsonic.SubsonicResponse{Status: "ok"}, ok: true},
+		{name: "network error", err: networkErr},
+		{name: "generic error", response: failed(0)},
+		{name: "wrong credentials", response: failed(40)},
+		{name: "token auth not supported", response: failed(41)},
+		{name: "invalid api key", response: failed(44)},
+		{name: "not authorized", response: failed(50)},
+		{name: "missing parameter", response: failed(10), rejected: true},
+		{name: "song not found", response: failed(70), rejected: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := subsonicScrobbleError(tc.response, tc.err)
+			if tc.ok != (err == nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if errors.Is(err, scrobbler.ErrRejected) != tc.rejected {
+				t.Errorf("expected rejected %v, got %v", tc.rejected, err)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
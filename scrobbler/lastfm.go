@@ -0,0 +1,210 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package scrobbler
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LastFmUrl     = "https://ws.audioscrobbler.com/2.0/"
+	LastFmAuthUrl = "https://www.last.fm/api/auth/"
+)
+
+// Last.fm error codes that are worth retrying later,
+// see https://www.last.fm/api/errorcodes
+const (
+	lastFmOperationFailed   = 8
+	lastFmInvalidSessionKey = 9 // fixed by the user with a new session key
+	lastFmServiceOffline    = 11
+	lastFmTemporaryError    = 16
+	lastFmSuspendedApiKey   = 26
+	lastFmRateLimitExceeded = 29
+)
+
+// LastFm scrobbles with a session key, which is obtained once with
+// GetToken, AuthUrl and GetSession, see https://www.last.fm/api/authspec
+type LastFm struct {
+	// Url is the API root, LastFmUrl by default
+	Url        string
+	ApiKey     string
+	Secret     string
+	SessionKey string
+}
+
+var _ Target = (*LastFm)(nil)
+
+// LastFmError is an error response of the Last.fm API
+type LastFmError struct {
+	Code    int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *LastFmError) Error() string {
+	return fmt.Sprintf("last.fm: %d %s", e.Code, e.Message)
+}
+
+// temporary returns true if the request may succeed later
+func (e *LastFmError) temporary() bool {
+	switch e.Code {
+	case lastFmInvalidSessionKey, lastFmOperationFailed, lastFmServiceOffline,
+		lastFmTemporaryError, lastFmSuspendedApiKey, lastFmRateLimitExceeded:
+		return true
+	}
+	return false
+}
+
+func (l *LastFm) Name() string {
+	return "lastfm"
+}
+
+func (l *LastFm) NowPlaying(track Track) error {
+	params, err := l.trackParams(track)
+	if err != nil {
+		return err
+	}
+	return l.call("track.updateNowPlaying", params, nil)
+}
+
+func (l *LastFm) Submit(track Track, playedAt time.Time) error {
+	params, err := l.trackParams(track)
+	if err != nil {
+		return err
+	}
+	params.Set("timestamp", strconv.FormatInt(playedAt.Unix(), 10))
+
+	var response struct {
+		Scrobbles struct {
+			Attr struct {
+				Ignored int `json:"ignored"`
+			} `json:"@attr"`
+		} `json:"scrobbles"`
+	}
+	if err := l.call("track.scrobble", params, &response); err != nil {
+		return err
+	}
+	if response.Scrobbles.Attr.Ignored > 0 {
+		// e.g. timestamp too old
+		return fmt.Errorf("%w: ignored by last.fm", ErrRejected)
+	}
+	return nil
+}
+
+// GetToken requests a token for the authentication flow. The user has to
+// allow access for it at AuthUrl before calling GetSession.
+func (l *LastFm) GetToken() (string, error) {
+	var response struct {
+		Token string `json:"token"`
+	}
+	err := l.call("auth.getToken", url.Values{}, &response)
+	return response.Token, err
+}
+
+// AuthUrl returns the page where the user allows access for token, authUrl
+// is LastFmAuthUrl by default
+func (l *LastFm) AuthUrl(authUrl string, token string) string {
+	return authUrl + "?" + url.Values{"api_key": {l.ApiKey}, "token": {token}}.Encode()
+}
+
+// GetSession returns the user name and session key for an authorized token.
+// The session key doesn't expire.
+func (l *LastFm) GetSession(token string) (name string, key string, err error) {
+	var response struct {
+		Session struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"session"`
+	}
+	err = l.call("auth.getSession", url.Values{"token": {token}}, &response)
+	return response.Session.Name, response.Session.Key, err
+}
+
+func (l *LastFm) trackParams(track Track) (url.Values, error) {
+	if track.Artist == "" || track.Title == "" {
+		return nil, fmt.Errorf("%w: artist and title are required", ErrRejected)
+	}
+
+	params := url.Values{}
+	params.Set("artist", track.Artist)
+	params.Set("track", track.Title)
+	if track.Album != "" {
+		params.Set("album", track.Album)
+	}
+	if track.Duration > 0 {
+		params.Set("duration", strconv.Itoa(track.Duration))
+	}
+	if track.TrackNumber > 0 {
+		params.Set("trackNumber", strconv.Itoa(track.TrackNumber))
+	}
+	params.Set("sk", l.SessionKey)
+	return params, nil
+}
+
+// sign adds the api_sig parameter: the md5 of all parameters sorted by name
+// and concatenated with their values, followed by the secret
+func (l *LastFm) sign(params url.Values) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(key)
+		sb.WriteString(params.Get(key))
+	}
+	sb.WriteString(l.Secret)
+
+	sum := md5.Sum([]byte(sb.String()))
+	params.Set("api_sig", hex.EncodeToString(sum[:]))
+}
+
+// call posts a signed method call and decodes the response into v, which may be nil
+func (l *LastFm) call(method string, params url.Values, v interface{}) error {
+	params.Set("method", method)
+	params.Set("api_key", l.ApiKey)
+	l.sign(params)
+	// format isn't part of the signature
+	params.Set("format", "json")
+
+	res, err := httpClient.PostForm(l.Url, params)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var apiErr LastFmError
+	if err := json.Unmarshal(data, &apiErr); err != nil {
+		return fmt.Errorf("last.fm: %s: %w", res.Status, err)
+	}
+	if apiErr.Code != 0 {
+		if apiErr.temporary() {
+			return &apiErr
+		}
+		return fmt.Errorf("%w: %s", ErrRejected, apiErr.Error())
+	}
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("last.fm: %s", res.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
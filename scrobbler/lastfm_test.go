@@ -0,0 +1,152 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package scrobbler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// lastFmStandIn checks signatures and records method calls. errorCode is
+// returned for track methods if it's set.
+func lastFmStandIn(t *testing.T, errorCode *int, calls *[]url.Values) *LastFm {
+	t.Helper()
+	l := &LastFm{ApiKey: "key", Secret: "secret"}
+	// the stand-in knows the real secret
+	signer := *l
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		params := r.PostForm
+		*calls = append(*calls, params)
+
+		// recompute the signature without format and api_sig
+		signed := url.Values{}
+		for key, values := range params {
+			if key != "format" && key != "api_sig" {
+				signed[key] = values
+			}
+		}
+		signer.sign(signed)
+		if params.Get("api_sig") != signed.Get("api_sig") || params.Get("format") != "json" {
+			fmt.Fprint(w, `{"error": 13, "message": "Invalid method signature supplied"}`)
+			return
+		}
+
+		switch params.Get("method") {
+		case "auth.getToken":
+			fmt.Fprint(w, `{"token": "tok"}`)
+		case "auth.getSession":
+			if params.Get("token") != "tok" {
+				fmt.Fprint(w, `{"error": 14, "message": "Unauthorized Token"}`)
+				return
+			}
+			fmt.Fprint(w, `{"session": {"name": "demo", "key": "session-key", "subscriber": 0}}`)
+		case "track.updateNowPlaying", "track.scrobble":
+			if *errorCode != 0 {
+				fmt.Fprintf(w, `{"error": %d, "message": "failed"}`, *errorCode)
+				return
+			}
+			if params.Get("sk") != "session-key" {
+				fmt.Fprint(w, `{"error": 9, "message": "Invalid session key"}`)
+				return
+			}
+			if params.Get("method") == "track.scrobble" {
+				fmt.Fprint(w, `{"scrobbles": {"@attr": {"accepted": 1, "ignored": 0}}}`)
+			} else {
+				fmt.Fprint(w, `{"nowplaying": {}}`)
+			}
+		default:
+			fmt.Fprint(w, `{"error": 3, "message": "Invalid Method"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	l.Url = server.URL
+	return l
+}
+
+func TestLastFmAuth(t *testing.T) {
+	errorCode := 0
+	var calls []url.Values
+	l := lastFmStandIn(t, &errorCode, &calls)
+
+	token, err := l.GetToken()
+	if err != nil || token != "tok" {
+		t.Fatalf("got token %q, %v", token, err)
+	}
+	if authUrl := l.AuthUrl(LastFmAuthUrl, token); authUrl != "https://www.last.fm/api/auth/?api_key=key&token=tok" {
+		t.Errorf("unexpected auth url %q", authUrl)
+	}
+
+	name, key, err := l.GetSession(token)
+	if err != nil || name != "demo" || key != "session-key" {
+		t.Errorf("got session %q %q, %v", name, key, err)
+	}
+
+	if _, _, err = l.GetSession("other"); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected error for unauthorized token, got %v", err)
+	}
+}
+
+func TestLastFmScrobble(t *testing.T) {
+	errorCode := 0
+	var calls []url.Values
+	l := lastFmStandIn(t, &errorCode, &calls)
+	l.SessionKey = "session-key"
+
+	if err := l.NowPlaying(testTrack); err != nil {
+		t.Fatal(err)
+	}
+	playedAt := time.Unix(1700000000, 0)
+	if err := l.Submit(testTrack, playedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 2 || calls[0].Get("method") != "track.updateNowPlaying" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	scrobble := calls[1]
+	if scrobble.Get("timestamp") != "1700000000" || scrobble.Get("artist") != "Aurora Lane" ||
+		scrobble.Get("track") != "First Frost" || scrobble.Get("album") != "Northern Lights" ||
+		scrobble.Get("duration") != "200" {
+		t.Errorf("unexpected scrobble %v", scrobble)
+	}
+}
+
+func TestLastFmErrors(t *testing.T) {
+	errorCode := 0
+	var calls []url.Values
+	l := lastFmStandIn(t, &errorCode, &calls)
+
+	// invalid session key is kept for retry
+	var apiErr *LastFmError
+	if err := l.Submit(testTrack, time.Now()); !errors.As(err, &apiErr) || apiErr.Code != 9 {
+		t.Errorf("expected invalid session key, got %v", err)
+	}
+	l.SessionKey = "session-key"
+
+	errorCode = lastFmServiceOffline
+	if err := l.Submit(testTrack, time.Now()); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("expected temporary error, got %v", err)
+	}
+
+	errorCode = 6 // invalid parameters
+	if err := l.Submit(testTrack, time.Now()); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected, got %v", err)
+	}
+
+	l.Secret = "wrong"
+	errorCode = 0
+	if err := l.Submit(testTrack, time.Now()); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected for wrong signature, got %v", err)
+	}
+}
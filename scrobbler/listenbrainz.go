@@ -0,0 +1,127 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package scrobbler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ListenBrainzUrl = "https://api.listenbrainz.org"
+
+// ListenBrainz submits listens with a user token,
+// see https://listenbrainz.readthedocs.io/en/latest/users/api/core.html
+type ListenBrainz struct {
+	// Url is the API root, ListenBrainzUrl by default
+	Url   string
+	Token string
+
+	ClientName    string
+	ClientVersion string
+}
+
+var _ Target = (*ListenBrainz)(nil)
+
+type listenBrainzSubmission struct {
+	ListenType string                `json:"listen_type"`
+	Payload    []listenBrainzPayload `json:"payload"`
+}
+
+type listenBrainzPayload struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info,omitempty"`
+}
+
+type listenBrainzError struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+func (l *ListenBrainz) Name() string {
+	return "listenbrainz"
+}
+
+func (l *ListenBrainz) NowPlaying(track Track) error {
+	return l.submit("playing_now", track, 0)
+}
+
+func (l *ListenBrainz) Submit(track Track, playedAt time.Time) error {
+	return l.submit("single", track, playedAt.Unix())
+}
+
+func (l *ListenBrainz) submit(listenType string, track Track, listenedAt int64) error {
+	if track.Artist == "" || track.Title == "" {
+		return fmt.Errorf("%w: artist and title are required", ErrRejected)
+	}
+
+	info := map[string]interface{}{
+		"submission_client":         l.ClientName,
+		"submission_client_version": l.ClientVersion,
+	}
+	if track.Duration > 0 {
+		info["duration_ms"] = track.Duration * 1000
+	}
+	if track.TrackNumber > 0 {
+		info["tracknumber"] = track.TrackNumber
+	}
+
+	body, err := json.Marshal(listenBrainzSubmission{
+		ListenType: listenType,
+		Payload: []listenBrainzPayload{{
+			ListenedAt: listenedAt,
+			TrackMetadata: listenBrainzTrackMetadata{
+				ArtistName:     track.Artist,
+				TrackName:      track.Title,
+				ReleaseName:    track.Album,
+				AdditionalInfo: info,
+			},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(l.Url, "/") + "/1/submit-listens"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+l.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	apiErr := listenBrainzError{Code: res.StatusCode}
+	if data, err := io.ReadAll(res.Body); err == nil {
+		_ = json.Unmarshal(data, &apiErr)
+	}
+	if apiErr.Error == "" {
+		apiErr.Error = res.Status
+	}
+	if res.StatusCode == http.StatusBadRequest {
+		// invalid listen, it won't become valid later
+		return fmt.Errorf("%w: %s", ErrRejected, apiErr.Error)
+	}
+	return fmt.Errorf("listenbrainz: %d %s", apiErr.Code, apiErr.Error)
+}
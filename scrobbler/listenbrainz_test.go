@@ -0,0 +1,122 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package scrobbler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testTrack = Track{
+	Id:          "tr-1",
+	Title:       "First Frost",
+	Artist:      "Aurora Lane",
+	Album:       "Northern Lights",
+	Duration:    200,
+	TrackNumber: 1,
+}
+
+// listenBrainzStandIn records submissions and answers with status
+func listenBrainzStandIn(t *testing.T, status int, submissions *[]listenBrainzSubmission) *ListenBrainz {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/submit-listens" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Token secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code": 401, "error": "Invalid authorization token."}`))
+			return
+		}
+
+		var submission listenBrainzSubmission
+		if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+			t.Error(err)
+		}
+		*submissions = append(*submissions, submission)
+
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"status": "ok"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"code": 400, "error": "bad listen"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &ListenBrainz{
+		Url:           server.URL,
+		Token:         "secret-token",
+		ClientName:    "stmps",
+		ClientVersion: "1.0",
+	}
+}
+
+func TestListenBrainzNowPlaying(t *testing.T) {
+	var submissions []listenBrainzSubmission
+	l := listenBrainzStandIn(t, http.StatusOK, &submissions)
+
+	if err := l.NowPlaying(testTrack); err != nil {
+		t.Fatal(err)
+	}
+	if len(submissions) != 1 || submissions[0].ListenType != "playing_now" {
+		t.Fatalf("unexpected submissions %+v", submissions)
+	}
+	payload := submissions[0].Payload[0]
+	if payload.ListenedAt != 0 || payload.TrackMetadata.TrackName != "First Frost" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestListenBrainzSubmit(t *testing.T) {
+	var submissions []listenBrainzSubmission
+	l := listenBrainzStandIn(t, http.StatusOK, &submissions)
+
+	playedAt := time.Unix(1700000000, 0)
+	if err := l.Submit(testTrack, playedAt); err != nil {
+		t.Fatal(err)
+	}
+	if len(submissions) != 1 || submissions[0].ListenType != "single" {
+		t.Fatalf("unexpected submissions %+v", submissions)
+	}
+	payload := submissions[0].Payload[0]
+	metadata := payload.TrackMetadata
+	if payload.ListenedAt != 1700000000 || metadata.ArtistName != "Aurora Lane" ||
+		metadata.ReleaseName != "Northern Lights" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if metadata.AdditionalInfo["duration_ms"] != float64(200000) ||
+		metadata.AdditionalInfo["submission_client"] != "stmps" {
+		t.Errorf("unexpected additional info %+v", metadata.AdditionalInfo)
+	}
+}
+
+func TestListenBrainzErrors(t *testing.T) {
+	var submissions []listenBrainzSubmission
+	l := listenBrainzStandIn(t, http.StatusBadRequest, &submissions)
+
+	if err := l.Submit(testTrack, time.Now()); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected for bad request, got %v", err)
+	}
+	if err := l.Submit(Track{Id: "tr-1"}, time.Now()); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected without metadata, got %v", err)
+	}
+
+	// a wrong token is retried, the user may fix it
+	l.Token = "wrong"
+	if err := l.Submit(testTrack, time.Now()); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("expected temporary error for wrong token, got %v", err)
+	}
+
+	// unreachable
+	l.Url = "http://127.0.0.1:1"
+	if err := l.Submit(testTrack, time.Now()); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("expected temporary error when unreachable, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package scrobbler submits listens to scrobble services like ListenBrainz
+// and Last.fm directly, without the Subsonic server in between.
+package scrobbler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrRejected is wrapped by errors for scrobbles the service will never
+// accept, e.g. because of missing metadata. These shouldn't be retried.
+var ErrRejected = errors.New("scrobble rejected")
+
+// Track is the metadata of a scrobbled song
+type Track struct {
+	Id          string `json:"id"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Duration    int    `json:"duration,omitempty"` // seconds
+	TrackNumber int    `json:"trackNumber,omitempty"`
+}
+
+// Target is a service receiving scrobbles
+type Target interface {
+	// Name is used in logs and as key for the retry queue
+	Name() string
+	// NowPlaying announces the track that just started playing
+	NowPlaying(track Track) error
+	// Submit scrobbles a track that started playing at playedAt
+	Submit(track Track, playedAt time.Time) error
+}
+
+const requestTimeout = 30 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
@@ -0,0 +1,85 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+const sessionFile = "session.json"
+
+// session is the local playback state, saved on quit and restored paused on
+// the next start. It doesn't depend on the server's savePlayQueue.
+type session struct {
+	// server profile the queue belongs to, empty if nothing was saved
+	Server string `json:"server"`
+
+	// stream uris aren't saved, they contain the credentials
+	Queue    player.PlayerQueue `json:"queue"`
+	Current  int                `json:"current"`
+	Played   []bool             `json:"played"`
+	Position float64            `json:"position"`
+
+	Volume  int               `json:"volume"`
+	Shuffle bool              `json:"shuffle"`
+	Repeat  remote.RepeatMode `json:"repeat"`
+	Page    string            `json:"page"`
+}
+
+// saveSession remembers the queue and settings of the local player and the
+// active page. The volume is the user's, also while the sleep timer fades out.
+func saveSession(localPlayer player.PlayerInterface, connection *subsonic.SubsonicConnection, page string) error {
+	queue, current, played := localPlayer.GetQueueCopy()
+	for i := range queue {
+		queue[i].Uri = ""
+		// the error may be gone with the next session's stream uri
+		queue[i].Error = ""
+	}
+	modes := localPlayer.GetModes()
+
+	return writeStateFile(sessionFile, session{
+		Server:   serverProfile(connection),
+		Queue:    queue,
+		Current:  current,
+		Played:   played,
+		Position: localPlayer.GetTimePos(),
+		Volume:   localPlayer.GetVolume(),
+		Shuffle:  modes.Shuffle,
+		Repeat:   modes.Repeat,
+		Page:     page,
+	})
+}
+
+// restoreSession loads the saved session into the local player, the current
+// song is paused at the saved position. The queue is only restored for the
+// same server profile. It returns the page that was active.
+func restoreSession(player player.PlayerInterface, connection *subsonic.SubsonicConnection, logger logger.LoggerInterface) (page string, err error) {
+	saved := session{}
+	if err = readStateFile(sessionFile, &saved); err != nil || saved.Server == "" {
+		return
+	}
+
+	if err := player.SetVolume(saved.Volume); err != nil {
+		logger.PrintError("restoreSession: SetVolume", err)
+	}
+	if err := player.SetShuffle(saved.Shuffle); err != nil {
+		logger.PrintError("restoreSession: SetShuffle", err)
+	}
+	if err := player.SetRepeat(saved.Repeat); err != nil {
+		logger.PrintError("restoreSession: SetRepeat", err)
+	}
+
+	if saved.Server == serverProfile(connection) && len(saved.Queue) > 0 {
+		for i := range saved.Queue {
+			saved.Queue[i].Uri = connection.GetPlayUrl(&subsonic.SubsonicEntity{Id: saved.Queue[i].Id})
+		}
+		if err := player.LoadQueue(saved.Queue, saved.Current, saved.Played, saved.Position); err != nil {
+			logger.PrintError("restoreSession: LoadQueue", err)
+		}
+	}
+	return saved.Page, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/fakeplayer"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic/subsonictest"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	t.Cleanup(server.Close)
+	logger := logger.Init()
+	connection := server.Connection(logger)
+
+	// the demo album Northern Lights, played up to the second song
+	response, err := connection.GetMusicDirectory("ar-1-1-al-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := player.PlayerQueue{}
+	for i := range response.Directory.Entities {
+		entity := &response.Directory.Entities[i]
+		items = append(items, player.NewQueueItem(entity, connection.GetPlayUrl(entity)))
+	}
+	saved := fakeplayer.NewPlayer(logger)
+	if err := saved.PlayItems(items); err != nil {
+		t.Fatal(err)
+	}
+	saved.Advance(time.Duration(items[0].Duration) * time.Second)
+	saved.Advance(5 * time.Second)
+	if err := saved.SetVolume(70); err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.SetRepeat(remote.RepeatAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveSession(saved, connection, PageQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := fakeplayer.NewPlayer(logger)
+	page, err := restoreSession(restored, connection, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page != PageQueue {
+		t.Errorf("expected the queue page, got %q", page)
+	}
+	queue, current, played := restored.GetQueueCopy()
+	if len(queue) != len(items) || current != 1 || !played[0] || played[1] {
+		t.Fatalf("unexpected queue %+v, current %d, played %v", queue, current, played)
+	}
+	for i := range queue {
+		// the stream uri is made anew, its salt differs
+		if queue[i].Id != items[i].Id || !strings.Contains(queue[i].Uri, "id="+items[i].Id) || queue[i].Title != items[i].Title {
+			t.Errorf("expected %+v at %d, got %+v", items[i], i, queue[i])
+		}
+	}
+	if paused, _ := restored.IsPaused(); !paused {
+		t.Error("expected the restored song paused")
+	}
+	if position := restored.GetTimePos(); position != 5 {
+		t.Errorf("expected position 5, got %f", position)
+	}
+	if volume := restored.GetVolume(); volume != 70 {
+		t.Errorf("expected volume 70, got %d", volume)
+	}
+	if repeat := restored.GetRepeat(); repeat != remote.RepeatAll {
+		t.Errorf("expected repeat all, got %v", repeat)
+	}
+
+	// another user's queue isn't restored, the settings are
+	connection.Username = "other"
+	other := fakeplayer.NewPlayer(logger)
+	if _, err := restoreSession(other, connection, logger); err != nil {
+		t.Fatal(err)
+	}
+	if queue, _, _ := other.GetQueueCopy(); len(queue) != 0 {
+		t.Errorf("expected no queue for another profile, got %+v", queue)
+	}
+	if volume := other.GetVolume(); volume != 70 {
+		t.Errorf("expected volume 70, got %d", volume)
+	}
+}
+
+func TestSessionNothingSaved(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	logger := logger.Init()
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	t.Cleanup(server.Close)
+
+	p := fakeplayer.NewPlayer(logger)
+	volume := p.GetVolume()
+	page, err := restoreSession(p, server.Connection(logger), logger)
+	if err != nil || page != "" {
+		t.Fatalf("expected nothing restored, got %q %v", page, err)
+	}
+	if p.GetVolume() != volume {
+		t.Errorf("expected the volume unchanged, got %d", p.GetVolume())
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spezifisch/stmps/player"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+const musicFoldersFile = "musicfolders.json"
+const equalizerPresetsFile = "equalizer.json"
+const speedsFile = "speed.json"
+const audioOutputFile = "audiodevice.json"
+
+// stateDir returns the directory for local state, $XDG_STATE_HOME/stmp or
+// ~/.local/state/stmp as a fallback.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "stmp"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "stmp"), nil
+}
+
+// readStateFile decodes a json file from the state directory into v.
+// A missing file is not an error, v is left untouched in that case.
+func readStateFile(name string, v interface{}) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeStateFile encodes v as json into the state directory
+func writeStateFile(name string, v interface{}) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so we don't leave a broken file behind
+	path := filepath.Join(dir, name)
+	if err = os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// serverProfile identifies a user on a server, used as key for per-server state
+func serverProfile(connection *subsonic.SubsonicConnection) string {
+	return connection.Username + "@" + connection.Host
+}
+
+// loadMusicFolder returns the music folder id remembered for this server profile
+func loadMusicFolder(connection *subsonic.SubsonicConnection) (string, error) {
+	folders := map[string]string{}
+	if err := readStateFile(musicFoldersFile, &folders); err != nil {
+		return "", err
+	}
+	return folders[serverProfile(connection)], nil
+}
+
+// saveMusicFolder remembers the selected music folder id for this server profile
+func saveMusicFolder(connection *subsonic.SubsonicConnection) error {
+	folders := map[string]string{}
+	if err := readStateFile(musicFoldersFile, &folders); err != nil {
+		return err
+	}
+
+	profile := serverProfile(connection)
+	if connection.MusicFolderId == "" {
+		delete(folders, profile)
+	} else {
+		folders[profile] = connection.MusicFolderId
+	}
+	return writeStateFile(musicFoldersFile, folders)
+}
+
+// loadEqualizerPresets returns the equalizer presets saved from the ui
+func loadEqualizerPresets() (map[string]player.Equalizer, error) {
+	presets := map[string]player.Equalizer{}
+	if err := readStateFile(equalizerPresetsFile, &presets); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+// saveEqualizerPresets replaces the saved equalizer presets
+func saveEqualizerPresets(presets map[string]player.Equalizer) error {
+	return writeStateFile(equalizerPresetsFile, presets)
+}
+
+// loadSpeeds returns the playback speeds by content kind
+func loadSpeeds() (map[player.ContentKind]float64, error) {
+	speeds := map[player.ContentKind]float64{}
+	if err := readStateFile(speedsFile, &speeds); err != nil {
+		return nil, err
+	}
+	return speeds, nil
+}
+
+// saveSpeeds remembers the playback speeds by content kind
+func saveSpeeds(speeds map[player.ContentKind]float64) error {
+	return writeStateFile(speedsFile, speeds)
+}
+
+// audioOutput is the selected audio device and the devices that are used
+// exclusively
+type audioOutput struct {
+	Device    string   `json:"device"`
+	Exclusive []string `json:"exclusive"`
+
+	// set in the config, which takes precedence over the picker's choice
+	DeviceFromConfig    bool `json:"-"`
+	ExclusiveFromConfig bool `json:"-"`
+}
+
+// IsExclusive returns true if the device should be used in exclusive mode
+func (a *audioOutput) IsExclusive(device string) bool {
+	for _, name := range a.Exclusive {
+		if name == device {
+			return true
+		}
+	}
+	return false
+}
+
+// SetExclusive adds or removes a device from the exclusive ones
+func (a *audioOutput) SetExclusive(device string, exclusive bool) {
+	names := []string{}
+	for _, name := range a.Exclusive {
+		if name != device {
+			names = append(names, name)
+		}
+	}
+	if exclusive {
+		names = append(names, device)
+	}
+	a.Exclusive = names
+}
+
+// loadAudioOutput returns the audio output picked in the ui. Settings that
+// are in the config take precedence.
+func loadAudioOutput() (audioOutput, error) {
+	output := audioOutput{}
+	err := readStateFile(audioOutputFile, &output)
+
+	if viper.IsSet("player.audio_device") {
+		output.Device = viper.GetString("player.audio_device")
+		output.DeviceFromConfig = true
+	}
+	if viper.IsSet("player.exclusive_devices") {
+		output.Exclusive = viper.GetStringSlice("player.exclusive_devices")
+		output.ExclusiveFromConfig = true
+	}
+	return output, err
+}
+
+// saveAudioOutput remembers the audio output picked in the ui. Settings from
+// the config aren't stored, they only change for this session.
+func saveAudioOutput(output audioOutput) error {
+	saved := audioOutput{}
+	if err := readStateFile(audioOutputFile, &saved); err != nil {
+		return err
+	}
+	if !output.DeviceFromConfig {
+		saved.Device = output.Device
+	}
+	if !output.ExclusiveFromConfig {
+		saved.Exclusive = output.Exclusive
+	}
+	return writeStateFile(audioOutputFile, saved)
+}
+
+// source tells which settings come from the config, changes to these are
+// forgotten on quit. Empty if the picker's choice is remembered.
+func (a *audioOutput) source() string {
+	switch {
+	case a.DeviceFromConfig && a.ExclusiveFromConfig:
+		return "config: device, exclusive"
+	case a.DeviceFromConfig:
+		return "config: device"
+	case a.ExclusiveFromConfig:
+		return "config: exclusive"
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAudioOutputConfigWins(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	// picked in the ui
+	if err := saveAudioOutput(audioOutput{Device: "alsa/hw:1", Exclusive: []string{"alsa/hw:1"}}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := loadAudioOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Device != "alsa/hw:1" || !output.IsExclusive("alsa/hw:1") || output.source() != "" {
+		t.Fatalf("expected the picked output, got %+v", output)
+	}
+
+	// the config takes precedence
+	viper.Set("player.audio_device", "pulse")
+	output, _ = loadAudioOutput()
+	if output.Device != "pulse" || !output.IsExclusive("alsa/hw:1") || output.source() != "config: device" {
+		t.Fatalf("expected the device from the config, got %+v", output)
+	}
+
+	// a device picked meanwhile isn't stored, exclusive mode still is
+	output.Device = "alsa/hw:2"
+	output.SetExclusive("alsa/hw:2", true)
+	if err := saveAudioOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	output, _ = loadAudioOutput()
+	if output.Device != "alsa/hw:1" || !output.IsExclusive("alsa/hw:2") {
+		t.Fatalf("unexpected stored output %+v", output)
+	}
+}
@@ -4,55 +4,101 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
 
+	"github.com/spezifisch/stmps/fakeplayer"
+	"github.com/spezifisch/stmps/jukebox"
 	"github.com/spezifisch/stmps/logger"
 	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/player"
 	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spezifisch/stmps/subsonic/subsonictest"
 	"github.com/spf13/viper"
 )
 
-func readConfig() {
-	required_properties := []string{"auth.username", "auth.password", "server.host"}
+// initEnv lets environment variables like STMP_SERVER_HOST override the
+// config properties
+func initEnv() {
+	viper.SetEnvPrefix("stmp")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
 
+// readConfigFile reads stmp.toml, it exits if the file is broken or if it's
+// required but missing
+func readConfigFile(required bool) {
 	viper.SetConfigName("stmp")
 	viper.SetConfigType("toml")
 	viper.AddConfigPath("$HOME/.config/stmp")
 	viper.AddConfigPath(".")
 	err := viper.ReadInConfig()
 
-	if err != nil {
+	var notFound viper.ConfigFileNotFoundError
+	if err != nil && !(errors.As(err, &notFound) && !required) {
 		fmt.Printf("Config file error: %s \n", err)
 		os.Exit(1)
 	}
+}
+
+func readConfig() {
+	required_properties := []string{"auth.username", "server.host"}
+
+	// the config file is optional if the environment provides the server
+	readConfigFile(!viper.IsSet("server.host"))
 
 	for _, prop := range required_properties {
 		if !viper.IsSet(prop) {
 			fmt.Printf("Config property %s is required\n", prop)
 		}
 	}
+
+	readPassword()
+}
+
+// readPassword resolves the password from its configured source
+func readPassword() {
+	password, err := resolvePassword()
+	if err != nil {
+		fmt.Printf("Unable to get password: %s\n", err)
+		os.Exit(1)
+	}
+	if password == "" {
+		fmt.Println("Config property auth.password, auth.password_command or auth.keyring is required")
+	}
+	viper.Set("auth.password", password)
 }
 
 // parseConfig takes the first non-flag arguments from flags and parses it
 // into the viper config.
 func parseConfig() {
+	// the config file may still hold the password source and other settings
+	readConfigFile(false)
+
 	if u, e := url.Parse(flag.Arg(0)); e == nil {
+		hasPassword := false
 		// If credentials were provided
 		if len(u.User.Username()) > 0 {
 			viper.Set("auth.username", u.User.Username())
-			// If the password wasn't provided, the program will fail as normal
 			if p, s := u.User.Password(); s {
 				viper.Set("auth.password", p)
+				hasPassword = true
 			}
 		}
 		// Blank out the credentials so we can use the URL formatting
 		u.User = nil
 		viper.Set("server.host", u.String())
+
+		// If the password wasn't provided, it's read from the environment etc.
+		if !hasPassword {
+			readPassword()
+		}
 	} else {
 		fmt.Printf("Invalid server format; must be a valid URL: http[s]://[user:pass@]server:port")
 		fmt.Printf("USAGE: %s <args> [http[s]://[user:pass@]server:port]\n", os.Args[0])
@@ -61,10 +107,72 @@ func parseConfig() {
 	}
 }
 
+// replayGainFromConfig reads the volume normalisation settings, clipping is
+// prevented unless disabled
+func replayGainFromConfig() (player.ReplayGain, error) {
+	mode, err := player.ParseReplayGainMode(viper.GetString("replaygain.mode"))
+	if err != nil {
+		return player.ReplayGain{}, err
+	}
+	replayGain := player.ReplayGain{
+		Mode:        mode,
+		Preamp:      viper.GetFloat64("replaygain.preamp"),
+		PreventClip: true,
+	}
+	if viper.IsSet("replaygain.prevent_clip") {
+		replayGain.PreventClip = viper.GetBool("replaygain.prevent_clip")
+	}
+	return replayGain, nil
+}
+
+// initMpvPlayer starts mpv with the sound settings from the config and the
+// state directory. It exits if mpv can't be used.
+func initMpvPlayer(logger *logger.Logger) *mpvplayer.Player {
+	mpvPlayer, err := mpvplayer.NewPlayer(logger)
+	if err != nil {
+		fmt.Println("Unable to initialize mpv. Is mpv installed?")
+		os.Exit(1)
+	}
+
+	replayGain, err := replayGainFromConfig()
+	if err != nil {
+		fmt.Printf("Config error: %s\n", err)
+		os.Exit(1)
+	}
+	if err := mpvPlayer.SetReplayGain(replayGain); err != nil {
+		logger.PrintError("SetReplayGain", err)
+	}
+
+	// playback speed, remembered for music and podcasts separately
+	pitchCorrection := true
+	if viper.IsSet("player.pitch_correction") {
+		pitchCorrection = viper.GetBool("player.pitch_correction")
+	}
+	if err := mpvPlayer.SetPitchCorrection(pitchCorrection); err != nil {
+		logger.PrintError("SetPitchCorrection", err)
+	}
+	if speeds, err := loadSpeeds(); err != nil {
+		logger.PrintError("loadSpeeds", err)
+	} else if err := mpvPlayer.SetSpeeds(speeds); err != nil {
+		logger.PrintError("SetSpeeds", err)
+	}
+
+	if output, err := loadAudioOutput(); err != nil {
+		logger.PrintError("loadAudioOutput", err)
+	} else if output.Device != "" {
+		if err := mpvPlayer.SetAudioDevice(output.Device, output.IsExclusive(output.Device)); err != nil {
+			logger.PrintError("SetAudioDevice", err)
+		}
+	}
+	return mpvPlayer
+}
+
 func main() {
 	help := flag.Bool("help", false, "Print usage")
 	enableMpris := flag.Bool("mpris", false, "Enable MPRIS2")
 	list := flag.Bool("list", false, "list server data")
+	demo := flag.Bool("demo", false, "Use a built-in fake server with a demo library and a silent fake player")
+	lastFmAuth := flag.Bool("lastfm-auth", false, "Get a Last.fm session key for scrobbling")
 	flag.Parse()
 	if *help {
 		fmt.Printf("USAGE: %s <args> [[user:pass@]server:port]\n", os.Args[0])
@@ -72,12 +180,29 @@ func main() {
 		os.Exit(0)
 	}
 
-	if len(flag.Args()) > 0 {
+	initEnv()
+
+	if *demo {
+		// the fake server runs in-process for the lifetime of the program
+		server := subsonictest.NewServer(subsonictest.DemoLibrary())
+		defer server.Close()
+		viper.Set("server.host", server.URL)
+		viper.Set("auth.username", subsonictest.DefaultUsername)
+		viper.Set("auth.password", subsonictest.DefaultPassword)
+	} else if len(flag.Args()) > 0 {
 		parseConfig()
 	} else {
 		readConfig()
 	}
 
+	if *lastFmAuth {
+		if err := authenticateLastFm(); err != nil {
+			fmt.Printf("Last.fm authentication failed: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	logger := logger.Init()
 
 	connection := subsonic.Init(logger)
@@ -88,6 +213,13 @@ func main() {
 	connection.PlaintextAuth = viper.GetBool("auth.plaintext")
 	connection.Scrobble = viper.GetBool("server.scrobble")
 
+	// restore music folder selection for this server
+	if musicFolderId, err := loadMusicFolder(connection); err != nil {
+		fmt.Printf("Error reading music folder selection: %s\n", err)
+	} else {
+		connection.MusicFolderId = musicFolderId
+	}
+
 	indexResponse, err := connection.GetIndexes()
 	if err != nil {
 		fmt.Printf("Error fetching indexes from server: %s\n", err)
@@ -131,16 +263,39 @@ func main() {
 		os.Exit(0)
 	}
 
-	// init mpv engine
-	player, err := mpvplayer.NewPlayer(logger)
-	if err != nil {
-		fmt.Println("Unable to initialize mpv. Is mpv installed?")
-		os.Exit(1)
+	// init the local player, the demo plays silently without mpv
+	var localPlayer player.PlayerInterface
+	var mpvPlayer *mpvplayer.Player
+	if *demo {
+		localPlayer = fakeplayer.NewPlayer(logger)
+	} else {
+		mpvPlayer = initMpvPlayer(logger)
+		localPlayer = mpvPlayer
+	}
+
+	// continue where the last session ended. The demo's server is a new one
+	// each time, its session isn't saved so that it doesn't replace the real one.
+	page := ""
+	if !*demo {
+		restoredPage, err := restoreSession(localPlayer, connection, logger)
+		if err != nil {
+			fmt.Printf("Error restoring the last session: %s\n", err)
+		}
+		page = restoredPage
+	}
+
+	// the server's jukebox can be controlled instead of playing locally
+	musicPlayer := newPlayerSwitch(localPlayer, jukebox.NewPlayer(connection, logger))
+	if viper.GetString("player.backend") == "jukebox" {
+		if err := musicPlayer.SetJukebox(true); err != nil {
+			fmt.Printf("Unable to control the server's jukebox: %s\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// init mpris2 player control (linux only but fails gracefully on other systems)
 	if *enableMpris {
-		mpris, err := remote.RegisterMprisPlayer(player, logger)
+		mpris, err := remote.RegisterMprisPlayer(musicPlayer, logger)
 		if err != nil {
 			fmt.Printf("Unable to register MPRIS with DBUS: %s\n", err)
 			fmt.Println("Try running without MPRIS")
@@ -151,7 +306,7 @@ func main() {
 
 	// init macos mediaplayer control
 	if runtime.GOOS == "darwin" {
-		if err = remote.RegisterMPMediaHandler(player, logger); err != nil {
+		if err = remote.RegisterMPMediaHandler(musicPlayer, logger); err != nil {
 			fmt.Printf("Unable to initialize MediaPlayer bindings: %s\n", err)
 			os.Exit(1)
 		} else {
@@ -162,11 +317,25 @@ func main() {
 	ui := InitGui(&indexResponse.Indexes.Index,
 		&playlistResponse.Playlists.Playlists,
 		connection,
-		player,
+		musicPlayer,
 		logger)
+	if ui.menuWidget.HasPage(page) {
+		ui.ShowPage(page)
+	}
 
 	// run main loop
 	if err := ui.Run(); err != nil {
 		panic(err)
 	}
+
+	if !*demo {
+		if err := saveSession(localPlayer, connection, ui.menuWidget.GetActivePage()); err != nil {
+			fmt.Printf("Unable to save the session: %s\n", err)
+		}
+	}
+	if mpvPlayer != nil {
+		if err := saveSpeeds(mpvPlayer.GetSpeeds()); err != nil {
+			fmt.Printf("Unable to save the playback speed: %s\n", err)
+		}
+	}
 }
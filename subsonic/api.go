@@ -5,11 +5,13 @@ package subsonic
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spezifisch/stmps/logger"
 )
@@ -21,6 +23,10 @@ type SubsonicConnection struct {
 	PlaintextAuth bool
 	Scrobble      bool
 
+	// MusicFolderId restricts indexes, random songs, album lists and search
+	// to a single music folder. Empty means all folders.
+	MusicFolderId string
+
 	clientName    string
 	clientVersion string
 
@@ -68,6 +74,13 @@ func defaultQuery(connection *SubsonicConnection) url.Values {
 	return query
 }
 
+// setMusicFolder adds the musicFolderId parameter if a folder is selected
+func setMusicFolder(connection *SubsonicConnection, query url.Values) {
+	if connection.MusicFolderId != "" {
+		query.Set("musicFolderId", connection.MusicFolderId)
+	}
+}
+
 // response structs
 type SubsonicError struct {
 	Code    int    `json:"code"`
@@ -75,9 +88,56 @@ type SubsonicError struct {
 }
 
 type SubsonicArtist struct {
-	Id         string
-	Name       string
-	AlbumCount int
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	AlbumCount int    `json:"albumCount"`
+}
+
+type SubsonicMusicFolder struct {
+	Id   SubsonicId `json:"id"`
+	Name string     `json:"name"`
+}
+
+type SubsonicMusicFolders struct {
+	Folders []SubsonicMusicFolder `json:"musicFolder"`
+}
+
+type SubsonicAlbumList struct {
+	Album SubsonicEntities `json:"album"`
+}
+
+type SubsonicSearchResult struct {
+	Artist []SubsonicArtist `json:"artist"`
+	Album  SubsonicEntities `json:"album"`
+	Song   SubsonicEntities `json:"song"`
+}
+
+type SubsonicNowPlaying struct {
+	Entries []SubsonicNowPlayingEntry `json:"entry"`
+}
+
+// SubsonicNowPlayingEntry is a song someone is currently playing on the server
+type SubsonicNowPlayingEntry struct {
+	SubsonicEntity
+	Username   string     `json:"username"`
+	MinutesAgo int        `json:"minutesAgo"`
+	PlayerId   SubsonicId `json:"playerId"`
+	PlayerName string     `json:"playerName"`
+}
+
+type SubsonicScanStatus struct {
+	Scanning bool `json:"scanning"`
+	Count    int  `json:"count"`
+}
+
+// SubsonicJukeboxStatus is the playback state of the server's jukebox.
+// Entries are only filled by JukeboxGet.
+type SubsonicJukeboxStatus struct {
+	CurrentIndex int              `json:"currentIndex"`
+	Playing      bool             `json:"playing"`
+	Gain         float64          `json:"gain"`
+	Position     int              `json:"position"`
+	Entries      SubsonicEntities `json:"entry,omitempty"`
 }
 
 type SubsonicDirectory struct {
@@ -97,16 +157,52 @@ type SubsonicStarred struct {
 	Song   SubsonicEntities `json:"song"`
 }
 
+// SubsonicEntity is a song, album or directory ("child" in the Subsonic API).
+// It is shared by directory, album, playlist, random song and starred responses.
 type SubsonicEntity struct {
 	Id          string `json:"id"`
 	IsDirectory bool   `json:"isDir"`
 	Parent      string `json:"parent"`
 	Title       string `json:"title"`
+	Album       string `json:"album"`
 	Artist      string `json:"artist"`
+	AlbumId     string `json:"albumId"`
+	ArtistId    string `json:"artistId"`
 	Duration    int    `json:"duration"`
 	Track       int    `json:"track"`
-	DiskNumber  int    `json:"diskNumber"`
+	DiskNumber  int    `json:"discNumber"`
+	Year        int    `json:"year"`
+	Genre       string `json:"genre"`
+	CoverArtId  string `json:"coverArt"`
 	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Suffix      string `json:"suffix"`
+	ContentType string `json:"contentType"`
+	Type        string `json:"type"`    // music, podcast, audiobook or video
+	BitRate     int    `json:"bitRate"` // kbps
+
+	// user data, Starred and Created are ISO 8601 timestamps
+	Starred    string `json:"starred"`
+	UserRating int    `json:"userRating"`
+	PlayCount  int64  `json:"playCount"`
+	Created    string `json:"created"`
+
+	// OpenSubsonic extensions, empty on plain Subsonic servers
+	ReplayGain    SubsonicReplayGain `json:"replayGain"`
+	MusicBrainzId string             `json:"musicBrainzId"`
+	Bpm           int                `json:"bpm"`
+	Comment       string             `json:"comment"`
+	SortName      string             `json:"sortName"`
+}
+
+// SubsonicReplayGain holds the OpenSubsonic ReplayGain values in dB
+type SubsonicReplayGain struct {
+	TrackGain    float64 `json:"trackGain"`
+	AlbumGain    float64 `json:"albumGain"`
+	TrackPeak    float64 `json:"trackPeak"`
+	AlbumPeak    float64 `json:"albumPeak"`
+	BaseGain     float64 `json:"baseGain"`
+	FallbackGain float64 `json:"fallbackGain"`
 }
 
 // Return the title if present, otherwise fallback to the file path
@@ -155,7 +251,7 @@ func (s SubsonicEntities) Less(i, j int) bool {
 }
 
 type SubsonicIndexes struct {
-	Index []SubsonicIndex
+	Index []SubsonicIndex `json:"index"`
 }
 
 type SubsonicIndex struct {
@@ -175,15 +271,23 @@ type SubsonicPlaylist struct {
 }
 
 type SubsonicResponse struct {
-	Status      string            `json:"status"`
-	Version     string            `json:"version"`
-	Indexes     SubsonicIndexes   `json:"indexes"`
-	Directory   SubsonicDirectory `json:"directory"`
-	RandomSongs SubsonicSongs     `json:"randomSongs"`
-	Starred     SubsonicStarred   `json:"starred"`
-	Playlists   SubsonicPlaylists `json:"playlists"`
-	Playlist    SubsonicPlaylist  `json:"playlist"`
-	Error       SubsonicError     `json:"error"`
+	Status        string               `json:"status"`
+	Version       string               `json:"version"`
+	Indexes       SubsonicIndexes      `json:"indexes"`
+	Directory     SubsonicDirectory    `json:"directory"`
+	RandomSongs   SubsonicSongs        `json:"randomSongs"`
+	Starred       SubsonicStarred      `json:"starred"`
+	Playlists     SubsonicPlaylists    `json:"playlists"`
+	Playlist      SubsonicPlaylist     `json:"playlist"`
+	MusicFolders  SubsonicMusicFolders `json:"musicFolders"`
+	AlbumList     SubsonicAlbumList    `json:"albumList"`
+	SearchResult2 SubsonicSearchResult `json:"searchResult2"`
+	NowPlaying    SubsonicNowPlaying   `json:"nowPlaying"`
+	ScanStatus    SubsonicScanStatus   `json:"scanStatus"`
+	// jukeboxControl returns jukeboxPlaylist for "get", jukeboxStatus otherwise
+	JukeboxStatus   SubsonicJukeboxStatus `json:"jukeboxStatus"`
+	JukeboxPlaylist SubsonicJukeboxStatus `json:"jukeboxPlaylist"`
+	Error           SubsonicError         `json:"error"`
 }
 
 type responseWrapper struct {
@@ -212,8 +316,24 @@ func (connection *SubsonicConnection) GetServerInfo() (*SubsonicResponse, error)
 	return connection.getResponse("GetServerInfo", requestUrl)
 }
 
+func (connection *SubsonicConnection) GetMusicFolders() (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	requestUrl := connection.Host + "/rest/getMusicFolders" + "?" + query.Encode()
+	return connection.getResponse("GetMusicFolders", requestUrl)
+}
+
 func (connection *SubsonicConnection) GetIndexes() (*SubsonicResponse, error) {
+	return connection.GetIndexesOf(connection.MusicFolderId)
+}
+
+// GetIndexesOf returns the artists of the music folder musicFolderId, of all
+// folders if it's empty. MusicFolderId isn't read, so it may be called from
+// another goroutine than the one selecting the folder.
+func (connection *SubsonicConnection) GetIndexesOf(musicFolderId string) (*SubsonicResponse, error) {
 	query := defaultQuery(connection)
+	if musicFolderId != "" {
+		query.Set("musicFolderId", musicFolderId)
+	}
 	requestUrl := connection.Host + "/rest/getIndexes" + "?" + query.Encode()
 	return connection.getResponse("GetIndexes", requestUrl)
 }
@@ -243,6 +363,7 @@ func (connection *SubsonicConnection) GetRandomSongs() (*SubsonicResponse, error
 	query := defaultQuery(connection)
 	// Let's get 50 random songs, default is 10
 	query.Set("size", "50")
+	setMusicFolder(connection, query)
 	requestUrl := connection.Host + "/rest/getRandomSongs" + "?" + query.Encode()
 	resp, err := connection.getResponse("GetRandomSongs", requestUrl)
 	if err != nil {
@@ -251,6 +372,29 @@ func (connection *SubsonicConnection) GetRandomSongs() (*SubsonicResponse, error
 	return resp, nil
 }
 
+// GetAlbumList returns a list of albums, listType is one of the types of the
+// getAlbumList endpoint, e.g. "newest", "recent", "frequent" or "random".
+func (connection *SubsonicConnection) GetAlbumList(listType string, size int, offset int) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("type", listType)
+	query.Set("size", strconv.Itoa(size))
+	query.Set("offset", strconv.Itoa(offset))
+	setMusicFolder(connection, query)
+	requestUrl := connection.Host + "/rest/getAlbumList" + "?" + query.Encode()
+	return connection.getResponse("GetAlbumList", requestUrl)
+}
+
+func (connection *SubsonicConnection) Search(searchTerm string, artistCount int, albumCount int, songCount int) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("query", searchTerm)
+	query.Set("artistCount", strconv.Itoa(artistCount))
+	query.Set("albumCount", strconv.Itoa(albumCount))
+	query.Set("songCount", strconv.Itoa(songCount))
+	setMusicFolder(connection, query)
+	requestUrl := connection.Host + "/rest/search2" + "?" + query.Encode()
+	return connection.getResponse("Search", requestUrl)
+}
+
 func (connection *SubsonicConnection) ScrobbleSubmission(id string, isSubmission bool) (resp *SubsonicResponse, err error) {
 	query := defaultQuery(connection)
 	query.Set("id", id)
@@ -263,6 +407,18 @@ func (connection *SubsonicConnection) ScrobbleSubmission(id string, isSubmission
 	return
 }
 
+// ScrobbleSubmissionAt submits a scrobble for a song that started playing at
+// playedAt, e.g. when submitting scrobbles that were made offline
+func (connection *SubsonicConnection) ScrobbleSubmissionAt(id string, playedAt time.Time) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("id", id)
+	query.Set("submission", "true")
+	query.Set("time", strconv.FormatInt(playedAt.UnixMilli(), 10))
+
+	requestUrl := connection.Host + "/rest/scrobble" + "?" + query.Encode()
+	return connection.getResponse("ScrobbleSubmissionAt", requestUrl)
+}
+
 func (connection *SubsonicConnection) GetStarred() (*SubsonicResponse, error) {
 	query := defaultQuery(connection)
 	requestUrl := connection.Host + "/rest/getStarred" + "?" + query.Encode()
@@ -273,6 +429,25 @@ func (connection *SubsonicConnection) GetStarred() (*SubsonicResponse, error) {
 	return resp, nil
 }
 
+func (connection *SubsonicConnection) GetNowPlaying() (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	requestUrl := connection.Host + "/rest/getNowPlaying" + "?" + query.Encode()
+	return connection.getResponse("GetNowPlaying", requestUrl)
+}
+
+// StartScan initiates a rescan of the media libraries
+func (connection *SubsonicConnection) StartScan() (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	requestUrl := connection.Host + "/rest/startScan" + "?" + query.Encode()
+	return connection.getResponse("StartScan", requestUrl)
+}
+
+func (connection *SubsonicConnection) GetScanStatus() (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	requestUrl := connection.Host + "/rest/getScanStatus" + "?" + query.Encode()
+	return connection.getResponse("GetScanStatus", requestUrl)
+}
+
 func (connection *SubsonicConnection) ToggleStar(id string, starredItems map[string]struct{}) (*SubsonicResponse, error) {
 	query := defaultQuery(connection)
 	query.Set("id", id)
@@ -339,6 +514,80 @@ func (connection *SubsonicConnection) CreatePlaylist(name string) (*SubsonicResp
 	return connection.getResponse("GetPlaylist", requestUrl)
 }
 
+// jukebox control, the server plays the songs on its own audio device
+func (connection *SubsonicConnection) jukeboxControl(action string, query url.Values) (*SubsonicResponse, error) {
+	query.Set("action", action)
+	requestUrl := connection.Host + "/rest/jukeboxControl" + "?" + query.Encode()
+	resp, err := connection.getResponse("JukeboxControl", requestUrl)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Status != "ok" {
+		return resp, errors.New(resp.Error.Message)
+	}
+	return resp, nil
+}
+
+// JukeboxGet returns the jukebox playlist including its status
+func (connection *SubsonicConnection) JukeboxGet() (*SubsonicResponse, error) {
+	return connection.jukeboxControl("get", defaultQuery(connection))
+}
+
+func (connection *SubsonicConnection) JukeboxStatus() (*SubsonicResponse, error) {
+	return connection.jukeboxControl("status", defaultQuery(connection))
+}
+
+// JukeboxSet replaces the jukebox playlist with the given songs
+func (connection *SubsonicConnection) JukeboxSet(ids []string) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	for _, id := range ids {
+		query.Add("id", id)
+	}
+	return connection.jukeboxControl("set", query)
+}
+
+func (connection *SubsonicConnection) JukeboxStart() (*SubsonicResponse, error) {
+	return connection.jukeboxControl("start", defaultQuery(connection))
+}
+
+// JukeboxStop pauses the jukebox, it keeps its position
+func (connection *SubsonicConnection) JukeboxStop() (*SubsonicResponse, error) {
+	return connection.jukeboxControl("stop", defaultQuery(connection))
+}
+
+// JukeboxSkip starts playing the song at index, offset seconds into the song
+func (connection *SubsonicConnection) JukeboxSkip(index int, offset int) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("index", strconv.Itoa(index))
+	query.Set("offset", strconv.Itoa(offset))
+	return connection.jukeboxControl("skip", query)
+}
+
+func (connection *SubsonicConnection) JukeboxAdd(ids []string) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	for _, id := range ids {
+		query.Add("id", id)
+	}
+	return connection.jukeboxControl("add", query)
+}
+
+func (connection *SubsonicConnection) JukeboxClear() (*SubsonicResponse, error) {
+	return connection.jukeboxControl("clear", defaultQuery(connection))
+}
+
+func (connection *SubsonicConnection) JukeboxRemove(index int) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("index", strconv.Itoa(index))
+	return connection.jukeboxControl("remove", query)
+}
+
+// JukeboxSetGain sets the jukebox volume, gain is between 0.0 and 1.0
+func (connection *SubsonicConnection) JukeboxSetGain(gain float64) (*SubsonicResponse, error) {
+	query := defaultQuery(connection)
+	query.Set("gain", strconv.FormatFloat(gain, 'f', 2, 64))
+	return connection.jukeboxControl("setGain", query)
+}
+
 func (connection *SubsonicConnection) getResponse(caller, requestUrl string) (*SubsonicResponse, error) {
 	res, err := http.Get(requestUrl)
 
@@ -350,9 +599,9 @@ func (connection *SubsonicConnection) getResponse(caller, requestUrl string) (*S
 		defer res.Body.Close()
 	}
 
-	responseBody, readErr := io.ReadAll(res.Body)
+	responseBody, err := io.ReadAll(res.Body)
 
-	if readErr != nil {
+	if err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,650 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package subsonic_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spezifisch/stmps/subsonic/subsonictest"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Print(s string) {
+	l.t.Log(s)
+}
+
+func (l testLogger) Printf(s string, as ...interface{}) {
+	l.t.Logf(s, as...)
+}
+
+func (l testLogger) PrintError(source string, err error) {
+	l.t.Logf("Error(%s) -> %s", source, err)
+}
+
+func newTestServer(t *testing.T) (*subsonictest.Server, *subsonic.SubsonicConnection) {
+	t.Helper()
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	t.Cleanup(server.Close)
+	return server, server.Connection(testLogger{t})
+}
+
+// checkOk fails the test if the request failed in any way
+func checkOk(t *testing.T, resp *subsonic.SubsonicResponse, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp == nil {
+		t.Fatal("response is nil")
+	}
+	if resp.Status != "ok" {
+		t.Fatalf("status %q, error %d %q", resp.Status, resp.Error.Code, resp.Error.Message)
+	}
+}
+
+func lastRequest(t *testing.T, server *subsonictest.Server, endpoint string) url.Values {
+	t.Helper()
+	requests := server.Requests(endpoint)
+	if len(requests) == 0 {
+		t.Fatalf("no request to %s", endpoint)
+	}
+	return requests[len(requests)-1]
+}
+
+func TestTokenAuth(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetServerInfo()
+	checkOk(t, resp, err)
+
+	query := lastRequest(t, server, "ping")
+	if query.Get("t") == "" || query.Get("s") == "" || query.Has("p") {
+		t.Errorf("expected token auth, got %v", query)
+	}
+	if query.Get("c") != "example" || query.Get("f") != "json" {
+		t.Errorf("unexpected client parameters %v", query)
+	}
+}
+
+func TestPlaintextAuth(t *testing.T) {
+	server, connection := newTestServer(t)
+	connection.PlaintextAuth = true
+	connection.SetClientInfo("stmps-test", "1.2.3")
+
+	resp, err := connection.GetServerInfo()
+	checkOk(t, resp, err)
+
+	query := lastRequest(t, server, "ping")
+	if query.Get("p") != subsonictest.DefaultPassword || query.Has("t") {
+		t.Errorf("expected plaintext auth, got %v", query)
+	}
+	if query.Get("c") != "stmps-test" || query.Get("v") != "1.2.3" {
+		t.Errorf("unexpected client parameters %v", query)
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	_, connection := newTestServer(t)
+	connection.Password = "wrong"
+
+	resp, err := connection.GetServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "failed" || resp.Error.Code != subsonictest.ErrorWrongAuth {
+		t.Errorf("expected auth failure, got %q %v", resp.Status, resp.Error)
+	}
+}
+
+func TestInjectedErrors(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	server.SetError("getIndexes", subsonictest.ErrorGeneric, "boom")
+	resp, err := connection.GetIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "failed" || resp.Error.Message != "boom" {
+		t.Errorf("expected injected error, got %q %v", resp.Status, resp.Error)
+	}
+
+	server.SetHTTPError("getIndexes", http.StatusServiceUnavailable)
+	if _, err = connection.GetIndexes(); err == nil {
+		t.Error("expected error for HTTP 503")
+	}
+
+	server.ClearErrors()
+	resp, err = connection.GetIndexes()
+	checkOk(t, resp, err)
+}
+
+func TestLatency(t *testing.T) {
+	server, connection := newTestServer(t)
+	server.SetLatency(50 * time.Millisecond)
+
+	start := time.Now()
+	resp, err := connection.GetServerInfo()
+	checkOk(t, resp, err)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("response came too fast: %v", elapsed)
+	}
+}
+
+func TestGetMusicFolders(t *testing.T) {
+	_, connection := newTestServer(t)
+
+	resp, err := connection.GetMusicFolders()
+	checkOk(t, resp, err)
+
+	folders := resp.MusicFolders.Folders
+	if len(folders) != 2 || folders[0].Id != "1" || folders[1].Name != "Audiobooks" {
+		t.Errorf("unexpected folders %+v", folders)
+	}
+}
+
+func TestGetIndexes(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetIndexes()
+	checkOk(t, resp, err)
+	if count := countArtists(resp); count != 4 {
+		t.Errorf("expected 4 artists, got %d", count)
+	}
+	if lastRequest(t, server, "getIndexes").Has("musicFolderId") {
+		t.Error("musicFolderId sent without folder selection")
+	}
+
+	connection.MusicFolderId = "2"
+	resp, err = connection.GetIndexes()
+	checkOk(t, resp, err)
+	if count := countArtists(resp); count != 1 {
+		t.Errorf("expected 1 artist in folder 2, got %d", count)
+	}
+	if folder := lastRequest(t, server, "getIndexes").Get("musicFolderId"); folder != "2" {
+		t.Errorf("musicFolderId %q", folder)
+	}
+
+	// an explicit folder, the selected one is ignored
+	resp, err = connection.GetIndexesOf("")
+	checkOk(t, resp, err)
+	if count := countArtists(resp); count != 4 {
+		t.Errorf("expected 4 artists in all folders, got %d", count)
+	}
+	if lastRequest(t, server, "getIndexes").Has("musicFolderId") {
+		t.Error("musicFolderId sent for all folders")
+	}
+}
+
+func countArtists(resp *subsonic.SubsonicResponse) (count int) {
+	for _, index := range resp.Indexes.Index {
+		count += len(index.Artists)
+	}
+	return
+}
+
+func TestGetMusicDirectory(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetMusicDirectory("ar-1-1")
+	checkOk(t, resp, err)
+	if resp.Directory.Name != "Aurora Lane" || len(resp.Directory.Entities) != 2 {
+		t.Errorf("unexpected artist directory %+v", resp.Directory)
+	}
+	if !resp.Directory.Entities[0].IsDirectory {
+		t.Error("album is not a directory")
+	}
+
+	resp, err = connection.GetMusicDirectory("ar-1-1-al-1")
+	checkOk(t, resp, err)
+	if resp.Directory.Parent != "ar-1-1" || len(resp.Directory.Entities) != 4 {
+		t.Errorf("unexpected album directory %+v", resp.Directory)
+	}
+	song := resp.Directory.Entities[0]
+	if song.Album != "Northern Lights" || song.Year != 2019 || song.Genre != "Ambient" ||
+		song.Suffix != "wav" || song.BitRate != 64 || song.ArtistId != "ar-1-1" {
+		t.Errorf("incomplete song metadata %+v", song)
+	}
+
+	// second request is served from cache
+	requests := len(server.Requests("getMusicDirectory"))
+	resp, err = connection.GetMusicDirectory("ar-1-1-al-1")
+	checkOk(t, resp, err)
+	if len(server.Requests("getMusicDirectory")) != requests {
+		t.Error("cached directory was requested again")
+	}
+
+	connection.RemoveCacheEntry("ar-1-1-al-1")
+	_, _ = connection.GetMusicDirectory("ar-1-1-al-1")
+	connection.ClearCache()
+	_, _ = connection.GetMusicDirectory("ar-1-1-al-1")
+	if len(server.Requests("getMusicDirectory")) != requests+2 {
+		t.Error("cache entry wasn't removed")
+	}
+
+	// failed requests aren't cached
+	resp, err = connection.GetMusicDirectory("nonexistent")
+	if err != nil || resp.Status != "failed" || resp.Error.Code != subsonictest.ErrorNotFound {
+		t.Errorf("expected not found, got %v %v", err, resp)
+	}
+}
+
+// a song as sent by an OpenSubsonic server
+const openSubsonicSong = `{"subsonic-response": {"status": "ok", "version": "1.16.1", "openSubsonic": true,
+	"directory": {"id": "al-1", "name": "Album", "child": [{
+		"id": "tr-1", "parent": "al-1", "isDir": false, "title": "Song", "album": "Album",
+		"artist": "Artist", "track": 3, "year": 2001, "genre": "Rock", "coverArt": "al-1_0",
+		"size": 9876543, "contentType": "audio/flac", "suffix": "flac", "starred": "2023-01-02T03:04:05Z",
+		"duration": 245, "bitRate": 1024, "path": "Artist/Album/03 Song.flac", "userRating": 4,
+		"playCount": 17, "discNumber": 2, "created": "2022-12-01T10:00:00Z", "albumId": "al-1",
+		"artistId": "ar-1", "type": "music", "bpm": 120, "comment": "a comment", "sortName": "song",
+		"musicBrainzId": "189002e7-3285-4e2e-92a3-7f6c30d407a2",
+		"replayGain": {"trackGain": -6.5, "albumGain": -7.25, "trackPeak": 0.98, "albumPeak": 1.0,
+			"baseGain": 1, "fallbackGain": -5}
+	}]}}}`
+
+func TestEntityMetadata(t *testing.T) {
+	var response struct {
+		Response subsonic.SubsonicResponse `json:"subsonic-response"`
+	}
+	if err := json.Unmarshal([]byte(openSubsonicSong), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	got := response.Response.Directory.Entities[0]
+	expected := subsonic.SubsonicEntity{
+		Id:          "tr-1",
+		Parent:      "al-1",
+		Title:       "Song",
+		Album:       "Album",
+		Artist:      "Artist",
+		AlbumId:     "al-1",
+		ArtistId:    "ar-1",
+		Duration:    245,
+		Track:       3,
+		DiskNumber:  2,
+		Year:        2001,
+		Genre:       "Rock",
+		CoverArtId:  "al-1_0",
+		Path:        "Artist/Album/03 Song.flac",
+		Size:        9876543,
+		Suffix:      "flac",
+		ContentType: "audio/flac",
+		Type:        "music",
+		BitRate:     1024,
+		Starred:     "2023-01-02T03:04:05Z",
+		UserRating:  4,
+		PlayCount:   17,
+		Created:     "2022-12-01T10:00:00Z",
+		ReplayGain: subsonic.SubsonicReplayGain{
+			TrackGain:    -6.5,
+			AlbumGain:    -7.25,
+			TrackPeak:    0.98,
+			AlbumPeak:    1,
+			BaseGain:     1,
+			FallbackGain: -5,
+		},
+		MusicBrainzId: "189002e7-3285-4e2e-92a3-7f6c30d407a2",
+		Bpm:           120,
+		Comment:       "a comment",
+		SortName:      "song",
+	}
+	if got != expected {
+		t.Errorf("decoded\n%+v\nexpected\n%+v", got, expected)
+	}
+}
+
+func TestGetRandomSongs(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetRandomSongs()
+	checkOk(t, resp, err)
+	if len(resp.RandomSongs.Song) != 18 {
+		t.Errorf("expected all 18 songs, got %d", len(resp.RandomSongs.Song))
+	}
+	if size := lastRequest(t, server, "getRandomSongs").Get("size"); size != "50" {
+		t.Errorf("size %q", size)
+	}
+
+	connection.MusicFolderId = "2"
+	resp, err = connection.GetRandomSongs()
+	checkOk(t, resp, err)
+	if len(resp.RandomSongs.Song) != 3 {
+		t.Errorf("expected 3 songs in folder 2, got %d", len(resp.RandomSongs.Song))
+	}
+}
+
+func TestGetAlbumList(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetAlbumList("alphabeticalByName", 2, 1)
+	checkOk(t, resp, err)
+	albums := resp.AlbumList.Album
+	if len(albums) != 2 || albums[0].Title != "Northern Lights" || albums[1].Title != "Short Stories" {
+		t.Errorf("unexpected albums %+v", albums)
+	}
+
+	connection.MusicFolderId = "1"
+	resp, err = connection.GetAlbumList("random", 10, 0)
+	checkOk(t, resp, err)
+	if len(resp.AlbumList.Album) != 4 {
+		t.Errorf("expected 4 albums in folder 1, got %d", len(resp.AlbumList.Album))
+	}
+	if folder := lastRequest(t, server, "getAlbumList").Get("musicFolderId"); folder != "1" {
+		t.Errorf("musicFolderId %q", folder)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.Search("chapter", 5, 5, 2)
+	checkOk(t, resp, err)
+	if len(resp.SearchResult2.Song) != 2 {
+		t.Errorf("expected 2 songs, got %+v", resp.SearchResult2.Song)
+	}
+
+	resp, err = connection.Search("static", 5, 5, 5)
+	checkOk(t, resp, err)
+	if len(resp.SearchResult2.Artist) != 1 || resp.SearchResult2.Artist[0].Name != "Blue Static" {
+		t.Errorf("unexpected artists %+v", resp.SearchResult2.Artist)
+	}
+
+	connection.MusicFolderId = "1"
+	resp, err = connection.Search("chapter", 5, 5, 5)
+	checkOk(t, resp, err)
+	if len(resp.SearchResult2.Song) != 0 {
+		t.Errorf("expected no songs in folder 1, got %+v", resp.SearchResult2.Song)
+	}
+	if folder := lastRequest(t, server, "search2").Get("musicFolderId"); folder != "1" {
+		t.Errorf("musicFolderId %q", folder)
+	}
+}
+
+func TestScrobbleSubmission(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.ScrobbleSubmission("tr-1", false)
+	checkOk(t, resp, err)
+	resp, err = connection.ScrobbleSubmission("tr-1", true)
+	checkOk(t, resp, err)
+
+	scrobbles := server.Scrobbles()
+	if len(scrobbles) != 2 || scrobbles[0].Submission || !scrobbles[1].Submission {
+		t.Errorf("unexpected scrobbles %+v", scrobbles)
+	}
+}
+
+func TestScrobbleSubmissionAt(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	playedAt := time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC)
+	resp, err := connection.ScrobbleSubmissionAt("tr-3", playedAt)
+	checkOk(t, resp, err)
+
+	scrobbles := server.Scrobbles()
+	if len(scrobbles) != 1 || !scrobbles[0].Submission || scrobbles[0].Time != playedAt.UnixMilli() {
+		t.Errorf("unexpected scrobbles %+v", scrobbles)
+	}
+}
+
+func TestStars(t *testing.T) {
+	server, connection := newTestServer(t)
+	starred := map[string]struct{}{}
+
+	resp, err := connection.ToggleStar("tr-2", starred)
+	checkOk(t, resp, err)
+	resp, err = connection.ToggleStar("ar-1-1-al-2", starred)
+	checkOk(t, resp, err)
+	if !server.IsStarred("tr-2") || !server.IsStarred("ar-1-1-al-2") {
+		t.Fatal("items weren't starred")
+	}
+
+	resp, err = connection.GetStarred()
+	checkOk(t, resp, err)
+	if len(resp.Starred.Song) != 1 || resp.Starred.Song[0].Id != "tr-2" {
+		t.Errorf("unexpected starred songs %+v", resp.Starred.Song)
+	} else if _, err := time.Parse(time.RFC3339, resp.Starred.Song[0].Starred); err != nil {
+		t.Errorf("invalid starred timestamp: %v", err)
+	}
+	if len(resp.Starred.Album) != 1 || resp.Starred.Album[0].Id != "ar-1-1-al-2" {
+		t.Errorf("unexpected starred albums %+v", resp.Starred.Album)
+	}
+
+	// the caller keeps track of the starred items
+	starred["tr-2"] = struct{}{}
+	resp, err = connection.ToggleStar("tr-2", starred)
+	checkOk(t, resp, err)
+	if server.IsStarred("tr-2") {
+		t.Error("song wasn't unstarred")
+	}
+}
+
+func TestToggleStarError(t *testing.T) {
+	server, connection := newTestServer(t)
+	server.SetHTTPError("star", http.StatusInternalServerError)
+
+	starred := map[string]struct{}{}
+	if _, err := connection.ToggleStar("tr-2", starred); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestGetNowPlaying(t *testing.T) {
+	server, connection := newTestServer(t)
+	server.SetNowPlaying([]subsonic.SubsonicNowPlayingEntry{{
+		SubsonicEntity: subsonic.SubsonicEntity{Id: "tr-3", Title: "Midnight Sun", Artist: "Aurora Lane"},
+		Username:       "alice",
+		MinutesAgo:     2,
+		PlayerId:       "7",
+		PlayerName:     "kitchen",
+	}})
+
+	resp, err := connection.GetNowPlaying()
+	checkOk(t, resp, err)
+
+	entries := resp.NowPlaying.Entries
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Id != "tr-3" || entries[0].Username != "alice" || entries[0].MinutesAgo != 2 ||
+		entries[0].PlayerId != "7" || entries[0].PlayerName != "kitchen" {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+}
+
+func TestScan(t *testing.T) {
+	server, connection := newTestServer(t)
+	server.SetScanSteps(2)
+
+	resp, err := connection.GetScanStatus()
+	checkOk(t, resp, err)
+	if resp.ScanStatus.Scanning {
+		t.Error("scanning before scan was started")
+	}
+
+	resp, err = connection.StartScan()
+	checkOk(t, resp, err)
+	if !resp.ScanStatus.Scanning {
+		t.Error("scan not started")
+	}
+
+	resp, err = connection.GetScanStatus()
+	checkOk(t, resp, err)
+	if !resp.ScanStatus.Scanning || resp.ScanStatus.Count != 9 {
+		t.Errorf("unexpected scan status %+v", resp.ScanStatus)
+	}
+
+	resp, err = connection.GetScanStatus()
+	checkOk(t, resp, err)
+	if resp.ScanStatus.Scanning || resp.ScanStatus.Count != 18 {
+		t.Errorf("unexpected scan status %+v", resp.ScanStatus)
+	}
+}
+
+func TestPlaylists(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.GetPlaylists()
+	checkOk(t, resp, err)
+	playlists := resp.Playlists.Playlists
+	if len(playlists) != 2 {
+		t.Fatalf("expected 2 playlists, got %d", len(playlists))
+	}
+	// entries of non-empty playlists are fetched as well
+	if playlists[0].Entries.Len() != 3 || playlists[1].Entries.Len() != 0 {
+		t.Errorf("unexpected entries %+v", playlists)
+	}
+	if requests := len(server.Requests("getPlaylist")); requests != 1 {
+		t.Errorf("expected 1 getPlaylist request, got %d", requests)
+	}
+
+	resp, err = connection.GetPlaylist("pl-1")
+	checkOk(t, resp, err)
+	if resp.Playlist.Name != "Favourites" || resp.Playlist.Entries[0].Id != "tr-1" {
+		t.Errorf("unexpected playlist %+v", resp.Playlist)
+	}
+
+	resp, err = connection.CreatePlaylist("new one")
+	checkOk(t, resp, err)
+	id := string(resp.Playlist.Id)
+	if id == "" || resp.Playlist.Name != "new one" {
+		t.Fatalf("unexpected playlist %+v", resp.Playlist)
+	}
+
+	if err = connection.AddSongToPlaylist(id, "tr-4"); err != nil {
+		t.Fatal(err)
+	}
+	if err = connection.AddSongToPlaylist(id, "tr-5"); err != nil {
+		t.Fatal(err)
+	}
+	if err = connection.RemoveSongFromPlaylist(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	playlist, ok := server.Playlist(id)
+	if !ok || len(playlist.Entries) != 1 || playlist.Entries[0].Id != "tr-5" {
+		t.Errorf("unexpected playlist %+v", playlist)
+	}
+
+	if err = connection.DeletePlaylist(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = server.Playlist(id); ok {
+		t.Error("playlist wasn't deleted")
+	}
+}
+
+func TestGetPlaylistsError(t *testing.T) {
+	server, connection := newTestServer(t)
+	server.SetHTTPError("getPlaylist", http.StatusInternalServerError)
+
+	if _, err := connection.GetPlaylists(); err == nil {
+		t.Error("expected error when fetching playlist entries fails")
+	}
+}
+
+func TestGetPlayUrl(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	if uri := connection.GetPlayUrl(&subsonic.SubsonicEntity{Id: "ar-1-1-al-1", IsDirectory: true}); uri != "" {
+		t.Errorf("directory has play url %q", uri)
+	}
+
+	uri := connection.GetPlayUrl(&subsonic.SubsonicEntity{Id: "tr-1"})
+	res, err := http.Get(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "audio/wav" {
+		t.Errorf("unexpected stream response %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	if id := lastRequest(t, server, "stream").Get("id"); id != "tr-1" {
+		t.Errorf("stream id %q", id)
+	}
+}
+
+func TestJukebox(t *testing.T) {
+	server, connection := newTestServer(t)
+
+	resp, err := connection.JukeboxSet([]string{"tr-1", "tr-2"})
+	checkOk(t, resp, err)
+	resp, err = connection.JukeboxAdd([]string{"tr-3"})
+	checkOk(t, resp, err)
+	resp, err = connection.JukeboxStart()
+	checkOk(t, resp, err)
+	if !resp.JukeboxStatus.Playing || resp.JukeboxStatus.CurrentIndex != 0 {
+		t.Errorf("unexpected status %+v", resp.JukeboxStatus)
+	}
+
+	resp, err = connection.JukeboxSkip(1, 30)
+	checkOk(t, resp, err)
+	if resp.JukeboxStatus.CurrentIndex != 1 || resp.JukeboxStatus.Position != 30 {
+		t.Errorf("unexpected status %+v", resp.JukeboxStatus)
+	}
+
+	resp, err = connection.JukeboxRemove(0)
+	checkOk(t, resp, err)
+	resp, err = connection.JukeboxSetGain(0.25)
+	checkOk(t, resp, err)
+	resp, err = connection.JukeboxStop()
+	checkOk(t, resp, err)
+
+	resp, err = connection.JukeboxStatus()
+	checkOk(t, resp, err)
+	if resp.JukeboxStatus.Playing || resp.JukeboxStatus.Gain != 0.25 || resp.JukeboxStatus.CurrentIndex != 0 {
+		t.Errorf("unexpected status %+v", resp.JukeboxStatus)
+	}
+
+	resp, err = connection.JukeboxGet()
+	checkOk(t, resp, err)
+	entries := resp.JukeboxPlaylist.Entries
+	if len(entries) != 2 || entries[0].Id != "tr-2" || entries[1].Id != "tr-3" {
+		t.Errorf("unexpected jukebox playlist %+v", entries)
+	}
+
+	resp, err = connection.JukeboxClear()
+	checkOk(t, resp, err)
+	if len(server.Jukebox().Entries) != 0 {
+		t.Error("jukebox wasn't cleared")
+	}
+
+	// errors reported by the server are returned as error
+	if _, err = connection.JukeboxSkip(5, 0); err == nil {
+		t.Error("expected error for invalid index")
+	}
+	server.SetError("jukeboxControl", subsonictest.ErrorNotAuthorized, "not allowed")
+	if _, err = connection.JukeboxStatus(); err == nil || err.Error() != "not allowed" {
+		t.Errorf("expected authorization error, got %v", err)
+	}
+}
+
+func ExampleSubsonicConnection_GetIndexes() {
+	server := subsonictest.NewServer(subsonictest.DemoLibrary())
+	defer server.Close()
+
+	connection := server.Connection(nil)
+	resp, err := connection.GetIndexes()
+	if err != nil {
+		panic(err)
+	}
+	for _, index := range resp.Indexes.Index {
+		for _, artist := range index.Artists {
+			fmt.Printf("%s: %s\n", index.Name, artist.Name)
+		}
+	}
+	// Output:
+	// A: Aurora Lane
+	// B: Blue Static
+	// D: Dana Reads
+	// T: The Copper Kettles
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package subsonictest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// low quality is good enough for a demo and keeps the streams small
+const sampleRate = 8000
+
+const wavHeaderSize = 44
+
+// stream serves a generated tone with the duration of the requested song
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, query url.Values) {
+	_, _, song := s.library.find(query.Get("id"))
+	if song == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// a different pitch per track number
+	frequency := 220 * math.Pow(2, float64(song.Track%12)/12)
+	wav := toneWav(frequency, song.Duration)
+
+	w.Header().Set("Content-Type", "audio/wav")
+	http.ServeContent(w, r, "stream.wav", time.Time{}, bytes.NewReader(wav))
+}
+
+// toneWav returns a mono 8-bit PCM wav file with a quiet sine tone
+func toneWav(frequency float64, seconds int) []byte {
+	samples := sampleRate * seconds
+	buf := bytes.NewBuffer(make([]byte, 0, wavHeaderSize+samples))
+
+	// RIFF header
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(wavHeaderSize-8+samples))
+	buf.WriteString("WAVE")
+
+	// format chunk
+	buf.WriteString("fmt ")
+	_ = binary.Write(buf, binary.LittleEndian, []interface{}{
+		uint32(16),         // chunk size
+		uint16(1),          // PCM
+		uint16(1),          // channels
+		uint32(sampleRate), // sample rate
+		uint32(sampleRate), // byte rate
+		uint16(1),          // block align
+		uint16(8),          // bits per sample
+	})
+
+	// data chunk
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(samples))
+	for i := 0; i < samples; i++ {
+		value := math.Sin(2 * math.Pi * frequency * float64(i) / sampleRate)
+		buf.WriteByte(byte(128 + 24*value))
+	}
+
+	return buf.Bytes()
+}
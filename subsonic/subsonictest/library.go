@@ -0,0 +1,212 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package subsonictest
+
+import (
+	"fmt"
+
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// Library is the in-memory music library served by the fake server.
+// Ids must be unique across folders, artists, albums and songs.
+type Library struct {
+	Folders   []Folder
+	Playlists []subsonic.SubsonicPlaylist
+}
+
+type Folder struct {
+	Id      string
+	Name    string
+	Artists []Artist
+}
+
+type Artist struct {
+	Id     string
+	Name   string
+	Albums []Album
+}
+
+type Album struct {
+	Id    string
+	Title string
+	Year  int
+	Genre string
+	Songs []subsonic.SubsonicEntity
+}
+
+// artistEntity is an artist as shown in starred lists
+type artistEntity struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// songs returns all songs of the library, optionally restricted to one folder
+func (l *Library) songs(folderId string) (songs subsonic.SubsonicEntities) {
+	for _, folder := range l.Folders {
+		if folderId != "" && folder.Id != folderId {
+			continue
+		}
+		for _, artist := range folder.Artists {
+			for _, album := range artist.Albums {
+				songs = append(songs, album.Songs...)
+			}
+		}
+	}
+	return
+}
+
+// albums returns directory entities for all albums, optionally restricted to one folder
+func (l *Library) albums(folderId string) (albums subsonic.SubsonicEntities) {
+	for _, folder := range l.Folders {
+		if folderId != "" && folder.Id != folderId {
+			continue
+		}
+		for _, artist := range folder.Artists {
+			for _, album := range artist.Albums {
+				albums = append(albums, albumEntity(&artist, &album))
+			}
+		}
+	}
+	return
+}
+
+func (l *Library) artists(folderId string) (artists []Artist) {
+	for _, folder := range l.Folders {
+		if folderId != "" && folder.Id != folderId {
+			continue
+		}
+		artists = append(artists, folder.Artists...)
+	}
+	return
+}
+
+// find looks up a song, album or artist by id
+func (l *Library) find(id string) (artist *Artist, album *Album, song *subsonic.SubsonicEntity) {
+	for fi := range l.Folders {
+		for ai := range l.Folders[fi].Artists {
+			artist = &l.Folders[fi].Artists[ai]
+			if artist.Id == id {
+				return artist, nil, nil
+			}
+			for bi := range artist.Albums {
+				album = &artist.Albums[bi]
+				if album.Id == id {
+					return artist, album, nil
+				}
+				for si := range album.Songs {
+					if album.Songs[si].Id == id {
+						return artist, album, &album.Songs[si]
+					}
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func albumEntity(artist *Artist, album *Album) subsonic.SubsonicEntity {
+	return subsonic.SubsonicEntity{
+		Id:          album.Id,
+		IsDirectory: true,
+		Parent:      artist.Id,
+		Title:       album.Title,
+		Album:       album.Title,
+		Artist:      artist.Name,
+		AlbumId:     album.Id,
+		ArtistId:    artist.Id,
+		Year:        album.Year,
+		Genre:       album.Genre,
+		CoverArtId:  album.Id,
+	}
+}
+
+// DemoLibrary returns a small library with two music folders.
+// Songs are short so that the generated streams stay small.
+func DemoLibrary() Library {
+	type albumSpec struct {
+		title string
+		year  int
+		songs []string
+	}
+	type artistSpec struct {
+		name   string
+		genre  string
+		albums []albumSpec
+	}
+	folders := []struct {
+		name    string
+		artists []artistSpec
+	}{
+		{"Music", []artistSpec{
+			{"Aurora Lane", "Ambient", []albumSpec{
+				{"Northern Lights", 2019, []string{"First Frost", "Polar Night", "Midnight Sun", "Thaw"}},
+				{"Harbour", 2021, []string{"Lighthouse", "Low Tide", "Fog Horn"}},
+			}},
+			{"Blue Static", "Electronic", []albumSpec{
+				{"Signal", 1998, []string{"Carrier Wave", "Interference", "Dial Tone", "Handshake", "Hang Up"}},
+			}},
+			{"The Copper Kettles", "Folk", []albumSpec{
+				{"Steam", 2005, []string{"Whistle", "Boil Over", "Tea Time"}},
+			}},
+		}},
+		{"Audiobooks", []artistSpec{
+			{"Dana Reads", "Audiobook", []albumSpec{
+				{"Short Stories", 2015, []string{"Chapter One", "Chapter Two", "Chapter Three"}},
+			}},
+		}},
+	}
+
+	library := Library{}
+	songCount := 0
+	for fi, f := range folders {
+		folder := Folder{Id: fmt.Sprint(fi + 1), Name: f.name}
+		for ai, a := range f.artists {
+			artist := Artist{Id: fmt.Sprintf("ar-%d-%d", fi+1, ai+1), Name: a.name}
+			for bi, b := range a.albums {
+				album := Album{
+					Id:    fmt.Sprintf("%s-al-%d", artist.Id, bi+1),
+					Title: b.title,
+					Year:  b.year,
+					Genre: a.genre,
+				}
+				for si, title := range b.songs {
+					songCount++
+					duration := 20 + (songCount*7)%40
+					album.Songs = append(album.Songs, subsonic.SubsonicEntity{
+						Id:          fmt.Sprintf("tr-%d", songCount),
+						Parent:      album.Id,
+						Title:       title,
+						Album:       album.Title,
+						Artist:      artist.Name,
+						AlbumId:     album.Id,
+						ArtistId:    artist.Id,
+						Duration:    duration,
+						Track:       si + 1,
+						DiskNumber:  1,
+						Year:        album.Year,
+						Genre:       album.Genre,
+						CoverArtId:  album.Id,
+						Path:        fmt.Sprintf("%s/%s/%02d %s.wav", artist.Name, album.Title, si+1, title),
+						Size:        int64(wavHeaderSize + duration*sampleRate),
+						Suffix:      "wav",
+						ContentType: "audio/wav",
+						BitRate:     sampleRate * 8 / 1000,
+						Created:     fmt.Sprintf("%d-06-01T12:00:00Z", album.Year),
+					})
+				}
+				artist.Albums = append(artist.Albums, album)
+			}
+			folder.Artists = append(folder.Artists, artist)
+		}
+		library.Folders = append(library.Folders, folder)
+	}
+
+	songs := library.songs("")
+	library.Playlists = []subsonic.SubsonicPlaylist{
+		{Id: "pl-1", Name: "Favourites", Entries: subsonic.SubsonicEntities{songs[0], songs[5], songs[9]}},
+		{Id: "pl-2", Name: "Empty"},
+	}
+	return library
+}
@@ -0,0 +1,763 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package subsonictest provides an in-process fake Subsonic server for tests
+// and offline development. It serves an in-memory library through the
+// endpoints used by the subsonic package and can inject errors and latency.
+package subsonictest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+const (
+	DefaultUsername = "demo"
+	DefaultPassword = "demo"
+
+	apiVersion = "1.16.1"
+
+	// subsonic error codes
+	ErrorGeneric       = 0
+	ErrorMissingParam  = 10
+	ErrorWrongAuth     = 40
+	ErrorNotAuthorized = 50
+	ErrorNotFound      = 70
+)
+
+// Scrobble is a scrobble request received by the server
+type Scrobble struct {
+	Id         string
+	Submission bool
+	// Time is the time parameter in milliseconds since the epoch, 0 if not set
+	Time int64
+}
+
+// Server is a fake Subsonic server, create it with NewServer and Close it after use
+type Server struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+
+	username string
+	password string
+
+	library   Library
+	starred   map[string]time.Time
+	scrobbles []Scrobble
+	requests  map[string][]url.Values
+
+	nowPlaying []subsonic.SubsonicNowPlayingEntry
+	scanning   bool
+	scanStep   int
+	scanCount  int
+	// number of getScanStatus calls until a scan finishes
+	scanSteps int
+
+	jukebox subsonic.SubsonicJukeboxStatus
+
+	// injected faults, by endpoint name
+	apiErrors    map[string]subsonic.SubsonicError
+	httpErrors   map[string]int
+	latency      time.Duration
+	nextPlaylist int
+}
+
+// NewServer starts a fake server serving the given library with the default
+// credentials
+func NewServer(library Library) *Server {
+	s := &Server{
+		username:     DefaultUsername,
+		password:     DefaultPassword,
+		library:      library,
+		starred:      make(map[string]time.Time),
+		requests:     make(map[string][]url.Values),
+		scanSteps:    3,
+		apiErrors:    make(map[string]subsonic.SubsonicError),
+		httpErrors:   make(map[string]int),
+		nextPlaylist: len(library.Playlists) + 1,
+	}
+	s.jukebox.CurrentIndex = -1
+	s.jukebox.Gain = 0.5
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Connection returns a client configured for this server
+func (s *Server) Connection(logger logger.LoggerInterface) *subsonic.SubsonicConnection {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	connection := subsonic.Init(logger)
+	connection.Host = s.URL
+	connection.Username = s.username
+	connection.Password = s.password
+	return connection
+}
+
+// SetCredentials changes the accepted username and password
+func (s *Server) SetCredentials(username, password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.username = username
+	s.password = password
+}
+
+// SetError makes the endpoint (e.g. "getIndexes") answer with a Subsonic error
+func (s *Server) SetError(endpoint string, code int, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apiErrors[endpoint] = subsonic.SubsonicError{Code: code, Message: message}
+}
+
+// SetHTTPError makes the endpoint answer with the given HTTP status code
+func (s *Server) SetHTTPError(endpoint string, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.httpErrors[endpoint] = status
+}
+
+// ClearErrors removes all injected errors
+func (s *Server) ClearErrors() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apiErrors = make(map[string]subsonic.SubsonicError)
+	s.httpErrors = make(map[string]int)
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latency = d
+}
+
+// SetScanSteps sets how many getScanStatus calls a scan takes to finish
+func (s *Server) SetScanSteps(steps int) {
+	if steps < 1 {
+		steps = 1
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scanSteps = steps
+}
+
+func (s *Server) SetNowPlaying(entries []subsonic.SubsonicNowPlayingEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nowPlaying = entries
+}
+
+// Scrobbles returns a copy of all received scrobbles in order
+func (s *Server) Scrobbles() []Scrobble {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Scrobble{}, s.scrobbles...)
+}
+
+// Requests returns the query parameters of all authenticated requests to endpoint
+func (s *Server) Requests(endpoint string) []url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]url.Values{}, s.requests[endpoint]...)
+}
+
+// IsStarred returns true if the id was starred
+func (s *Server) IsStarred(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.starred[id]
+	return ok
+}
+
+// Playlist returns a copy of the playlist with the given id
+func (s *Server) Playlist(id string) (subsonic.SubsonicPlaylist, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if index := s.findPlaylist(id); index >= 0 {
+		playlist := s.library.Playlists[index]
+		playlist.Entries = append(subsonic.SubsonicEntities{}, playlist.Entries...)
+		return playlist, true
+	}
+	return subsonic.SubsonicPlaylist{}, false
+}
+
+// Jukebox returns the jukebox state
+func (s *Server) Jukebox() subsonic.SubsonicJukeboxStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	jukebox := s.jukebox
+	jukebox.Entries = append(subsonic.SubsonicEntities{}, jukebox.Entries...)
+	return jukebox
+}
+
+type handlerFunc func(query url.Values) (key string, value interface{}, err *subsonic.SubsonicError)
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	latency := s.latency
+	s.mutex.Unlock()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	endpoint := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/rest/"), ".view")
+	query := r.URL.Query()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if status, ok := s.httpErrors[endpoint]; ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if err := s.checkAuth(query); err != nil {
+		s.writeResponse(w, "", nil, err)
+		return
+	}
+	s.requests[endpoint] = append(s.requests[endpoint], query)
+	if err, ok := s.apiErrors[endpoint]; ok {
+		s.writeResponse(w, "", nil, &err)
+		return
+	}
+
+	if endpoint == "stream" {
+		s.stream(w, r, query)
+		return
+	}
+
+	handlers := map[string]handlerFunc{
+		"ping":              s.ping,
+		"getMusicFolders":   s.getMusicFolders,
+		"getIndexes":        s.getIndexes,
+		"getMusicDirectory": s.getMusicDirectory,
+		"getRandomSongs":    s.getRandomSongs,
+		"getAlbumList":      s.getAlbumList,
+		"search2":           s.search2,
+		"scrobble":          s.scrobble,
+		"getStarred":        s.getStarred,
+		"star":              s.star,
+		"unstar":            s.unstar,
+		"getNowPlaying":     s.getNowPlaying,
+		"startScan":         s.startScan,
+		"getScanStatus":     s.getScanStatus,
+		"getPlaylists":      s.getPlaylists,
+		"getPlaylist":       s.getPlaylist,
+		"createPlaylist":    s.createPlaylist,
+		"deletePlaylist":    s.deletePlaylist,
+		"updatePlaylist":    s.updatePlaylist,
+		"jukeboxControl":    s.jukeboxControl,
+	}
+	handler, ok := handlers[endpoint]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	key, value, err := handler(query)
+	s.writeResponse(w, key, value, err)
+}
+
+// checkAuth validates plaintext or token/salt authentication
+func (s *Server) checkAuth(query url.Values) *subsonic.SubsonicError {
+	user := query.Get("u")
+	if user == "" || query.Get("v") == "" || query.Get("c") == "" {
+		return &subsonic.SubsonicError{Code: ErrorMissingParam, Message: "Required parameter is missing."}
+	}
+
+	var valid bool
+	if password := query.Get("p"); password != "" {
+		if strings.HasPrefix(password, "enc:") {
+			if decoded, err := hex.DecodeString(password[4:]); err == nil {
+				password = string(decoded)
+			}
+		}
+		valid = password == s.password
+	} else if token, salt := query.Get("t"), query.Get("s"); token != "" && salt != "" {
+		sum := md5.Sum([]byte(s.password + salt))
+		valid = token == hex.EncodeToString(sum[:])
+	} else {
+		return &subsonic.SubsonicError{Code: ErrorMissingParam, Message: "Required parameter is missing."}
+	}
+
+	if !valid || user != s.username {
+		return &subsonic.SubsonicError{Code: ErrorWrongAuth, Message: "Wrong username or password."}
+	}
+	return nil
+}
+
+func (s *Server) writeResponse(w http.ResponseWriter, key string, value interface{}, apiErr *subsonic.SubsonicError) {
+	response := map[string]interface{}{
+		"status":  "ok",
+		"version": apiVersion,
+	}
+	if apiErr != nil {
+		response["status"] = "failed"
+		response["error"] = apiErr
+	} else if key != "" {
+		response[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"subsonic-response": response})
+}
+
+func missingParam(name string) *subsonic.SubsonicError {
+	return &subsonic.SubsonicError{Code: ErrorMissingParam, Message: "Required parameter is missing: " + name}
+}
+
+func notFound(what string) *subsonic.SubsonicError {
+	return &subsonic.SubsonicError{Code: ErrorNotFound, Message: what + " not found."}
+}
+
+// intParam returns the integer parameter or the fallback if it's not set or invalid
+func intParam(query url.Values, name string, fallback int) int {
+	if value, err := strconv.Atoi(query.Get(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// page applies offset and size to a list of entities
+func page(entities subsonic.SubsonicEntities, offset, size int) subsonic.SubsonicEntities {
+	if offset > len(entities) {
+		offset = len(entities)
+	}
+	entities = entities[offset:]
+	if size >= 0 && size < len(entities) {
+		entities = entities[:size]
+	}
+	return entities
+}
+
+// handlers, called with mutex held
+func (s *Server) ping(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	return "", nil, nil
+}
+
+func (s *Server) getMusicFolders(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	folders := subsonic.SubsonicMusicFolders{Folders: []subsonic.SubsonicMusicFolder{}}
+	for _, folder := range s.library.Folders {
+		folders.Folders = append(folders.Folders, subsonic.SubsonicMusicFolder{
+			Id:   subsonic.SubsonicId(folder.Id),
+			Name: folder.Name,
+		})
+	}
+	return "musicFolders", folders, nil
+}
+
+func (s *Server) getIndexes(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	artists := s.library.artists(query.Get("musicFolderId"))
+	sort.SliceStable(artists, func(i, j int) bool {
+		return strings.ToLower(artists[i].Name) < strings.ToLower(artists[j].Name)
+	})
+
+	indexes := subsonic.SubsonicIndexes{Index: []subsonic.SubsonicIndex{}}
+	for _, artist := range artists {
+		name := strings.ToUpper(artist.Name[:1])
+		if len(indexes.Index) == 0 || indexes.Index[len(indexes.Index)-1].Name != name {
+			indexes.Index = append(indexes.Index, subsonic.SubsonicIndex{Name: name})
+		}
+		index := &indexes.Index[len(indexes.Index)-1]
+		index.Artists = append(index.Artists, subsonic.SubsonicArtist{
+			Id:         artist.Id,
+			Name:       artist.Name,
+			AlbumCount: len(artist.Albums),
+		})
+	}
+	return "indexes", indexes, nil
+}
+
+func (s *Server) getMusicDirectory(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	id := query.Get("id")
+	if id == "" {
+		return "", nil, missingParam("id")
+	}
+
+	artist, album, song := s.library.find(id)
+	switch {
+	case artist == nil || song != nil:
+		return "", nil, notFound("Directory")
+	case album == nil:
+		directory := subsonic.SubsonicDirectory{Id: artist.Id, Name: artist.Name, Entities: subsonic.SubsonicEntities{}}
+		for i := range artist.Albums {
+			directory.Entities = append(directory.Entities, albumEntity(artist, &artist.Albums[i]))
+		}
+		return "directory", directory, nil
+	default:
+		directory := subsonic.SubsonicDirectory{Id: album.Id, Parent: artist.Id, Name: album.Title, Entities: subsonic.SubsonicEntities{}}
+		directory.Entities = append(directory.Entities, album.Songs...)
+		return "directory", directory, nil
+	}
+}
+
+func (s *Server) getRandomSongs(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	songs := s.library.songs(query.Get("musicFolderId"))
+	rand.Shuffle(len(songs), songs.Swap)
+	songs = page(songs, 0, intParam(query, "size", 10))
+	return "randomSongs", subsonic.SubsonicSongs{Song: songs}, nil
+}
+
+func (s *Server) getAlbumList(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	albums := s.library.albums(query.Get("musicFolderId"))
+	switch query.Get("type") {
+	case "":
+		return "", nil, missingParam("type")
+	case "random":
+		rand.Shuffle(len(albums), albums.Swap)
+	case "alphabeticalByName":
+		sort.SliceStable(albums, func(i, j int) bool { return albums[i].Title < albums[j].Title })
+	case "alphabeticalByArtist":
+		sort.SliceStable(albums, func(i, j int) bool { return albums[i].Artist < albums[j].Artist })
+	case "starred":
+		starred := subsonic.SubsonicEntities{}
+		for _, album := range albums {
+			if _, ok := s.starred[album.Id]; ok {
+				starred = append(starred, album)
+			}
+		}
+		albums = starred
+	}
+
+	albums = page(albums, intParam(query, "offset", 0), intParam(query, "size", 10))
+	if albums == nil {
+		albums = subsonic.SubsonicEntities{}
+	}
+	return "albumList", subsonic.SubsonicAlbumList{Album: albums}, nil
+}
+
+func (s *Server) search2(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	term := strings.ToLower(strings.Trim(query.Get("query"), `"*`))
+	folderId := query.Get("musicFolderId")
+	matches := func(text string) bool {
+		return strings.Contains(strings.ToLower(text), term)
+	}
+
+	result := subsonic.SubsonicSearchResult{
+		Artist: []subsonic.SubsonicArtist{},
+		Album:  subsonic.SubsonicEntities{},
+		Song:   subsonic.SubsonicEntities{},
+	}
+	for _, artist := range s.library.artists(folderId) {
+		if matches(artist.Name) {
+			result.Artist = append(result.Artist, subsonic.SubsonicArtist{Id: artist.Id, Name: artist.Name, AlbumCount: len(artist.Albums)})
+		}
+	}
+	for _, album := range s.library.albums(folderId) {
+		if matches(album.Title) {
+			result.Album = append(result.Album, album)
+		}
+	}
+	for _, song := range s.library.songs(folderId) {
+		if matches(song.Title) {
+			result.Song = append(result.Song, song)
+		}
+	}
+
+	if count := intParam(query, "artistCount", 20); count < len(result.Artist) {
+		result.Artist = result.Artist[:count]
+	}
+	result.Album = page(result.Album, intParam(query, "albumOffset", 0), intParam(query, "albumCount", 20))
+	result.Song = page(result.Song, intParam(query, "songOffset", 0), intParam(query, "songCount", 20))
+	return "searchResult2", result, nil
+}
+
+func (s *Server) scrobble(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	ids := query["id"]
+	if len(ids) == 0 {
+		return "", nil, missingParam("id")
+	}
+
+	// submission defaults to true
+	submission := query.Get("submission") != "false"
+	times := query["time"]
+	for i, id := range ids {
+		if _, _, song := s.library.find(id); song == nil {
+			return "", nil, notFound("Song")
+		}
+		scrobble := Scrobble{Id: id, Submission: submission}
+		if i < len(times) {
+			scrobble.Time, _ = strconv.ParseInt(times[i], 10, 64)
+		}
+		s.scrobbles = append(s.scrobbles, scrobble)
+	}
+	return "", nil, nil
+}
+
+func (s *Server) getStarred(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	artists := []artistEntity{}
+	albums := subsonic.SubsonicEntities{}
+	songs := subsonic.SubsonicEntities{}
+	for _, folder := range s.library.Folders {
+		for ai := range folder.Artists {
+			artist := &folder.Artists[ai]
+			if _, ok := s.starred[artist.Id]; ok {
+				artists = append(artists, artistEntity{Id: artist.Id, Name: artist.Name})
+			}
+			for bi := range artist.Albums {
+				album := &artist.Albums[bi]
+				if _, ok := s.starred[album.Id]; ok {
+					albums = append(albums, albumEntity(artist, album))
+				}
+				for _, song := range album.Songs {
+					if starred, ok := s.starred[song.Id]; ok {
+						song.Starred = starred.UTC().Format(time.RFC3339)
+						songs = append(songs, song)
+					}
+				}
+			}
+		}
+	}
+
+	return "starred", map[string]interface{}{
+		"artist": artists,
+		"album":  albums,
+		"song":   songs,
+	}, nil
+}
+
+func (s *Server) star(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	return s.setStarred(query, true)
+}
+
+func (s *Server) unstar(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	return s.setStarred(query, false)
+}
+
+func (s *Server) setStarred(query url.Values, starred bool) (string, interface{}, *subsonic.SubsonicError) {
+	ids := append(append(query["id"], query["albumId"]...), query["artistId"]...)
+	if len(ids) == 0 {
+		return "", nil, missingParam("id")
+	}
+	for _, id := range ids {
+		if artist, _, _ := s.library.find(id); artist == nil {
+			return "", nil, notFound("Item")
+		}
+		if starred {
+			s.starred[id] = time.Now()
+		} else {
+			delete(s.starred, id)
+		}
+	}
+	return "", nil, nil
+}
+
+func (s *Server) getNowPlaying(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	entries := append([]subsonic.SubsonicNowPlayingEntry{}, s.nowPlaying...)
+	return "nowPlaying", subsonic.SubsonicNowPlaying{Entries: entries}, nil
+}
+
+func (s *Server) startScan(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	if !s.scanning {
+		s.scanning = true
+		s.scanStep = 0
+		s.scanCount = 0
+	}
+	return "scanStatus", subsonic.SubsonicScanStatus{Scanning: true, Count: s.scanCount}, nil
+}
+
+func (s *Server) getScanStatus(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	if s.scanning {
+		s.scanStep++
+		s.scanCount = len(s.library.songs("")) * s.scanStep / s.scanSteps
+		s.scanning = s.scanStep < s.scanSteps
+	}
+	return "scanStatus", subsonic.SubsonicScanStatus{Scanning: s.scanning, Count: s.scanCount}, nil
+}
+
+func (s *Server) findPlaylist(id string) int {
+	for i, playlist := range s.library.Playlists {
+		if string(playlist.Id) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) getPlaylists(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	playlists := subsonic.SubsonicPlaylists{Playlists: []subsonic.SubsonicPlaylist{}}
+	for _, playlist := range s.library.Playlists {
+		// getPlaylists doesn't include the songs
+		playlists.Playlists = append(playlists.Playlists, subsonic.SubsonicPlaylist{
+			Id:        playlist.Id,
+			Name:      playlist.Name,
+			SongCount: len(playlist.Entries),
+		})
+	}
+	return "playlists", playlists, nil
+}
+
+func (s *Server) getPlaylist(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	id := query.Get("id")
+	if id == "" {
+		return "", nil, missingParam("id")
+	}
+	index := s.findPlaylist(id)
+	if index < 0 {
+		return "", nil, notFound("Playlist")
+	}
+
+	playlist := s.library.Playlists[index]
+	playlist.SongCount = len(playlist.Entries)
+	playlist.Entries = append(subsonic.SubsonicEntities{}, playlist.Entries...)
+	return "playlist", playlist, nil
+}
+
+func (s *Server) createPlaylist(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	name := query.Get("name")
+	if name == "" {
+		return "", nil, missingParam("name")
+	}
+
+	playlist := subsonic.SubsonicPlaylist{
+		Id:      subsonic.SubsonicId(fmt.Sprintf("pl-%d", s.nextPlaylist)),
+		Name:    name,
+		Entries: subsonic.SubsonicEntities{},
+	}
+	s.nextPlaylist++
+	for _, id := range query["songId"] {
+		if _, _, song := s.library.find(id); song != nil {
+			playlist.Entries = append(playlist.Entries, *song)
+		}
+	}
+	playlist.SongCount = len(playlist.Entries)
+	s.library.Playlists = append(s.library.Playlists, playlist)
+	return "playlist", playlist, nil
+}
+
+func (s *Server) deletePlaylist(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	index := s.findPlaylist(query.Get("id"))
+	if index < 0 {
+		return "", nil, notFound("Playlist")
+	}
+	s.library.Playlists = append(s.library.Playlists[:index], s.library.Playlists[index+1:]...)
+	return "", nil, nil
+}
+
+func (s *Server) updatePlaylist(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	index := s.findPlaylist(query.Get("playlistId"))
+	if index < 0 {
+		return "", nil, notFound("Playlist")
+	}
+	playlist := &s.library.Playlists[index]
+
+	if name := query.Get("name"); name != "" {
+		playlist.Name = name
+	}
+
+	// remove by index, highest index first so the others stay valid
+	removeIndexes := []int{}
+	for _, value := range query["songIndexToRemove"] {
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(playlist.Entries) {
+			return "", nil, notFound("Song index")
+		}
+		removeIndexes = append(removeIndexes, i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(removeIndexes)))
+	for _, i := range removeIndexes {
+		playlist.Entries = append(playlist.Entries[:i], playlist.Entries[i+1:]...)
+	}
+
+	for _, id := range query["songIdToAdd"] {
+		_, _, song := s.library.find(id)
+		if song == nil {
+			return "", nil, notFound("Song")
+		}
+		playlist.Entries = append(playlist.Entries, *song)
+	}
+	playlist.SongCount = len(playlist.Entries)
+	return "", nil, nil
+}
+
+func (s *Server) jukeboxControl(query url.Values) (string, interface{}, *subsonic.SubsonicError) {
+	jukebox := &s.jukebox
+
+	songs := subsonic.SubsonicEntities{}
+	for _, id := range query["id"] {
+		_, _, song := s.library.find(id)
+		if song == nil {
+			return "", nil, notFound("Song")
+		}
+		songs = append(songs, *song)
+	}
+
+	switch query.Get("action") {
+	case "get":
+		playlist := *jukebox
+		playlist.Entries = append(subsonic.SubsonicEntities{}, jukebox.Entries...)
+		return "jukeboxPlaylist", playlist, nil
+	case "status":
+		// nothing to do
+	case "set":
+		jukebox.Entries = songs
+		jukebox.CurrentIndex = -1
+		jukebox.Position = 0
+		jukebox.Playing = false
+	case "start":
+		if len(jukebox.Entries) > 0 {
+			if jukebox.CurrentIndex < 0 {
+				jukebox.CurrentIndex = 0
+			}
+			jukebox.Playing = true
+		}
+	case "stop":
+		jukebox.Playing = false
+	case "skip":
+		index := intParam(query, "index", -1)
+		if index < 0 || index >= len(jukebox.Entries) {
+			return "", nil, &subsonic.SubsonicError{Code: ErrorGeneric, Message: "Invalid index."}
+		}
+		jukebox.CurrentIndex = index
+		jukebox.Position = intParam(query, "offset", 0)
+		jukebox.Playing = true
+	case "add":
+		jukebox.Entries = append(jukebox.Entries, songs...)
+	case "clear":
+		jukebox.Entries = subsonic.SubsonicEntities{}
+		jukebox.CurrentIndex = -1
+		jukebox.Position = 0
+	case "remove":
+		index := intParam(query, "index", -1)
+		if index < 0 || index >= len(jukebox.Entries) {
+			return "", nil, &subsonic.SubsonicError{Code: ErrorGeneric, Message: "Invalid index."}
+		}
+		jukebox.Entries = append(jukebox.Entries[:index], jukebox.Entries[index+1:]...)
+		if index < jukebox.CurrentIndex {
+			jukebox.CurrentIndex--
+		}
+	case "setGain":
+		gain, err := strconv.ParseFloat(query.Get("gain"), 64)
+		if err != nil || gain < 0 || gain > 1 {
+			return "", nil, &subsonic.SubsonicError{Code: ErrorGeneric, Message: "Invalid gain."}
+		}
+		jukebox.Gain = gain
+	case "":
+		return "", nil, missingParam("action")
+	default:
+		return "", nil, &subsonic.SubsonicError{Code: ErrorGeneric, Message: "Unknown jukebox action."}
+	}
+
+	status := *jukebox
+	status.Entries = nil
+	return "jukeboxStatus", status, nil
+}
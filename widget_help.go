@@ -59,6 +59,12 @@ func (h *HelpWidget) RenderHelp(context string) {
 	case PagePlaylists:
 		rightText = "[::b]Playlists[::-]\n" + tview.Escape(strings.TrimSpace(helpPagePlaylists))
 
+	case PageNowPlaying:
+		rightText = "[::b]Now Playing[::-]\n" + tview.Escape(strings.TrimSpace(helpPageNowPlaying))
+
+	case PageEqualizer:
+		rightText = "[::b]Equalizer[::-]\n" + tview.Escape(strings.TrimSpace(helpPageEqualizer))
+
 	case PageLog:
 		fallthrough
 	default:
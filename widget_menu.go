@@ -23,7 +23,7 @@ type MenuWidget struct {
 	ui *Ui
 }
 
-var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageLog}
+var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageLog, PageNowPlaying, PageEqualizer}
 
 func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m = &MenuWidget{
@@ -64,8 +64,8 @@ func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m.buttonsRight.AddItem(quitButton, 9, 0, false)
 
 	m.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
-		AddItem(m.buttonsLeft, 0, 4, false).
-		AddItem(m.buttonsRight, 0, 2, false)
+		AddItem(m.buttonsLeft, 0, 1, false).
+		AddItem(m.buttonsRight, 18, 0, false)
 
 	// clear background
 	m.Root.Box = tview.NewBox()
@@ -88,7 +88,7 @@ func (m *MenuWidget) createPageButtons() {
 
 		m.buttons[page] = button
 		// add button
-		m.buttonsLeft.AddItem(button, 15, 0, false)
+		m.buttonsLeft.AddItem(button, 14, 0, false)
 
 		// add spacer
 		if i < len(buttonOrder)-1 {
@@ -119,6 +119,12 @@ func (m *MenuWidget) SetActivePage(name string) {
 	m.updatePageButtons()
 }
 
+// HasPage returns true if there's a button for the page
+func (m *MenuWidget) HasPage(name string) bool {
+	_, ok := m.buttons[name]
+	return ok
+}
+
 func (m *MenuWidget) GetActivePage() string {
 	return m.activeButton
 }
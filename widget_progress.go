@@ -0,0 +1,103 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/player"
+)
+
+// ProgressBar shows how far the current song has played. Clicking it seeks
+// to that point of the song.
+type ProgressBar struct {
+	*tview.Box
+
+	position int64
+	duration int64
+	// seconds buffered ahead of the position
+	cache player.CacheState
+
+	playedStyle    tcell.Style
+	bufferedStyle  tcell.Style
+	remainingStyle tcell.Style
+
+	// external references
+	ui *Ui
+}
+
+func (ui *Ui) createProgressBar() *ProgressBar {
+	return &ProgressBar{
+		Box: tview.NewBox(),
+
+		playedStyle:    tcell.StyleDefault.Foreground(tcell.ColorGreen),
+		bufferedStyle:  tcell.StyleDefault.Foreground(tcell.ColorSilver),
+		remainingStyle: tcell.StyleDefault.Foreground(tcell.ColorGray),
+
+		ui: ui,
+	}
+}
+
+// SetProgress updates the position and duration in seconds
+func (p *ProgressBar) SetProgress(position, duration int64) {
+	p.position = position
+	p.duration = duration
+}
+
+// SetCache updates how much of the song is buffered
+func (p *ProgressBar) SetCache(cache player.CacheState) {
+	p.cache = cache
+}
+
+func (p *ProgressBar) Draw(screen tcell.Screen) {
+	p.Box.DrawForSubclass(screen, p)
+	x, y, width, height := p.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	played, buffered := 0, 0
+	if p.duration > 0 && p.position > 0 {
+		played = int(int64(width) * p.position / p.duration)
+		if played > width {
+			played = width
+		}
+	}
+	if p.duration > 0 {
+		buffered = int(float64(width) * (float64(p.position) + p.cache.Duration) / float64(p.duration))
+		if p.cache.EOF || buffered > width {
+			buffered = width
+		}
+	}
+
+	for i := 0; i < width; i++ {
+		switch {
+		case i < played:
+			screen.SetContent(x+i, y, '━', nil, p.playedStyle)
+		case i < buffered:
+			screen.SetContent(x+i, y, '─', nil, p.bufferedStyle)
+		default:
+			screen.SetContent(x+i, y, '─', nil, p.remainingStyle)
+		}
+	}
+}
+
+func (p *ProgressBar) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	return p.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		x, y := event.Position()
+		if action != tview.MouseLeftClick || !p.InRect(x, y) {
+			return false, nil
+		}
+
+		left, _, width, _ := p.GetInnerRect()
+		if width <= 0 || p.duration <= 0 {
+			return true, nil
+		}
+		percent := float64(x-left) * 100 / float64(width)
+		if err := p.ui.player.SeekPercent(percent); err != nil {
+			p.ui.logger.PrintError("SeekPercent", err)
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// indicators in the top bar, shown in this order
+const (
+	IndicatorPlayerMode = iota
+	IndicatorPlaybackModes
+	IndicatorSleep
+	IndicatorScan
+	IndicatorScrobbles
+	indicatorCount
+)
+
+const (
+	// the play state and song keep at least this many columns
+	topBarMinStatusWidth = 30
+	topBarProgressWidth  = 18
+	topBarPlayerWidth    = 20
+)
+
+// TopBar shows the play state and the song on the left, then the indicators,
+// the progress bar and the volume and position. The indicators are as wide as
+// their text, the progress bar is left out if the terminal is too narrow, so
+// that the song always keeps some space.
+type TopBar struct {
+	*tview.Flex
+
+	status     *tview.TextView
+	indicators *tview.TextView
+	progress   *ProgressBar
+	player     *tview.TextView
+
+	// text of each indicator, empty ones are hidden
+	texts [indicatorCount]string
+}
+
+func (ui *Ui) createTopBar(status *tview.TextView, progress *ProgressBar, player *tview.TextView) *TopBar {
+	indicators := tview.NewTextView().
+		SetTextAlign(tview.AlignRight).
+		SetDynamicColors(true).
+		SetScrollable(false)
+
+	return &TopBar{
+		Flex: tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(status, 0, 1, false).
+			AddItem(indicators, 0, 0, false).
+			AddItem(progress, topBarProgressWidth, 0, false).
+			AddItem(player, topBarPlayerWidth, 0, false),
+
+		status:     status,
+		indicators: indicators,
+		progress:   progress,
+		player:     player,
+	}
+}
+
+// SetIndicator changes the text of an indicator, empty hides it
+func (t *TopBar) SetIndicator(indicator int, text string) {
+	t.texts[indicator] = text
+
+	shown := []string{}
+	for _, text := range t.texts {
+		if text != "" {
+			shown = append(shown, text)
+		}
+	}
+	t.indicators.SetText(strings.Join(shown, " "))
+}
+
+// Indicator returns the text of an indicator
+func (t *TopBar) Indicator(indicator int) string {
+	return t.texts[indicator]
+}
+
+// topBarLayout returns the widths of the indicators and the progress bar for
+// a top bar width columns wide. Indicators come before the progress bar, the
+// indicators are cut off if even they don't fit.
+func topBarLayout(width, indicatorsWidth int) (indicators, progress int) {
+	available := width - topBarMinStatusWidth - topBarPlayerWidth
+	if indicatorsWidth > 0 {
+		// separated from the song by a space
+		indicators = indicatorsWidth + 1
+	}
+	if indicators > available {
+		indicators = available
+	}
+	if indicators < 0 {
+		indicators = 0
+	}
+	if available-indicators >= topBarProgressWidth {
+		progress = topBarProgressWidth
+	}
+	return
+}
+
+func (t *TopBar) Draw(screen tcell.Screen) {
+	_, _, width, _ := t.GetInnerRect()
+	indicators, progress := topBarLayout(width, tview.TaggedStringWidth(t.indicators.GetText(false)))
+	t.ResizeItem(t.indicators, indicators, 0)
+	t.ResizeItem(t.progress, progress, 0)
+	t.Flex.Draw(screen)
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import "testing"
+
+func TestTopBarLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		width           int
+		indicatorsWidth int
+
+		indicators, progress int
+	}{
+		{name: "no indicators", width: 80, indicators: 0, progress: 18},
+		{name: "shuffle", width: 80, indicatorsWidth: 7, indicators: 8, progress: 18},
+		{name: "indicators before the progress", width: 80, indicatorsWidth: 20, indicators: 21, progress: 0},
+		{name: "indicators cut off", width: 80, indicatorsWidth: 60, indicators: 30, progress: 0},
+		{name: "wide terminal", width: 120, indicatorsWidth: 40, indicators: 41, progress: 18},
+		{name: "too narrow for anything", width: 40, indicatorsWidth: 7, indicators: 0, progress: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indicators, progress := topBarLayout(tc.width, tc.indicatorsWidth)
+			if indicators != tc.indicators || progress != tc.progress {
+				t.Errorf("expected %d %d, got %d %d", tc.indicators, tc.progress, indicators, progress)
+			}
+		})
+	}
+}